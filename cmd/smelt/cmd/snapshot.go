@@ -3,6 +3,10 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 	"text/tabwriter"
 	"time"
 
@@ -23,7 +27,16 @@ var snapshotSaveCmd = &cobra.Command{
 	Short: "Save the running stack to a named snapshot",
 	Long: `Stops the stack gracefully, captures the in-memory anvil state,
 archives every docker volume in the resolved manifest, and copies keys and
-smelt.yml. The stack is left stopped on success.`,
+smelt.yml. The stack is left stopped on success.
+
+Volume archives are zstd-compressed. With --chunked they are instead split
+into content-addressed chunks in generated/snapshots/.chunks/, shared with
+every other chunked snapshot, so repeated saves of a similar stack only
+store what changed.
+
+With --live the stack keeps running: chain state is captured through anvil's
+anvil_dumpState RPC and services writing to snapshot volumes are paused only
+while those volumes are archived.`,
 	Args: cobra.ExactArgs(1),
 	RunE: runSnapshotSave,
 }
@@ -39,7 +52,13 @@ drive off it — the project root smelt.yml is never modified.
 Accepts either a snapshot name (resolved under generated/snapshots/) or a
 path to a snapshot directory elsewhere on disk. Stack must be fully stopped.
 Run 'make up' after to boot from the restored state, or use
-'make up SNAPSHOT=<name-or-path>' to do both in one step.`,
+'make up SNAPSHOT=<name-or-path>' to do both in one step.
+
+--image-policy decides what happens when the images compose would run
+differ from the ones the snapshot was saved with: "warn" (default) reports
+the drift, "fail" aborts before any volume is restored, and "pin" writes
+the snapshot's recorded digests to generated/snapshot-scratch/images.env,
+which 'make up' layers over .env until 'make clean'.`,
 	Args: cobra.ExactArgs(1),
 	RunE: runSnapshotLoad,
 }
@@ -47,9 +66,171 @@ Run 'make up' after to boot from the restored state, or use
 var snapshotListCmd = &cobra.Command{
 	Use:   "list",
 	Short: "List available snapshots",
-	RunE:  runSnapshotList,
+	Long: `Lists the snapshots under generated/snapshots/, or with --remote the
+snapshots in a remote's index.
+
+` + remoteHelp,
+	RunE: runSnapshotList,
+}
+
+var snapshotVerifyCmd = &cobra.Command{
+	Use:   "verify NAME_OR_PATH",
+	Short: "Check a snapshot's files against its recorded digests",
+	Long: `Re-hashes every file in the snapshot and compares against the SHA-256
+digests recorded in manifest.json at save time, reporting missing keys,
+truncated volume archives, or hand-edited chain state. Snapshots saved
+before digests were recorded get a structural check only (referenced
+files present, volume archives readable).
+
+Load runs the same check automatically before restoring anything.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runSnapshotVerify,
+}
+
+var snapshotRepackCmd = &cobra.Command{
+	Use:   "repack NAME_OR_PATH",
+	Short: "Rewrite a snapshot's volume archives as zstd or shared chunks",
+	Long: `Converts an existing snapshot's volume archives in place — plain .tar
+archives from older snapshots become .tar.zst, or with --chunked move into
+the shared chunk store next to the snapshot — and refreshes the digests in
+manifest.json. The snapshot is verified before anything is rewritten.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runSnapshotRepack,
+}
+
+var snapshotInspectCmd = &cobra.Command{
+	Use:   "inspect NAME_OR_PATH",
+	Short: "Show what a snapshot contains",
+	Long: `Prints a snapshot's piri topology (from its smelt.yml) with each node's
+DID and registration proof, the images it was saved against, per-volume
+archive format and sizes, and the contract addresses from
+deployed-addresses.json. Reads only the snapshot directory; docker is not
+needed.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runSnapshotInspect,
+}
+
+var snapshotDiffCmd = &cobra.Command{
+	Use:   "diff A B",
+	Short: "Compare two snapshots",
+	Long: `Compares two snapshots' piri topology and identities, images,
+deployed contracts, and volume contents file by file. Volumes whose
+archives carry identical digests are skipped without decompressing.
+Exits non-zero when the snapshots differ.`,
+	Args: cobra.ExactArgs(2),
+	RunE: runSnapshotDiff,
 }
 
+var snapshotRebaseCmd = &cobra.Command{
+	Use:   "rebase NAME_OR_PATH --image KEY=REF...",
+	Short: "Re-save a snapshot against new images",
+	Long: `Loads the snapshot with every image pinned to its recorded digest,
+swaps in the --image replacements, boots the stack and waits for every
+service to come up healthy against the old state (which is when services
+have run their migrations), then saves the result.
+
+KEY is a compose service (upload, indexer, ...), "piri" for every piri
+node, or an image variable such as UPLOAD_IMAGE. The rebased snapshot
+replaces the source under generated/snapshots/ unless --as names a new one.
+
+If a service fails to come up, the services that failed are reported, the
+snapshot is not re-saved, and the stack is left running for 'make logs'.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runSnapshotRebase,
+}
+
+var snapshotBuildMatrixCmd = &cobra.Command{
+	Use:   "build-matrix [FILE]",
+	Short: "Build the embedded snapshots listed in a matrix file",
+	Long: `Cold-boots the stack once per entry in FILE (default snapshots/matrix.yml)
+and saves each result into snapshots/, where it's embedded in the Go module
+for stack.WithEmbeddedSnapshot. An entry names a node count and storage
+backends:
+
+  snapshots:
+    - {nodes: 1, db: postgres, blob: s3}   # → snapshots/1-piri-s3-postgres
+
+Each boot runs 'make clean', 'make init' and 'make up' with the entry's
+topology as the session manifest, so this WIPES the project's volumes and
+chain state, and the stack must be down to start. Entries already in the
+output directory are skipped unless --force; --only builds a subset.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runSnapshotBuildMatrix,
+}
+
+var snapshotPruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Delete old snapshots by count, age, or total size",
+	Long: `Deletes snapshots under generated/snapshots/ by retention rule:
+
+  --keep-last N         keep the N newest; on its own, delete the rest
+  --older-than AGE      delete snapshots older than AGE (e.g. 7d, 36h);
+                        with --keep-last, only beyond the N newest
+  --max-total-size SIZE then delete the oldest remaining snapshots until
+                        the directory, chunk store included, fits (e.g. 20GB)
+
+Pinned snapshots ('smelt snapshot pin') are never deleted. Chunks only the
+deleted snapshots referenced are removed from the shared store. Use
+--dry-run to see what would go and how much space it frees.`,
+	Args: cobra.NoArgs,
+	RunE: runSnapshotPrune,
+}
+
+var snapshotPinCmd = &cobra.Command{
+	Use:   "pin NAME",
+	Short: "Protect a snapshot from prune",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		projectDir, _ := cmd.Flags().GetString("project-dir")
+		return snapshot.SetPinned(projectDir, args[0], true)
+	},
+}
+
+var snapshotUnpinCmd = &cobra.Command{
+	Use:   "unpin NAME",
+	Short: "Let prune delete a pinned snapshot again",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		projectDir, _ := cmd.Flags().GetString("project-dir")
+		return snapshot.SetPinned(projectDir, args[0], false)
+	},
+}
+
+var snapshotPushCmd = &cobra.Command{
+	Use:   "push NAME_OR_PATH --remote URL",
+	Short: "Upload a snapshot to a shared remote",
+	Long: `Verifies a snapshot and uploads it to a remote: every file as a blob
+named by its content digest, chunked volumes chunk by chunk, and finally
+the descriptor as the snapshot's entry in the remote's index. Content the
+remote already holds — from this snapshot's last push or any other — is
+skipped.
+
+` + remoteHelp,
+	Args: cobra.ExactArgs(1),
+	RunE: runSnapshotPush,
+}
+
+var snapshotPullCmd = &cobra.Command{
+	Use:   "pull NAME --remote URL",
+	Short: "Download a snapshot from a shared remote",
+	Long: `Downloads a snapshot from a remote into generated/snapshots/, checking
+every file against its digest. Chunks the local store already holds are
+not downloaded again. Load it afterwards with 'make up SNAPSHOT=NAME'.
+
+` + remoteHelp,
+	Args: cobra.ExactArgs(1),
+	RunE: runSnapshotPull,
+}
+
+// remoteHelp documents the --remote URL forms shared by push, pull and
+// list.
+const remoteHelp = `--remote defaults to $SMELT_SNAPSHOT_REMOTE and takes:
+  s3://bucket/prefix  credentials, region and endpoint from the usual AWS_*
+                      variables; for the stack's MinIO use
+                      AWS_ENDPOINT_URL=http://localhost:15070 with
+                      minioadmin/minioadmin
+  file:///path        a directory, e.g. a shared mount`
+
 var snapshotRmCmd = &cobra.Command{
 	Use:   "rm NAME",
 	Short: "Delete a snapshot",
@@ -63,37 +244,100 @@ func init() {
 	snapshotCmd.AddCommand(snapshotLoadCmd)
 	snapshotCmd.AddCommand(snapshotListCmd)
 	snapshotCmd.AddCommand(snapshotRmCmd)
+	snapshotCmd.AddCommand(snapshotVerifyCmd)
+	snapshotCmd.AddCommand(snapshotRepackCmd)
+	snapshotCmd.AddCommand(snapshotInspectCmd)
+	snapshotCmd.AddCommand(snapshotDiffCmd)
+	snapshotCmd.AddCommand(snapshotRebaseCmd)
+	snapshotCmd.AddCommand(snapshotBuildMatrixCmd)
+	snapshotCmd.AddCommand(snapshotPruneCmd)
+	snapshotCmd.AddCommand(snapshotPinCmd)
+	snapshotCmd.AddCommand(snapshotUnpinCmd)
+	snapshotCmd.AddCommand(snapshotPushCmd)
+	snapshotCmd.AddCommand(snapshotPullCmd)
 
 	snapshotSaveCmd.Flags().StringP("project-dir", "d", ".", "project root directory")
 	snapshotSaveCmd.Flags().Bool("force", false, "overwrite an existing snapshot with the same name")
+	snapshotSaveCmd.Flags().Bool("chunked", false, "store volumes as deduplicated chunks shared across snapshots")
+	snapshotSaveCmd.Flags().Bool("live", false, "save without stopping the stack (pauses volume writers briefly)")
 
 	snapshotLoadCmd.Flags().StringP("project-dir", "d", ".", "project root directory")
+	snapshotLoadCmd.Flags().String("image-policy", string(snapshot.ImagePolicyWarn), "on image drift: warn, fail, or pin to the snapshot's images")
 
 	snapshotListCmd.Flags().StringP("project-dir", "d", ".", "project root directory")
+	snapshotListCmd.Flags().String("remote", "", "list a remote's snapshots instead (s3://bucket/prefix or file:///path)")
 
 	snapshotRmCmd.Flags().StringP("project-dir", "d", ".", "project root directory")
+
+	snapshotVerifyCmd.Flags().StringP("project-dir", "d", ".", "project root directory")
+
+	snapshotRepackCmd.Flags().StringP("project-dir", "d", ".", "project root directory")
+	snapshotRepackCmd.Flags().Bool("chunked", false, "move volumes into the shared chunk store")
+
+	snapshotInspectCmd.Flags().StringP("project-dir", "d", ".", "project root directory")
+
+	snapshotDiffCmd.Flags().StringP("project-dir", "d", ".", "project root directory")
+
+	snapshotRebaseCmd.Flags().StringP("project-dir", "d", ".", "project root directory")
+	snapshotRebaseCmd.Flags().StringArray("image", nil, "replacement image as KEY=REF (repeatable)")
+	snapshotRebaseCmd.Flags().String("as", "", "save the rebased snapshot under this name instead of replacing the source")
+	snapshotRebaseCmd.Flags().Duration("timeout", 5*time.Minute, "how long to wait for services to become healthy")
+
+	snapshotBuildMatrixCmd.Flags().StringP("project-dir", "d", ".", "project root directory")
+	snapshotBuildMatrixCmd.Flags().String("output", "", "directory to write snapshots to (default: the project's snapshots/)")
+	snapshotBuildMatrixCmd.Flags().StringArray("only", nil, "build only this entry (repeatable)")
+	snapshotBuildMatrixCmd.Flags().Bool("force", false, "rebuild entries that already exist in the output directory")
+	snapshotBuildMatrixCmd.Flags().Bool("chunked", false, "store volumes as chunks shared between the entries")
+	snapshotBuildMatrixCmd.Flags().Duration("timeout", 10*time.Minute, "how long to wait for each stack to become healthy")
+
+	snapshotPruneCmd.Flags().StringP("project-dir", "d", ".", "project root directory")
+	snapshotPruneCmd.Flags().Int("keep-last", 0, "always keep the N newest snapshots")
+	snapshotPruneCmd.Flags().String("older-than", "", "delete snapshots older than this age (e.g. 7d, 36h)")
+	snapshotPruneCmd.Flags().String("max-total-size", "", "delete oldest snapshots until the total fits (e.g. 20GB)")
+	snapshotPruneCmd.Flags().Bool("dry-run", false, "show what would be deleted without deleting")
+
+	snapshotPinCmd.Flags().StringP("project-dir", "d", ".", "project root directory")
+	snapshotUnpinCmd.Flags().StringP("project-dir", "d", ".", "project root directory")
+
+	snapshotPushCmd.Flags().StringP("project-dir", "d", ".", "project root directory")
+	snapshotPushCmd.Flags().String("remote", "", "remote to push to (default $SMELT_SNAPSHOT_REMOTE)")
+	snapshotPushCmd.Flags().String("as", "", "name in the remote (default: the snapshot's name)")
+
+	snapshotPullCmd.Flags().StringP("project-dir", "d", ".", "project root directory")
+	snapshotPullCmd.Flags().String("remote", "", "remote to pull from (default $SMELT_SNAPSHOT_REMOTE)")
+	snapshotPullCmd.Flags().String("as", "", "local name (default: the remote name)")
+	snapshotPullCmd.Flags().Bool("force", false, "overwrite an existing local snapshot with the same name")
 }
 
 func runSnapshotSave(cmd *cobra.Command, args []string) error {
 	projectDir, _ := cmd.Flags().GetString("project-dir")
 	force, _ := cmd.Flags().GetBool("force")
+	chunked, _ := cmd.Flags().GetBool("chunked")
+	live, _ := cmd.Flags().GetBool("live")
 	return snapshot.Save(cmd.Context(), snapshot.SaveOpts{
 		ProjectDir: projectDir,
 		Name:       args[0],
 		Force:      force,
+		Chunked:    chunked,
+		Live:       live,
 	})
 }
 
 func runSnapshotLoad(cmd *cobra.Command, args []string) error {
 	projectDir, _ := cmd.Flags().GetString("project-dir")
+	policy, _ := cmd.Flags().GetString("image-policy")
 	return snapshot.Load(cmd.Context(), snapshot.LoadOpts{
-		ProjectDir: projectDir,
-		NameOrPath: args[0],
+		ProjectDir:  projectDir,
+		NameOrPath:  args[0],
+		ImagePolicy: snapshot.ImagePolicy(policy),
 	})
 }
 
 func runSnapshotList(cmd *cobra.Command, args []string) error {
 	projectDir, _ := cmd.Flags().GetString("project-dir")
+	if remoteURL, _ := cmd.Flags().GetString("remote"); remoteURL != "" {
+		return listRemoteSnapshots(cmd, remoteURL)
+	}
 	snaps, err := snapshot.List(projectDir)
 	if err != nil {
 		return err
@@ -103,22 +347,370 @@ func runSnapshotList(cmd *cobra.Command, args []string) error {
 		return nil
 	}
 	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-	fmt.Fprintln(tw, "NAME\tCREATED\tSIZE\tVOLUMES")
+	fmt.Fprintln(tw, "NAME\tCREATED\tSIZE\tVOLUMES\tPINNED")
 	for _, s := range snaps {
 		age := "-"
 		if !s.CreatedAt.IsZero() {
 			age = humanAge(s.CreatedAt)
 		}
-		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\n", s.Name, age, humanSize(s.SizeBytes), len(s.Volumes))
+		pinned := ""
+		if s.Pinned {
+			pinned = "yes"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\n", s.Name, age, humanSize(s.SizeBytes), len(s.Volumes), pinned)
 	}
 	return tw.Flush()
 }
 
+func runSnapshotRebase(cmd *cobra.Command, args []string) error {
+	projectDir, _ := cmd.Flags().GetString("project-dir")
+	specs, _ := cmd.Flags().GetStringArray("image")
+	as, _ := cmd.Flags().GetString("as")
+	timeout, _ := cmd.Flags().GetDuration("timeout")
+	images := make(map[string]string, len(specs))
+	for _, spec := range specs {
+		key, ref, ok := strings.Cut(spec, "=")
+		if !ok || key == "" {
+			return fmt.Errorf("invalid --image %q (want KEY=REF)", spec)
+		}
+		images[key] = ref
+	}
+	return snapshot.Rebase(cmd.Context(), snapshot.RebaseOpts{
+		ProjectDir:    projectDir,
+		NameOrPath:    args[0],
+		Images:        images,
+		As:            as,
+		HealthTimeout: timeout,
+	})
+}
+
+func runSnapshotBuildMatrix(cmd *cobra.Command, args []string) error {
+	projectDir, _ := cmd.Flags().GetString("project-dir")
+	output, _ := cmd.Flags().GetString("output")
+	only, _ := cmd.Flags().GetStringArray("only")
+	force, _ := cmd.Flags().GetBool("force")
+	chunked, _ := cmd.Flags().GetBool("chunked")
+	timeout, _ := cmd.Flags().GetDuration("timeout")
+	file := filepath.Join(projectDir, snapshot.MatrixFile)
+	if len(args) == 1 {
+		file = args[0]
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	matrix, err := snapshot.ParseMatrix(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", file, err)
+	}
+	entries := matrix.Snapshots
+	if len(only) > 0 {
+		byName := make(map[string]snapshot.MatrixEntry, len(entries))
+		for _, e := range entries {
+			byName[e.Name] = e
+		}
+		entries = nil
+		for _, name := range only {
+			e, ok := byName[name]
+			if !ok {
+				return fmt.Errorf("--only %q: not in %s", name, file)
+			}
+			entries = append(entries, e)
+		}
+	}
+	return snapshot.BuildMatrix(cmd.Context(), snapshot.BuildMatrixOpts{
+		ProjectDir:    projectDir,
+		Entries:       entries,
+		OutputDir:     output,
+		Force:         force,
+		Chunked:       chunked,
+		HealthTimeout: timeout,
+	})
+}
+
+func runSnapshotPrune(cmd *cobra.Command, args []string) error {
+	projectDir, _ := cmd.Flags().GetString("project-dir")
+	keepLast, _ := cmd.Flags().GetInt("keep-last")
+	olderThan, _ := cmd.Flags().GetString("older-than")
+	maxSize, _ := cmd.Flags().GetString("max-total-size")
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+	opts := snapshot.PruneOpts{ProjectDir: projectDir, KeepLast: keepLast, DryRun: dryRun}
+	if olderThan != "" {
+		d, err := parseAge(olderThan)
+		if err != nil {
+			return fmt.Errorf("--older-than: %w", err)
+		}
+		opts.OlderThan = d
+	}
+	if maxSize != "" {
+		n, err := parseSize(maxSize)
+		if err != nil {
+			return fmt.Errorf("--max-total-size: %w", err)
+		}
+		opts.MaxTotalSize = n
+	}
+	res, err := snapshot.Prune(opts)
+	if err != nil {
+		return err
+	}
+
+	verb, total := "Deleted", "Freed"
+	if dryRun {
+		verb, total = "Would delete", "Would free"
+	}
+	if len(res.Removed) == 0 {
+		fmt.Println("nothing to prune")
+	} else {
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(tw, "%s:\n", verb)
+		var freed int64
+		for _, c := range res.Removed {
+			freed += c.FreedBytes
+			fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\n", c.Name, humanAge(c.CreatedAt), humanSize(c.FreedBytes), c.Reason)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+		fmt.Printf("%s %s (%s -> %s)\n", total, humanSize(freed), humanSize(res.TotalBytes), humanSize(res.RemainingBytes))
+	}
+	if res.OverBudget {
+		fmt.Printf("warning: %s still exceeds --max-total-size; the rest is pinned or kept by --keep-last\n",
+			humanSize(res.RemainingBytes))
+	}
+	return nil
+}
+
+func listRemoteSnapshots(cmd *cobra.Command, remoteURL string) error {
+	remote, err := snapshot.OpenRemote(remoteURL)
+	if err != nil {
+		return err
+	}
+	snaps, err := snapshot.ListRemote(cmd.Context(), remote)
+	if err != nil {
+		return err
+	}
+	if len(snaps) == 0 {
+		fmt.Println("no snapshots")
+		return nil
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tCREATED\tVOLUMES")
+	for _, s := range snaps {
+		fmt.Fprintf(tw, "%s\t%s\t%d\n", s.Name, humanAge(s.CreatedAt), len(s.Volumes))
+	}
+	return tw.Flush()
+}
+
+// openRemoteFlag opens the remote named by --remote, falling back to
+// $SMELT_SNAPSHOT_REMOTE.
+func openRemoteFlag(cmd *cobra.Command) (snapshot.Remote, error) {
+	remoteURL, _ := cmd.Flags().GetString("remote")
+	if remoteURL == "" {
+		remoteURL = os.Getenv("SMELT_SNAPSHOT_REMOTE")
+	}
+	if remoteURL == "" {
+		return nil, fmt.Errorf("--remote is required (or set SMELT_SNAPSHOT_REMOTE)")
+	}
+	return snapshot.OpenRemote(remoteURL)
+}
+
+func runSnapshotPush(cmd *cobra.Command, args []string) error {
+	projectDir, _ := cmd.Flags().GetString("project-dir")
+	as, _ := cmd.Flags().GetString("as")
+	remote, err := openRemoteFlag(cmd)
+	if err != nil {
+		return err
+	}
+	stats, err := snapshot.Push(cmd.Context(), snapshot.PushOpts{
+		ProjectDir: projectDir,
+		NameOrPath: args[0],
+		Remote:     remote,
+		As:         as,
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Pushed: %d objects uploaded (%s), %d already in remote\n",
+		stats.Transferred, humanSize(stats.TransferredBytes), stats.Skipped)
+	return nil
+}
+
+func runSnapshotPull(cmd *cobra.Command, args []string) error {
+	projectDir, _ := cmd.Flags().GetString("project-dir")
+	as, _ := cmd.Flags().GetString("as")
+	force, _ := cmd.Flags().GetBool("force")
+	remote, err := openRemoteFlag(cmd)
+	if err != nil {
+		return err
+	}
+	stats, err := snapshot.Pull(cmd.Context(), snapshot.PullOpts{
+		ProjectDir: projectDir,
+		Name:       args[0],
+		Remote:     remote,
+		As:         as,
+		Force:      force,
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Pulled: %d objects downloaded (%s), %d already local\n",
+		stats.Transferred, humanSize(stats.TransferredBytes), stats.Skipped)
+	return nil
+}
+
 func runSnapshotRm(cmd *cobra.Command, args []string) error {
 	projectDir, _ := cmd.Flags().GetString("project-dir")
 	return snapshot.Remove(projectDir, args[0])
 }
 
+func runSnapshotVerify(cmd *cobra.Command, args []string) error {
+	projectDir, _ := cmd.Flags().GetString("project-dir")
+	desc, err := snapshot.Verify(projectDir, args[0])
+	if err != nil {
+		return err
+	}
+	if len(desc.Digests) == 0 {
+		fmt.Printf("%s: OK (no digests recorded; structural check only)\n", desc.Name)
+		return nil
+	}
+	fmt.Printf("%s: OK (%d files match recorded digests)\n", desc.Name, len(desc.Digests))
+	return nil
+}
+
+func runSnapshotRepack(cmd *cobra.Command, args []string) error {
+	projectDir, _ := cmd.Flags().GetString("project-dir")
+	chunked, _ := cmd.Flags().GetBool("chunked")
+	return snapshot.Repack(projectDir, args[0], chunked)
+}
+
+func runSnapshotInspect(cmd *cobra.Command, args []string) error {
+	projectDir, _ := cmd.Flags().GetString("project-dir")
+	in, err := snapshot.Inspect(projectDir, args[0])
+	if err != nil {
+		return err
+	}
+	desc := in.Descriptor
+	fmt.Printf("Name:     %s\n", desc.Name)
+	fmt.Printf("Path:     %s\n", in.Dir)
+	if !desc.CreatedAt.IsZero() {
+		fmt.Printf("Created:  %s (%s)\n", desc.CreatedAt.Format(time.RFC3339), humanAge(desc.CreatedAt))
+	}
+	fmt.Printf("Chain ID: %d\n", in.ChainID)
+
+	fmt.Printf("\nPiri nodes:\n")
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "  NAME\tDB\tBLOB\tIMAGE\tREGISTERED\tDID")
+	for i, n := range in.Nodes {
+		image := n.Image
+		if image == "" {
+			image = "(default)"
+		}
+		did := in.Piri[i].DID
+		if did == "" {
+			did = "-"
+		}
+		fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\t%t\t%s\n",
+			n.Name, n.Storage.DB, n.Storage.Blob, image, in.Piri[i].Registered, did)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if len(desc.Images) > 0 {
+		fmt.Printf("\nImages:\n")
+		tw = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "  SERVICE\tTAG\tDIGEST")
+		for _, svc := range sortedKeys(desc.Images) {
+			img := desc.Images[svc]
+			digest := img.Digest
+			if digest == "" {
+				digest = "-"
+			}
+			fmt.Fprintf(tw, "  %s\t%s\t%s\n", svc, img.Tag, digest)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("\nVolumes:\n")
+	tw = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "  NAME\tFORMAT\tSTORED\tFILES\tDATA")
+	for _, v := range in.Volumes {
+		fmt.Fprintf(tw, "  %s\t%s\t%s\t%d\t%s\n",
+			v.Name, v.Format, humanSize(v.StoredBytes), v.Files, humanSize(v.DataBytes))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Printf("\nContracts:\n")
+	tw = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, name := range sortedKeys(in.Contracts) {
+		fmt.Fprintf(tw, "  %s\t%s\n", name, in.Contracts[name])
+	}
+	return tw.Flush()
+}
+
+func runSnapshotDiff(cmd *cobra.Command, args []string) error {
+	projectDir, _ := cmd.Flags().GetString("project-dir")
+	d, err := snapshot.Diff(projectDir, args[0], args[1])
+	if err != nil {
+		return err
+	}
+	if d.Empty() {
+		fmt.Printf("%s and %s are equivalent\n", args[0], args[1])
+		return nil
+	}
+	fmt.Printf("A: %s\nB: %s\n", args[0], args[1])
+	printSection := func(title string, lines []string) {
+		if len(lines) == 0 {
+			return
+		}
+		fmt.Printf("\n%s:\n", title)
+		for _, l := range lines {
+			fmt.Printf("  %s\n", l)
+		}
+	}
+	printSection("Topology", d.Topology)
+	printSection("Images", d.Images)
+	printSection("Contracts", d.Contracts)
+	if len(d.Volumes) > 0 {
+		fmt.Printf("\nVolumes:\n")
+		for _, v := range d.Volumes {
+			if v.OnlyIn != "" {
+				fmt.Printf("  %s: only in %s\n", v.Name, v.OnlyIn)
+				continue
+			}
+			fmt.Printf("  %s: %d added, %d removed, %d changed\n",
+				v.Name, len(v.Added), len(v.Removed), len(v.Changed))
+			for _, p := range v.Added {
+				fmt.Printf("    + %s\n", p)
+			}
+			for _, p := range v.Removed {
+				fmt.Printf("    - %s\n", p)
+			}
+			for _, p := range v.Changed {
+				fmt.Printf("    ~ %s\n", p)
+			}
+		}
+	}
+	// A difference is a result, not a usage mistake: exit non-zero like
+	// diff(1) without cobra's usage dump.
+	cmd.SilenceUsage = true
+	cmd.SilenceErrors = true
+	return fmt.Errorf("snapshots differ")
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	out := make([]string, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
+
 func humanAge(t time.Time) string {
 	d := time.Since(t)
 	switch {
@@ -133,6 +725,49 @@ func humanAge(t time.Time) string {
 	}
 }
 
+// parseAge is time.ParseDuration plus a "d" suffix for days, the unit
+// snapshot ages are usually thought of in.
+func parseAge(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.ParseFloat(days, 64)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid age %q", s)
+		}
+		return time.Duration(n * float64(24*time.Hour)), nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid age %q", s)
+	}
+	return d, nil
+}
+
+// parseSize reads a byte count like "20GB", "512MiB" or "1048576". KB, MB,
+// GB and TB are decimal; KiB, MiB, GiB and TiB are binary, as humanSize
+// prints them.
+func parseSize(s string) (int64, error) {
+	units := []struct {
+		suffix string
+		mult   float64
+	}{
+		{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30}, {"TiB", 1 << 40},
+		{"KB", 1e3}, {"MB", 1e6}, {"GB", 1e9}, {"TB", 1e12},
+		{"B", 1},
+	}
+	num, mult := strings.TrimSpace(s), 1.0
+	for _, u := range units {
+		if rest, ok := strings.CutSuffix(num, u.suffix); ok {
+			num, mult = strings.TrimSpace(rest), u.mult
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return int64(n * mult), nil
+}
+
 func humanSize(b int64) string {
 	const unit = 1024
 	if b < unit {
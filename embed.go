@@ -9,6 +9,7 @@ import "embed"
 //go:embed compose.yml .env
 
 //go:embed systems/common/compose.yml
+//go:embed systems/common/config/*
 
 //go:embed systems/blockchain/compose.yml
 //go:embed systems/blockchain/state/deployed-addresses.json
@@ -40,6 +41,8 @@ import "embed"
 // (importers of pkg/stack) can call stack.WithEmbeddedSnapshot without
 // knowing anything about smelt's on-disk layout. New directories
 // committed under snapshots/ are automatically included on next build.
+// The all: prefix keeps snapshots/.chunks (the shared chunk store used by
+// chunked snapshots) in the embed; go:embed skips dot-dirs otherwise.
 //
-//go:embed snapshots
+//go:embed all:snapshots
 var EmbeddedFiles embed.FS
@@ -0,0 +1,324 @@
+// Package dockerapi talks to the Docker Engine API directly, so the parts
+// of smelt that touch volumes and containers work wherever a Docker (or
+// Docker-compatible, e.g. Podman) socket is reachable — no `docker` CLI
+// needed. Runtime covers the rest: the CLI for compose and builds.
+package dockerapi
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	cerrdefs "github.com/containerd/errdefs"
+	"github.com/moby/moby/api/pkg/stdcopy"
+	"github.com/moby/moby/api/types/container"
+	"github.com/moby/moby/api/types/mount"
+	"github.com/moby/moby/client"
+	"github.com/testcontainers/testcontainers-go"
+)
+
+// BusyboxImage is the helper image used to read and write volume
+// contents. It's tiny and ubiquitous; RunHelper pulls it on first use.
+const BusyboxImage = "busybox:latest"
+
+var (
+	clientOnce sync.Once
+	sharedCli  *client.Client
+	clientErr  error
+)
+
+// Client returns a process-wide client for the engine testcontainers
+// resolves: DOCKER_HOST, ~/.testcontainers.properties, the current docker
+// context, then the default socket — the same one pkg/stack's compose
+// stacks run on. Under Podman, DOCKER_HOST defaults to its API socket
+// (see Runtime.UseSocket).
+func Client(ctx context.Context) (*client.Client, error) {
+	clientOnce.Do(func() {
+		rt, err := Detect()
+		if err != nil {
+			clientErr = err
+			return
+		}
+		rt.UseSocket()
+		cli, err := testcontainers.NewDockerClientWithOpts(ctx)
+		if err != nil {
+			clientErr = fmt.Errorf("docker client: %w", err)
+			return
+		}
+		sharedCli = cli.Client
+	})
+	return sharedCli, clientErr
+}
+
+// Helper describes a short-lived container RunHelper runs to completion.
+type Helper struct {
+	// Image defaults to BusyboxImage.
+	Image  string
+	Cmd    []string
+	Mounts []mount.Mount
+	// Stdin, if set, is streamed to the container and closed at EOF.
+	Stdin io.Reader
+	// Stdout and Stderr receive the container's output. Nil discards it.
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// RunHelper runs h as root in a throwaway container — the API equivalent
+// of `docker run --rm -i -u 0:0` — and returns an error if it exits
+// non-zero.
+func RunHelper(ctx context.Context, h Helper) error {
+	cli, err := Client(ctx)
+	if err != nil {
+		return err
+	}
+	if h.Image == "" {
+		h.Image = BusyboxImage
+	}
+	if err := ensureImage(ctx, cli, h.Image); err != nil {
+		return err
+	}
+	created, err := cli.ContainerCreate(ctx, client.ContainerCreateOptions{
+		Config: &container.Config{
+			Image:        h.Image,
+			Cmd:          h.Cmd,
+			User:         "0:0",
+			AttachStdin:  h.Stdin != nil,
+			OpenStdin:    h.Stdin != nil,
+			StdinOnce:    h.Stdin != nil,
+			AttachStdout: true,
+			AttachStderr: true,
+		},
+		HostConfig: &container.HostConfig{Mounts: h.Mounts},
+	})
+	if err != nil {
+		return fmt.Errorf("create helper container: %w", err)
+	}
+	defer func() {
+		_, _ = cli.ContainerRemove(context.WithoutCancel(ctx), created.ID, client.ContainerRemoveOptions{Force: true})
+	}()
+
+	attach, err := cli.ContainerAttach(ctx, created.ID, client.ContainerAttachOptions{
+		Stream: true,
+		Stdin:  h.Stdin != nil,
+		Stdout: true,
+		Stderr: true,
+	})
+	if err != nil {
+		return fmt.Errorf("attach helper container: %w", err)
+	}
+	defer attach.Close()
+	// The hijacked connection doesn't watch ctx; close it on cancel so
+	// the stream copies below return.
+	stop := context.AfterFunc(ctx, attach.Close)
+	defer stop()
+
+	// Register the wait before starting so a fast exit isn't missed.
+	wait := cli.ContainerWait(ctx, created.ID, client.ContainerWaitOptions{
+		Condition: container.WaitConditionNextExit,
+	})
+	if _, err := cli.ContainerStart(ctx, created.ID, client.ContainerStartOptions{}); err != nil {
+		return fmt.Errorf("start helper container: %w", err)
+	}
+
+	stdinErr := make(chan error, 1)
+	if h.Stdin != nil {
+		go func() {
+			_, err := io.Copy(attach.Conn, h.Stdin)
+			if cerr := attach.CloseWrite(); err == nil {
+				err = cerr
+			}
+			stdinErr <- err
+		}()
+	} else {
+		stdinErr <- nil
+	}
+
+	stdout, stderr := orDiscard(h.Stdout), orDiscard(h.Stderr)
+	if _, err := stdcopy.StdCopy(stdout, stderr, attach.Reader); err != nil {
+		return fmt.Errorf("read helper output: %w", err)
+	}
+
+	var exit int64
+	select {
+	case res := <-wait.Result:
+		if res.Error != nil {
+			return fmt.Errorf("helper container: %s", res.Error.Message)
+		}
+		exit = res.StatusCode
+	case err := <-wait.Error:
+		return fmt.Errorf("wait for helper container: %w", err)
+	}
+	if exit != 0 {
+		return fmt.Errorf("helper container %v exited with status %d", h.Cmd, exit)
+	}
+	// Checked after the exit status: a failing container breaks the
+	// stdin pipe, and its status is the more useful error.
+	if err := <-stdinErr; err != nil {
+		return fmt.Errorf("stream to helper container: %w", err)
+	}
+	return nil
+}
+
+// Exec describes a command ExecIn runs in an existing container.
+type Exec struct {
+	Cmd []string
+	// User defaults to root.
+	User string
+	// Stdin, if set, is streamed to the command and closed at EOF. It is
+	// read from a goroutine that ExecIn doesn't wait for: no Read starts
+	// after ExecIn returns, but one already blocked stays blocked until
+	// Stdin returns, so callers must let it reach EOF or close it.
+	Stdin io.Reader
+	// Stdout and Stderr receive the command's output. Nil discards it.
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// ExitError reports a command that ran but exited non-zero.
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("command failed with exit code %d", e.Code)
+}
+
+// ExecIn runs e in the container with the given ID — the API equivalent
+// of `docker exec -i` — streaming its input and output. A non-zero exit is
+// an *ExitError.
+func ExecIn(ctx context.Context, containerID string, e Exec) error {
+	cli, err := Client(ctx)
+	if err != nil {
+		return err
+	}
+	if e.User == "" {
+		e.User = "root"
+	}
+	created, err := cli.ExecCreate(ctx, containerID, client.ExecCreateOptions{
+		User:         e.User,
+		Cmd:          e.Cmd,
+		AttachStdin:  e.Stdin != nil,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return fmt.Errorf("create exec: %w", err)
+	}
+	attach, err := cli.ExecAttach(ctx, created.ID, client.ExecAttachOptions{})
+	if err != nil {
+		return fmt.Errorf("attach exec: %w", err)
+	}
+	defer attach.Close()
+	stop := context.AfterFunc(ctx, attach.Close)
+	defer stop()
+
+	stdinErr := make(chan error, 1)
+	if e.Stdin != nil {
+		done := make(chan struct{})
+		defer close(done)
+		go func() {
+			_, err := io.Copy(attach.Conn, &stoppableReader{r: e.Stdin, done: done})
+			if cerr := attach.CloseWrite(); err == nil {
+				err = cerr
+			}
+			stdinErr <- err
+		}()
+	} else {
+		stdinErr <- nil
+	}
+
+	if _, err := stdcopy.StdCopy(orDiscard(e.Stdout), orDiscard(e.Stderr), attach.Reader); err != nil {
+		if ctx.Err() != nil {
+			return context.Cause(ctx)
+		}
+		return fmt.Errorf("read exec output: %w", err)
+	}
+
+	// The output stream can end a moment before the engine records the
+	// exit code.
+	for {
+		inspect, err := cli.ExecInspect(ctx, created.ID, client.ExecInspectOptions{})
+		if err != nil {
+			return fmt.Errorf("inspect exec: %w", err)
+		}
+		if !inspect.Running {
+			if inspect.ExitCode != 0 {
+				return &ExitError{Code: inspect.ExitCode}
+			}
+			break
+		}
+		select {
+		case <-time.After(50 * time.Millisecond):
+		case <-ctx.Done():
+			return context.Cause(ctx)
+		}
+	}
+	// As in RunHelper, a failing command breaks the stdin pipe, so the
+	// exit code is checked first. A command that exits cleanly without
+	// reading all its input isn't held up by it: closing the connection
+	// ends the copy.
+	select {
+	case err := <-stdinErr:
+		if err != nil {
+			return fmt.Errorf("stream to exec: %w", err)
+		}
+	default:
+	}
+	return nil
+}
+
+// stoppableReader ends with EOF once done is closed, so ExecIn's stdin
+// copy stops consuming the caller's reader when ExecIn returns.
+type stoppableReader struct {
+	r    io.Reader
+	done <-chan struct{}
+}
+
+func (s *stoppableReader) Read(p []byte) (int, error) {
+	select {
+	case <-s.done:
+		return 0, io.EOF
+	default:
+		return s.r.Read(p)
+	}
+}
+
+// VolumeExists reports whether a named volume exists.
+func VolumeExists(ctx context.Context, name string) (bool, error) {
+	cli, err := Client(ctx)
+	if err != nil {
+		return false, err
+	}
+	_, err = cli.VolumeInspect(ctx, name, client.VolumeInspectOptions{})
+	if cerrdefs.IsNotFound(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// ensureImage pulls ref unless the engine already has it.
+func ensureImage(ctx context.Context, cli *client.Client, ref string) error {
+	if _, err := cli.ImageInspect(ctx, ref); err == nil {
+		return nil
+	} else if !cerrdefs.IsNotFound(err) {
+		return fmt.Errorf("inspect %s: %w", ref, err)
+	}
+	resp, err := cli.ImagePull(ctx, ref, client.ImagePullOptions{})
+	if err != nil {
+		return fmt.Errorf("pull %s: %w", ref, err)
+	}
+	defer resp.Close()
+	if err := resp.Wait(ctx); err != nil {
+		return fmt.Errorf("pull %s: %w", ref, err)
+	}
+	return nil
+}
+
+func orDiscard(w io.Writer) io.Writer {
+	if w == nil {
+		return io.Discard
+	}
+	return w
+}
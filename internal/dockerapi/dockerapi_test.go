@@ -0,0 +1,25 @@
+package dockerapi
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestStoppableReader(t *testing.T) {
+	done := make(chan struct{})
+	src := strings.NewReader("abcdef")
+	r := &stoppableReader{r: src, done: done}
+
+	buf := make([]byte, 3)
+	if n, err := r.Read(buf); n != 3 || err != nil || string(buf) != "abc" {
+		t.Fatalf("before stop: %d, %v, %q", n, err, buf)
+	}
+	close(done)
+	if n, err := r.Read(buf); n != 0 || err != io.EOF {
+		t.Fatalf("after stop: %d, %v", n, err)
+	}
+	if src.Len() != 3 {
+		t.Errorf("read %d more bytes from the source after stopping", 3-src.Len())
+	}
+}
@@ -0,0 +1,151 @@
+package dockerapi
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/moby/moby/client"
+)
+
+// RuntimeEnv selects the container runtime: "docker" or "podman". Unset,
+// smelt uses docker when it's installed and podman otherwise.
+const RuntimeEnv = "SMELT_CONTAINER_RUNTIME"
+
+// Supported runtimes.
+const (
+	Docker = "docker"
+	Podman = "podman"
+)
+
+// Runtime is the container engine smelt drives. Both speak the Docker
+// Engine API — Podman through its compatibility socket — so the API calls
+// in this package are shared; Runtime covers what differs: the CLI used
+// for compose and image builds, and where the socket lives.
+type Runtime struct {
+	// Name is Docker or Podman, and doubles as the CLI binary.
+	Name string
+}
+
+var (
+	runtimeOnce sync.Once
+	detected    Runtime
+	runtimeErr  error
+)
+
+// Detect returns the runtime named by RuntimeEnv, or the one found on
+// PATH. The result is cached for the life of the process.
+func Detect() (Runtime, error) {
+	runtimeOnce.Do(func() {
+		detected, runtimeErr = detectRuntime(os.Getenv(RuntimeEnv), os.Getenv("DOCKER_HOST"), exec.LookPath)
+	})
+	return detected, runtimeErr
+}
+
+func detectRuntime(env, dockerHost string, lookPath func(string) (string, error)) (Runtime, error) {
+	switch env {
+	case Docker, Podman:
+		return Runtime{Name: env}, nil
+	case "":
+	default:
+		return Runtime{}, fmt.Errorf("%s=%q: want %q or %q", RuntimeEnv, env, Docker, Podman)
+	}
+	// A podman socket in DOCKER_HOST is also what testcontainers keys off.
+	if strings.Contains(dockerHost, "podman.sock") {
+		return Runtime{Name: Podman}, nil
+	}
+	if _, err := lookPath(Docker); err == nil {
+		return Runtime{Name: Docker}, nil
+	}
+	if _, err := lookPath(Podman); err == nil {
+		return Runtime{Name: Podman}, nil
+	}
+	return Runtime{Name: Docker}, nil
+}
+
+// Command returns an exec.Cmd running the runtime's CLI with args.
+func (r Runtime) Command(ctx context.Context, args ...string) *exec.Cmd {
+	return exec.CommandContext(ctx, r.Name, args...)
+}
+
+// UseSocket points DOCKER_HOST at the Podman API socket when Podman is
+// the runtime and DOCKER_HOST is unset, so this package and
+// testcontainers both reach it. Docker needs nothing: testcontainers
+// already finds its default and rootless sockets.
+func (r Runtime) UseSocket() {
+	if r.Name != Podman || os.Getenv("DOCKER_HOST") != "" {
+		return
+	}
+	if sock := podmanSocket(); sock != "" {
+		os.Setenv("DOCKER_HOST", "unix://"+sock)
+	}
+}
+
+// podmanSocket returns the first Podman API socket that exists: the
+// rootless one under $XDG_RUNTIME_DIR, then the rootful one. Start it
+// with `systemctl --user enable --now podman.socket`.
+func podmanSocket() string {
+	var candidates []string
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		candidates = append(candidates, filepath.Join(dir, "podman", "podman.sock"))
+	}
+	candidates = append(candidates, "/run/podman/podman.sock")
+	for _, c := range candidates {
+		if _, err := os.Stat(c); err == nil {
+			return c
+		}
+	}
+	return ""
+}
+
+// HostOwner returns the uid:gid a root helper container must chown files
+// on a bind mount to for the host user to own them. On a rootful engine
+// that's the host user's own ids. On a rootless one (rootless Podman or
+// Docker) container root is already mapped to the host user, while the
+// host ids would land on an unrelated subordinate id — so it's 0:0.
+func HostOwner(ctx context.Context) (string, error) {
+	cli, err := Client(ctx)
+	if err != nil {
+		return "", err
+	}
+	info, err := cli.Info(ctx, client.InfoOptions{})
+	if err != nil {
+		return "", fmt.Errorf("engine info: %w", err)
+	}
+	for _, opt := range info.Info.SecurityOptions {
+		if opt == "name=rootless" {
+			return "0:0", nil
+		}
+	}
+	u, err := user.Current()
+	if err != nil {
+		return "", err
+	}
+	return u.Uid + ":" + u.Gid, nil
+}
+
+// Command runs the detected runtime's CLI with args. An invalid
+// RuntimeEnv surfaces as the command's error when it's run.
+func Command(ctx context.Context, args ...string) *exec.Cmd {
+	rt, err := Detect()
+	if err != nil {
+		cmd := exec.CommandContext(ctx, Docker, args...)
+		cmd.Err = err
+		return cmd
+	}
+	return rt.Command(ctx, args...)
+}
+
+// Compose runs `<runtime> compose args...` in dir. `podman compose` hands
+// off to whichever compose provider is installed (docker-compose or
+// podman-compose); both read the same compose files.
+func Compose(ctx context.Context, dir string, args ...string) *exec.Cmd {
+	cmd := Command(ctx, append([]string{"compose"}, args...)...)
+	cmd.Dir = dir
+	return cmd
+}
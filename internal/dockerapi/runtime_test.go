@@ -0,0 +1,51 @@
+package dockerapi
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDetectRuntime(t *testing.T) {
+	onPath := func(bins ...string) func(string) (string, error) {
+		return func(name string) (string, error) {
+			for _, b := range bins {
+				if b == name {
+					return "/usr/bin/" + name, nil
+				}
+			}
+			return "", errors.New("not found")
+		}
+	}
+	cases := []struct {
+		name       string
+		env        string
+		dockerHost string
+		path       []string
+		want       string
+		wantErr    bool
+	}{
+		{name: "env wins", env: Podman, path: []string{Docker, Podman}, want: Podman},
+		{name: "podman socket", dockerHost: "unix:///run/user/1000/podman/podman.sock", path: []string{Docker}, want: Podman},
+		{name: "docker preferred", path: []string{Docker, Podman}, want: Docker},
+		{name: "podman only", path: []string{Podman}, want: Podman},
+		{name: "neither", want: Docker},
+		{name: "invalid env", env: "containerd", wantErr: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := detectRuntime(tc.env, tc.dockerHost, onPath(tc.path...))
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("want error, got %q", got.Name)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Name != tc.want {
+				t.Errorf("got %q, want %q", got.Name, tc.want)
+			}
+		})
+	}
+}
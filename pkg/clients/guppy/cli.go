@@ -0,0 +1,190 @@
+package guppy
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+)
+
+// DefaultCommandTimeout bounds each guppy invocation a CLIClient makes.
+const DefaultCommandTimeout = 5 * time.Minute
+
+type CLIOption func(*CLIClient)
+
+// WithConfigPath passes --config to every guppy invocation. By default
+// guppy reads its usual config location.
+func WithConfigPath(path string) CLIOption {
+	return func(c *CLIClient) {
+		c.configPath = path
+	}
+}
+
+// WithCommandTimeout overrides DefaultCommandTimeout.
+func WithCommandTimeout(timeout time.Duration) CLIOption {
+	return func(c *CLIClient) {
+		c.timeout = timeout
+	}
+}
+
+// WithCLILoginValidator validates logins while `guppy login` waits, as
+// ContainerClient does. Without one, Login relies on something else
+// clicking the validation link.
+func WithCLILoginValidator(validator LoginValidator) CLIOption {
+	return func(c *CLIClient) {
+		c.validator = validator
+	}
+}
+
+// Compile-time check that CLIClient implements guppy.Client.
+var _ Client = (*CLIClient)(nil)
+
+// CLIClient implements guppy.Client by running a guppy binary on the
+// local machine.
+type CLIClient struct {
+	binaryPath string
+	configPath string
+	timeout    time.Duration
+	validator  LoginValidator
+}
+
+// NewCLIClient returns a client for the guppy binary at binaryPath,
+// looked up on PATH if it has no separators. An empty binaryPath means
+// "guppy".
+func NewCLIClient(binaryPath string, options ...CLIOption) *CLIClient {
+	if binaryPath == "" {
+		binaryPath = "guppy"
+	}
+	c := &CLIClient{
+		binaryPath: binaryPath,
+		timeout:    DefaultCommandTimeout,
+	}
+	for _, option := range options {
+		option(c)
+	}
+	return c
+}
+
+func (c *CLIClient) guppyExec(ctx context.Context, args ...string) (string, string, error) {
+	command := args[0]
+	if c.configPath != "" {
+		args = append([]string{"--config", c.configPath}, args...)
+	}
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	cmd := exec.CommandContext(ctx, c.binaryPath, args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return stdout.String(), stderr.String(), fmt.Errorf("guppy %s: %w\nstdout: %s\nstderr: %s",
+			command, err, stdout.String(), stderr.String())
+	}
+	return stdout.String(), stderr.String(), nil
+}
+
+// Login logs in with the given email.
+func (c *CLIClient) Login(ctx context.Context, email string, options ...LoginOption) error {
+	return login(ctx, c.guppyExec, c.validator, email, options...)
+}
+
+// Whoami returns the DID of the client's agent.
+func (c *CLIClient) Whoami(ctx context.Context) (string, error) {
+	return whoami(ctx, c.guppyExec)
+}
+
+// CheckJSONOutput checks that the guppy binary prints the --json records
+// this package decodes, by running `whoami --json`. An older guppy still
+// works for the commands with a text fallback but not for the rest, so
+// run this once up front to fail early rather than mid-run.
+func (c *CLIClient) CheckJSONOutput(ctx context.Context) error {
+	return checkJSONOutput(ctx, c.guppyExec)
+}
+
+// GenerateSpace creates a new space.
+func (c *CLIClient) GenerateSpace(ctx context.Context, options ...SpaceOption) (Space, error) {
+	return generateSpace(ctx, c.guppyExec, options...)
+}
+
+// AddSource adds a source directory to a space.
+func (c *CLIClient) AddSource(ctx context.Context, spaceDID, path string) error {
+	return addSource(ctx, c.guppyExec, spaceDID, path)
+}
+
+// Upload uploads all sources in a space.
+func (c *CLIClient) Upload(ctx context.Context, spaceDID string, options ...UploadOption) (UploadResult, error) {
+	return upload(ctx, c.guppyExec, spaceDID, options...)
+}
+
+// Retrieve downloads content by CID to a destination path.
+func (c *CLIClient) Retrieve(ctx context.Context, spaceDID, cid, destPath string) (RetrieveResult, error) {
+	return retrieve(ctx, c.guppyExec, spaceDID, cid, destPath)
+}
+
+// Verify verifies the integrity of a DAG by its root CID.
+func (c *CLIClient) Verify(ctx context.Context, cid string) error {
+	return verify(ctx, c.guppyExec, cid)
+}
+
+// ListSpaces lists the spaces the client has access to.
+func (c *CLIClient) ListSpaces(ctx context.Context) ([]Space, error) {
+	return listSpaces(ctx, c.guppyExec)
+}
+
+// SpaceInfo describes a space, including its providers.
+func (c *CLIClient) SpaceInfo(ctx context.Context, spaceDID string) (SpaceInfo, error) {
+	return spaceInfo(ctx, c.guppyExec, spaceDID)
+}
+
+// ProvisionSpace provisions a space to an account.
+func (c *CLIClient) ProvisionSpace(ctx context.Context, spaceDID, account string) error {
+	return provisionSpace(ctx, c.guppyExec, spaceDID, account)
+}
+
+// CreateDelegation delegates access to a space to audience.
+func (c *CLIClient) CreateDelegation(ctx context.Context, spaceDID, audience string, options ...DelegationOption) (Delegation, error) {
+	return createDelegation(ctx, c.guppyExec, spaceDID, audience, options...)
+}
+
+// ImportDelegation adds a delegation made out to this client.
+func (c *CLIClient) ImportDelegation(ctx context.Context, delegation Delegation) error {
+	return importDelegation(ctx, c.guppyExec, delegation)
+}
+
+// UsageReport reports a space's storage usage, one entry per provider.
+func (c *CLIClient) UsageReport(ctx context.Context, spaceDID string) ([]UsageReport, error) {
+	return usageReport(ctx, c.guppyExec, spaceDID)
+}
+
+// ListUploads lists the uploads registered in a space.
+func (c *CLIClient) ListUploads(ctx context.Context, spaceDID string) ([]UploadInfo, error) {
+	return listUploads(ctx, c.guppyExec, spaceDID)
+}
+
+// RemoveUpload removes an upload from a space by its root CID.
+func (c *CLIClient) RemoveUpload(ctx context.Context, spaceDID, root string) error {
+	return removeUpload(ctx, c.guppyExec, spaceDID, root)
+}
+
+// ListBlobs lists the blobs stored in a space.
+func (c *CLIClient) ListBlobs(ctx context.Context, spaceDID string) ([]Blob, error) {
+	return listBlobs(ctx, c.guppyExec, spaceDID)
+}
+
+// GenerateTestData creates random test data with a local randdir binary.
+// Returns the path to the generated data directory.
+func (c *CLIClient) GenerateTestData(ctx context.Context, size string) (string, error) {
+	path := filepath.Join(os.TempDir(), fmt.Sprintf("testdata-%d", time.Now().UnixNano()))
+	out, err := exec.CommandContext(ctx, "randdir", "--size", size, "--output", path).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("generate test data: %w: %s", err, out)
+	}
+	return path, nil
+}
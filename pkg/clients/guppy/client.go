@@ -1,8 +1,18 @@
 // Package guppy provides a client interface for interacting with the guppy CLI.
+//
+// Client has two backends: ContainerClient runs guppy inside a stack's
+// guppy container, and CLIClient runs a guppy binary on the local
+// machine, as the stress tester does inside its own container.
+//
+// An in-process backend, linking the guppy Go library and talking to the
+// stack's upload and indexer services directly, is deferred until
+// github.com/storacha/guppy is a dependency of this module.
 package guppy
 
 import (
 	"context"
+	"fmt"
+	"strings"
 	"time"
 )
 
@@ -30,22 +40,98 @@ func WithReplicas(replicas int) UploadOption {
 	}
 }
 
+type spaceConfig struct {
+	provisionTo string
+}
+
+type SpaceOption func(*spaceConfig)
+
+// WithProvisionTo provisions the new space to the given account DID (see
+// EmailToDIDMailto) as it's created.
+func WithProvisionTo(account string) SpaceOption {
+	return func(c *spaceConfig) {
+		c.provisionTo = account
+	}
+}
+
+type delegationConfig struct {
+	abilities []string
+}
+
+type DelegationOption func(*delegationConfig)
+
+// WithAbilities limits a delegation to the given abilities, e.g.
+// "space/blob/add" or "upload/*". By default it grants everything ("*").
+func WithAbilities(abilities ...string) DelegationOption {
+	return func(c *delegationConfig) {
+		c.abilities = abilities
+	}
+}
+
+// EmailToDIDMailto converts an email to did:mailto format
+// e.g., "user@example.com" -> "did:mailto:example.com:user"
+func EmailToDIDMailto(email string) string {
+	parts := strings.SplitN(email, "@", 2)
+	if len(parts) != 2 {
+		return email // Return as-is if not a valid email
+	}
+	return fmt.Sprintf("did:mailto:%s:%s", parts[1], parts[0])
+}
+
 // Client defines the interface for interacting with guppy.
 type Client interface {
 	// Login logs in with the given email.
 	Login(ctx context.Context, email string, options ...LoginOption) error
 
-	// GenerateSpace creates a new space and returns its DID.
-	GenerateSpace(ctx context.Context) (spaceDID string, err error)
+	// Whoami returns the DID of the client's agent, the audience to
+	// delegate to when sharing a space with it.
+	Whoami(ctx context.Context) (agentDID string, err error)
+
+	// GenerateSpace creates a new space.
+	GenerateSpace(ctx context.Context, options ...SpaceOption) (Space, error)
 
 	// AddSource adds a source directory to a space.
 	AddSource(ctx context.Context, spaceDID, path string) error
 
-	// Upload uploads all sources in a space and returns the CIDs.
-	Upload(ctx context.Context, spaceDID string, options ...UploadOption) (cids []string, err error)
+	// Upload uploads all sources in a space and reports, per source, the
+	// root CID, shards, size and replicas placed.
+	Upload(ctx context.Context, spaceDID string, options ...UploadOption) (UploadResult, error)
 
 	// Retrieve downloads content by CID to a destination path.
-	Retrieve(ctx context.Context, spaceDID, cid, destPath string) error
+	Retrieve(ctx context.Context, spaceDID, cid, destPath string) (RetrieveResult, error)
+
+	// Verify verifies the integrity of a DAG by its root CID.
+	Verify(ctx context.Context, cid string) error
+
+	// ListSpaces lists the spaces the client has access to.
+	ListSpaces(ctx context.Context) ([]Space, error)
+
+	// SpaceInfo describes a space, including its providers.
+	SpaceInfo(ctx context.Context, spaceDID string) (SpaceInfo, error)
+
+	// ProvisionSpace provisions a space to an account (see
+	// EmailToDIDMailto) so it can store data.
+	ProvisionSpace(ctx context.Context, spaceDID, account string) error
+
+	// CreateDelegation delegates access to a space to audience, an agent
+	// or account DID.
+	CreateDelegation(ctx context.Context, spaceDID, audience string, options ...DelegationOption) (Delegation, error)
+
+	// ImportDelegation adds a delegation created for this client's agent
+	// or account, giving it access to the delegated space.
+	ImportDelegation(ctx context.Context, delegation Delegation) error
+
+	// UsageReport reports a space's storage usage, one entry per provider.
+	UsageReport(ctx context.Context, spaceDID string) ([]UsageReport, error)
+
+	// ListUploads lists the uploads registered in a space.
+	ListUploads(ctx context.Context, spaceDID string) ([]UploadInfo, error)
+
+	// RemoveUpload removes an upload from a space by its root CID.
+	RemoveUpload(ctx context.Context, spaceDID, root string) error
+
+	// ListBlobs lists the blobs stored in a space.
+	ListBlobs(ctx context.Context, spaceDID string) ([]Blob, error)
 
 	// GenerateTestData creates random test data and returns the path.
 	// This is useful for testing - it uses randdir to create test files.
@@ -0,0 +1,270 @@
+package guppy
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/sync/errgroup"
+)
+
+var errAlreadyLoggedIn = fmt.Errorf("already logged in")
+
+// runFunc runs the guppy CLI with args, wherever the backend finds it, and
+// returns its output. A non-zero exit is an error.
+type runFunc func(ctx context.Context, args ...string) (stdout, stderr string, err error)
+
+// The functions below implement the Client methods in terms of guppy CLI
+// invocations, so every CLI-driven backend behaves the same and only
+// differs in how it runs the binary.
+
+func login(ctx context.Context, run runFunc, validator LoginValidator, email string, options ...LoginOption) error {
+	config := &loginConfig{}
+	for _, option := range options {
+		option(config)
+	}
+	if config.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, config.timeout)
+		defer cancel()
+	}
+
+	g, ctx := errgroup.WithContext(ctx)
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	g.Go(func() error {
+		stdout, stderr, err := run(ctx, "login", email)
+		if err != nil {
+			return err
+		}
+		out := stdout + stderr
+		if strings.Contains(out, "already logged in") {
+			// cancel trying to validate the email - no email is being sent
+			cancel(errAlreadyLoggedIn)
+			return nil
+		}
+		if !strings.Contains(out, "Successfully logged in") {
+			return fmt.Errorf("login may have failed, output: %s", out)
+		}
+		return nil
+	})
+
+	if validator != nil {
+		g.Go(func() error {
+			err := validator.ValidateEmailLogin(ctx, email)
+			if err != nil {
+				if !errors.Is(context.Cause(ctx), errAlreadyLoggedIn) {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+
+	return g.Wait()
+}
+
+func whoami(ctx context.Context, run runFunc) (string, error) {
+	stdout, _, err := run(ctx, "whoami", jsonFlag)
+	if err != nil {
+		return "", err
+	}
+	agent, err := parseAgent(stdout)
+	if err != nil {
+		return "", fmt.Errorf("whoami: %w", err)
+	}
+	return agent, nil
+}
+
+func checkJSONOutput(ctx context.Context, run runFunc) error {
+	stdout, _, err := run(ctx, "whoami", jsonFlag)
+	if err != nil {
+		return fmt.Errorf("whoami %s: %w", jsonFlag, err)
+	}
+	type agent struct {
+		DID string `json:"did"`
+	}
+	agents, err := decodeRecords("whoami", stdout, func(a agent) bool { return a.DID != "" })
+	if err != nil {
+		return err
+	}
+	if len(agents) == 0 {
+		return fmt.Errorf("whoami %s printed no agent record: %s", jsonFlag, stdout)
+	}
+	return nil
+}
+
+func generateSpace(ctx context.Context, run runFunc, options ...SpaceOption) (Space, error) {
+	config := &spaceConfig{}
+	for _, option := range options {
+		option(config)
+	}
+
+	args := []string{"space", "generate", jsonFlag}
+	if config.provisionTo != "" {
+		args = append(args, "--provision-to", config.provisionTo)
+	}
+	stdout, _, err := run(ctx, args...)
+	if err != nil {
+		return Space{}, err
+	}
+	space, err := parseSpace(stdout)
+	if err != nil {
+		return Space{}, fmt.Errorf("space generate: %w", err)
+	}
+	return space, nil
+}
+
+func addSource(ctx context.Context, run runFunc, spaceDID, path string) error {
+	_, _, err := run(ctx, "upload", "source", "add", spaceDID, path)
+	return err
+}
+
+func upload(ctx context.Context, run runFunc, spaceDID string, options ...UploadOption) (UploadResult, error) {
+	config := &uploadConfig{}
+	for _, option := range options {
+		option(config)
+	}
+
+	args := []string{"upload", jsonFlag}
+	if config.replicas > 0 {
+		args = append(args, "--replicas", fmt.Sprintf("%d", config.replicas))
+	}
+	args = append(args, spaceDID)
+
+	stdout, _, err := run(ctx, args...)
+	if err != nil {
+		return UploadResult{}, err
+	}
+	result, err := parseUpload(stdout)
+	if err != nil {
+		return UploadResult{}, fmt.Errorf("upload: %w", err)
+	}
+	return result, nil
+}
+
+func retrieve(ctx context.Context, run runFunc, spaceDID, cid, destPath string) (RetrieveResult, error) {
+	stdout, _, err := run(ctx, "retrieve", jsonFlag, spaceDID, cid, destPath)
+	if err != nil {
+		return RetrieveResult{}, err
+	}
+	result, err := parseRetrieve(stdout)
+	if isNotJSON(err) {
+		// A guppy without --json prints nothing worth parsing, but it
+		// exited cleanly, so the content is at destPath.
+		result, err = RetrieveResult{CID: cid, Path: destPath}, nil
+	}
+	if err != nil {
+		return RetrieveResult{}, fmt.Errorf("retrieve: %w", err)
+	}
+	return result, nil
+}
+
+func verify(ctx context.Context, run runFunc, cid string) error {
+	_, _, err := run(ctx, "verify", cid)
+	return err
+}
+
+func listSpaces(ctx context.Context, run runFunc) ([]Space, error) {
+	stdout, _, err := run(ctx, "space", "ls", jsonFlag)
+	if err != nil {
+		return nil, err
+	}
+	spaces, err := decodeRecords("space ls", stdout, func(s Space) bool { return s.DID != "" })
+	if err != nil {
+		return nil, fmt.Errorf("space ls: %w", err)
+	}
+	return spaces, nil
+}
+
+func spaceInfo(ctx context.Context, run runFunc, spaceDID string) (SpaceInfo, error) {
+	stdout, _, err := run(ctx, "space", "info", jsonFlag, spaceDID)
+	if err != nil {
+		return SpaceInfo{}, err
+	}
+	info, err := parseOne("space info", stdout, "space", func(s SpaceInfo) bool { return s.DID != "" })
+	if err != nil {
+		return SpaceInfo{}, fmt.Errorf("space info: %w", err)
+	}
+	return info, nil
+}
+
+func provisionSpace(ctx context.Context, run runFunc, spaceDID, account string) error {
+	_, _, err := run(ctx, "space", "provision", "--customer", account, spaceDID)
+	return err
+}
+
+func createDelegation(ctx context.Context, run runFunc, spaceDID, audience string, options ...DelegationOption) (Delegation, error) {
+	config := &delegationConfig{abilities: []string{"*"}}
+	for _, option := range options {
+		option(config)
+	}
+
+	args := []string{"delegation", "create", jsonFlag, "--space", spaceDID}
+	for _, ability := range config.abilities {
+		args = append(args, "--can", ability)
+	}
+	args = append(args, audience)
+
+	stdout, _, err := run(ctx, args...)
+	if err != nil {
+		return Delegation{}, err
+	}
+	d, err := parseOne("delegation create", stdout, "delegation", func(d Delegation) bool { return d.CID != "" })
+	if err != nil {
+		return Delegation{}, fmt.Errorf("delegation create: %w", err)
+	}
+	if len(d.Data) == 0 {
+		return Delegation{}, fmt.Errorf("delegation create: delegation %s has no data", d.CID)
+	}
+	return d, nil
+}
+
+func importDelegation(ctx context.Context, run runFunc, d Delegation) error {
+	_, _, err := run(ctx, "delegation", "import", base64.StdEncoding.EncodeToString(d.Data))
+	return err
+}
+
+func usageReport(ctx context.Context, run runFunc, spaceDID string) ([]UsageReport, error) {
+	stdout, _, err := run(ctx, "usage", "report", jsonFlag, spaceDID)
+	if err != nil {
+		return nil, err
+	}
+	reports, err := decodeRecords("usage report", stdout, func(r UsageReport) bool { return r.Provider != "" })
+	if err != nil {
+		return nil, fmt.Errorf("usage report: %w", err)
+	}
+	return reports, nil
+}
+
+func listUploads(ctx context.Context, run runFunc, spaceDID string) ([]UploadInfo, error) {
+	stdout, _, err := run(ctx, "upload", "ls", jsonFlag, spaceDID)
+	if err != nil {
+		return nil, err
+	}
+	uploads, err := decodeRecords("upload ls", stdout, func(u UploadInfo) bool { return u.Root != "" })
+	if err != nil {
+		return nil, fmt.Errorf("upload ls: %w", err)
+	}
+	return uploads, nil
+}
+
+func removeUpload(ctx context.Context, run runFunc, spaceDID, root string) error {
+	_, _, err := run(ctx, "upload", "rm", spaceDID, root)
+	return err
+}
+
+func listBlobs(ctx context.Context, run runFunc, spaceDID string) ([]Blob, error) {
+	stdout, _, err := run(ctx, "blob", "ls", jsonFlag, spaceDID)
+	if err != nil {
+		return nil, err
+	}
+	blobs, err := decodeRecords("blob ls", stdout, func(b Blob) bool { return b.Digest != "" })
+	if err != nil {
+		return nil, fmt.Errorf("blob ls: %w", err)
+	}
+	return blobs, nil
+}
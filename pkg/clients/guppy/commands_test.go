@@ -0,0 +1,205 @@
+package guppy
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+)
+
+type validatorFunc func(ctx context.Context, email string) error
+
+func (f validatorFunc) ValidateEmailLogin(ctx context.Context, email string) error {
+	return f(ctx, email)
+}
+
+func TestLogin(t *testing.T) {
+	ctx := t.Context()
+	output := func(out string) runFunc {
+		return func(ctx context.Context, args ...string) (string, string, error) {
+			return out, "", nil
+		}
+	}
+	// Waits for an email that never comes unless login cancels it.
+	waiting := validatorFunc(func(ctx context.Context, email string) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	if err := login(ctx, output("You are already logged in"), waiting, "a@b.c"); err != nil {
+		t.Errorf("already logged in: %v", err)
+	}
+	if err := login(ctx, output("Successfully logged in as a@b.c"), nil, "a@b.c"); err != nil {
+		t.Errorf("no validator: %v", err)
+	}
+	if err := login(ctx, output("something else"), nil, "a@b.c"); err == nil {
+		t.Error("want error for unrecognised output")
+	}
+
+	clicked := validatorFunc(func(ctx context.Context, email string) error {
+		if email != "a@b.c" {
+			return errors.New("wrong email")
+		}
+		return nil
+	})
+	if err := login(ctx, output("Successfully logged in"), clicked, "a@b.c"); err != nil {
+		t.Errorf("validated login: %v", err)
+	}
+}
+
+func TestCommandArgs(t *testing.T) {
+	ctx := t.Context()
+	root := testCID(t, cid.DagProtobuf, "a")
+	var got []string
+	run := func(out string) runFunc {
+		return func(ctx context.Context, args ...string) (string, string, error) {
+			got = args
+			return out, "", nil
+		}
+	}
+
+	if _, err := generateSpace(ctx, run(`{"did":"did:key:z6MkhaXgBZDvotDkL5257faiztiGiC2QtKLGpbnnEGta2doK"}`),
+		WithProvisionTo(EmailToDIDMailto("a@b.c"))); err != nil {
+		t.Fatal(err)
+	}
+	if want := "space generate --json --provision-to did:mailto:b.c:a"; strings.Join(got, " ") != want {
+		t.Errorf("space generate args = %q, want %q", strings.Join(got, " "), want)
+	}
+
+	if _, err := upload(ctx, run(`{"source":"/d","root":"`+root+`"}`), "did:key:space", WithReplicas(2)); err != nil {
+		t.Fatal(err)
+	}
+	if want := "upload --json --replicas 2 did:key:space"; strings.Join(got, " ") != want {
+		t.Errorf("upload args = %q, want %q", strings.Join(got, " "), want)
+	}
+}
+
+func TestCLIClient(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a shell script as the guppy binary")
+	}
+	// A stand-in guppy that records its arguments and answers like the
+	// real one.
+	dir := t.TempDir()
+	argsFile := filepath.Join(dir, "args")
+	bin := filepath.Join(dir, "guppy")
+	script := "#!/bin/sh\necho \"$@\" > " + argsFile + "\n" +
+		`echo 'generating...'` + "\n" +
+		`echo '{"did":"did:key:z6MkhaXgBZDvotDkL5257faiztiGiC2QtKLGpbnnEGta2doK"}'` + "\n"
+	if err := os.WriteFile(bin, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewCLIClient(bin, WithConfigPath("/etc/guppy.toml"))
+	space, err := c.GenerateSpace(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(space.DID, "did:key:") {
+		t.Errorf("space = %+v", space)
+	}
+	args, err := os.ReadFile(argsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "--config /etc/guppy.toml space generate --json\n"; string(args) != want {
+		t.Errorf("args = %q, want %q", args, want)
+	}
+
+	if err := NewCLIClient(filepath.Join(dir, "missing")).Verify(t.Context(), "bafy"); err == nil {
+		t.Error("want error for a missing binary")
+	}
+}
+
+func TestSpaceCommands(t *testing.T) {
+	ctx := t.Context()
+	root := testCID(t, cid.DagProtobuf, "a")
+	const space = "did:key:z6MkhaXgBZDvotDkL5257faiztiGiC2QtKLGpbnnEGta2doK"
+
+	// Canned output per command, with the noise real runs produce.
+	outputs := map[string]string{
+		"space ls --json": `{"did":"` + space + `","name":"one"}` + "\n" + `{"did":"did:key:z6Mkother"}`,
+		"space info --json " + space: "fetching...\n" +
+			`{"did":"` + space + `","providers":["did:web:upload"]}`,
+		"delegation create --json --space " + space + " --can upload/* --can blob/* did:key:z6Mkaud": `{"cid":"` + root + `","data":"AQID"}`,
+		"usage report --json " + space: `{"space":"` + space + `","provider":"did:web:upload","bytes":2048}`,
+		"upload ls --json " + space:    `{"root":"` + root + `","shards":[]}` + "\nmentions " + root,
+		"blob ls --json " + space:      `{"digest":"zQmblob","size":10}`,
+	}
+	var calls []string
+	run := func(ctx context.Context, args ...string) (string, string, error) {
+		cmd := strings.Join(args, " ")
+		calls = append(calls, cmd)
+		return outputs[cmd], "", nil
+	}
+
+	spaces, err := listSpaces(ctx, run)
+	if err != nil || len(spaces) != 2 || spaces[0].Name != "one" {
+		t.Errorf("listSpaces = %+v, %v", spaces, err)
+	}
+	info, err := spaceInfo(ctx, run, space)
+	if err != nil || len(info.Providers) != 1 {
+		t.Errorf("spaceInfo = %+v, %v", info, err)
+	}
+	d, err := createDelegation(ctx, run, space, "did:key:z6Mkaud", WithAbilities("upload/*", "blob/*"))
+	if err != nil || d.CID != root || string(d.Data) != "\x01\x02\x03" {
+		t.Errorf("createDelegation = %+v, %v", d, err)
+	}
+	if err := importDelegation(ctx, run, d); err != nil {
+		t.Fatal(err)
+	}
+	if got := calls[len(calls)-1]; got != "delegation import AQID" {
+		t.Errorf("import args = %q", got)
+	}
+	reports, err := usageReport(ctx, run, space)
+	if err != nil || len(reports) != 1 || reports[0].Bytes != 2048 {
+		t.Errorf("usageReport = %+v, %v", reports, err)
+	}
+	uploads, err := listUploads(ctx, run, space)
+	if err != nil || len(uploads) != 1 || uploads[0].Root != root {
+		t.Errorf("listUploads = %+v, %v", uploads, err)
+	}
+	if err := removeUpload(ctx, run, space, root); err != nil {
+		t.Fatal(err)
+	}
+	if got := calls[len(calls)-1]; got != "upload rm "+space+" "+root {
+		t.Errorf("remove args = %q", got)
+	}
+	blobs, err := listBlobs(ctx, run, space)
+	if err != nil || len(blobs) != 1 || blobs[0].Size != 10 {
+		t.Errorf("listBlobs = %+v, %v", blobs, err)
+	}
+
+	// An empty list is a result, not an error.
+	if uploads, err := listUploads(ctx, run, "did:key:z6Mkempty"); err != nil || len(uploads) != 0 {
+		t.Errorf("empty listUploads = %+v, %v", uploads, err)
+	}
+}
+
+func TestCheckJSONOutput(t *testing.T) {
+	const agent = "did:key:z6MkhaXgBZDvotDkL5257faiztiGiC2QtKLGpbnnEGta2doK"
+	output := func(out string) runFunc {
+		return func(ctx context.Context, args ...string) (string, string, error) {
+			if strings.Join(args, " ") != "whoami --json" {
+				t.Errorf("args = %v", args)
+			}
+			return out, "", nil
+		}
+	}
+	if err := checkJSONOutput(t.Context(), output(`{"did":"`+agent+`"}`+"\n")); err != nil {
+		t.Errorf("JSON guppy: %v", err)
+	}
+	// Whoami itself falls back to the text, but the check must not.
+	var notJSON *NotJSONError
+	if err := checkJSONOutput(t.Context(), output(agent+"\n")); !errors.As(err, &notJSON) {
+		t.Errorf("text guppy: want *NotJSONError, got %v", err)
+	}
+	if err := checkJSONOutput(t.Context(), output("")); err == nil {
+		t.Error("no output: want error")
+	}
+}
@@ -0,0 +1,89 @@
+package guppy
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// compareTrees reports the first difference between two files or
+// directory trees: a missing or extra entry, a file where a directory
+// should be, or differing file contents.
+func compareTrees(want, got string) error {
+	err := filepath.WalkDir(want, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(want, p)
+		if err != nil {
+			return err
+		}
+		info, err := os.Stat(filepath.Join(got, rel))
+		if err != nil {
+			return fmt.Errorf("%s: %w", rel, err)
+		}
+		if d.IsDir() != info.IsDir() {
+			return fmt.Errorf("%s: directory in one tree, file in the other", rel)
+		}
+		if d.IsDir() {
+			return nil
+		}
+		return compareFiles(p, filepath.Join(got, rel))
+	})
+	if err != nil {
+		return err
+	}
+	// Everything in want is in got; make sure got has nothing more.
+	return filepath.WalkDir(got, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(got, p)
+		if err != nil {
+			return err
+		}
+		if _, err := os.Stat(filepath.Join(want, rel)); err != nil {
+			return fmt.Errorf("%s: unexpected extra entry", rel)
+		}
+		return nil
+	})
+}
+
+func compareFiles(want, got string) error {
+	wf, err := os.Open(want)
+	if err != nil {
+		return err
+	}
+	defer wf.Close()
+	gf, err := os.Open(got)
+	if err != nil {
+		return err
+	}
+	defer gf.Close()
+
+	wb, gb := make([]byte, 64*1024), make([]byte, 64*1024)
+	var off int64
+	for {
+		wn, werr := io.ReadFull(wf, wb)
+		gn, gerr := io.ReadFull(gf, gb)
+		if !bytes.Equal(wb[:wn], gb[:gn]) {
+			return fmt.Errorf("%s: contents differ within bytes %d-%d", filepath.Base(want), off, off+int64(max(wn, gn)))
+		}
+		off += int64(wn)
+		wdone := errors.Is(werr, io.EOF) || errors.Is(werr, io.ErrUnexpectedEOF)
+		gdone := errors.Is(gerr, io.EOF) || errors.Is(gerr, io.ErrUnexpectedEOF)
+		if werr != nil && !wdone {
+			return werr
+		}
+		if gerr != nil && !gdone {
+			return gerr
+		}
+		if wdone || gdone {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package guppy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCompareTrees(t *testing.T) {
+	write := func(root string, files map[string]string) string {
+		t.Helper()
+		for name, data := range files {
+			p := filepath.Join(root, name)
+			if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(p, []byte(data), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return root
+	}
+	big := string(make([]byte, 200*1024))
+	orig := map[string]string{"a": "alpha", "d/b": "beta", "d/big": big}
+	want := write(t.TempDir(), orig)
+
+	if err := compareTrees(want, write(t.TempDir(), orig)); err != nil {
+		t.Errorf("identical trees: %v", err)
+	}
+	if err := compareTrees(filepath.Join(want, "a"), filepath.Join(want, "a")); err != nil {
+		t.Errorf("identical files: %v", err)
+	}
+
+	diffs := map[string]map[string]string{
+		"changed":   {"a": "alphA", "d/b": "beta", "d/big": big},
+		"truncated": {"a": "alpha", "d/b": "beta", "d/big": big[1:]},
+		"missing":   {"a": "alpha", "d/big": big},
+		"extra":     {"a": "alpha", "d/b": "beta", "d/big": big, "c": ""},
+		"file/dir":  {"a/x": "alpha", "d/b": "beta", "d/big": big},
+	}
+	for name, files := range diffs {
+		if err := compareTrees(want, write(t.TempDir(), files)); err == nil {
+			t.Errorf("%s: want error", name)
+		}
+	}
+}
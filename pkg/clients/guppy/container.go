@@ -2,18 +2,22 @@ package guppy
 
 import (
 	"context"
-	"errors"
 	"fmt"
-	"regexp"
-	"strings"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
-
-	"github.com/storacha/smelt/pkg/stack"
-	"golang.org/x/sync/errgroup"
 )
 
-var errAlreadyLoggedIn = fmt.Errorf("already logged in")
+// Stack is the part of a *stack.Stack that ContainerClient drives. Taking
+// an interface keeps this package free of pkg/stack and its container
+// dependencies, so programs that only need CLIClient can use it too.
+type Stack interface {
+	Execer
+	CopyTo(ctx context.Context, service, hostPath, containerPath string) error
+	CopyFrom(ctx context.Context, service, containerPath, hostPath string) error
+	EmailEndpoint() string
+}
 
 type LoginValidator interface {
 	// ValidateEmailLogin waits for a validation email to be sent to the given
@@ -35,11 +39,13 @@ var _ Client = (*ContainerClient)(nil)
 
 // ContainerClient implements guppy.Client by executing commands inside the guppy container.
 type ContainerClient struct {
-	stack     *stack.Stack
+	stack     Stack
 	validator LoginValidator
+	// home, if set, is the HOME guppy runs with; see NewIdentityClient.
+	home string
 }
 
-func MustNewContainerClient(t *testing.T, stack *stack.Stack, options ...Option) *ContainerClient {
+func MustNewContainerClient(t *testing.T, stack Stack, options ...Option) *ContainerClient {
 	c, err := NewContainerClient(stack, options...)
 	if err != nil {
 		t.Fatalf("failed to create guppy client: %v", err)
@@ -47,7 +53,7 @@ func MustNewContainerClient(t *testing.T, stack *stack.Stack, options ...Option)
 	return c
 }
 
-func NewContainerClient(stack *stack.Stack, options ...Option) (*ContainerClient, error) {
+func NewContainerClient(stack Stack, options ...Option) (*ContainerClient, error) {
 	c := &ContainerClient{
 		stack: stack,
 	}
@@ -78,101 +84,138 @@ func (c *ContainerClient) exec(ctx context.Context, args ...string) (stdout, std
 
 func (c *ContainerClient) guppyExec(ctx context.Context, args ...string) (stdout, stderr string, err error) {
 	args = append([]string{"guppy"}, args...)
+	if c.home != "" {
+		args = append([]string{"env", "HOME=" + c.home}, args...)
+	}
 	return c.exec(ctx, args...)
 }
 
 // Login logs in with the given email.
 func (c *ContainerClient) Login(ctx context.Context, email string, options ...LoginOption) error {
-	config := &loginConfig{}
-	for _, option := range options {
-		option(config)
-	}
-	if config.timeout > 0 {
-		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, config.timeout)
-		defer cancel()
-	}
+	return login(ctx, c.guppyExec, c.validator, email, options...)
+}
 
-	g, ctx := errgroup.WithContext(ctx)
-	ctx, cancel := context.WithCancelCause(ctx)
+// Whoami returns the DID of the client's agent.
+func (c *ContainerClient) Whoami(ctx context.Context) (string, error) {
+	return whoami(ctx, c.guppyExec)
+}
 
-	g.Go(func() error {
-		stdout, _, err := c.guppyExec(ctx, "login", email)
-		if err != nil {
-			return err
-		}
-		if strings.Contains(stdout, "already logged in") {
-			// cancel trying to validate the email - no email is being sent
-			cancel(errAlreadyLoggedIn)
-			return nil
-		}
-		if !strings.Contains(stdout, "Successfully logged in") {
-			return fmt.Errorf("login may have failed, output: %s", stdout)
-		}
-		return nil
-	})
+// CheckJSONOutput checks that the guppy binary prints the --json records
+// this package decodes, by running `whoami --json`. An older guppy still
+// works for the commands with a text fallback but not for the rest, so
+// run this once up front to fail early rather than mid-run.
+func (c *ContainerClient) CheckJSONOutput(ctx context.Context) error {
+	return checkJSONOutput(ctx, c.guppyExec)
+}
 
-	g.Go(func() error {
-		err := c.validator.ValidateEmailLogin(ctx, email)
-		if err != nil {
-			if !errors.Is(context.Cause(ctx), errAlreadyLoggedIn) {
-				return err
-			}
-		}
-		return nil
-	})
+// GenerateSpace creates a new space.
+func (c *ContainerClient) GenerateSpace(ctx context.Context, options ...SpaceOption) (Space, error) {
+	return generateSpace(ctx, c.guppyExec, options...)
+}
 
-	return g.Wait()
+// AddSource adds a source directory to a space.
+func (c *ContainerClient) AddSource(ctx context.Context, spaceDID, path string) error {
+	return addSource(ctx, c.guppyExec, spaceDID, path)
 }
 
-// GenerateSpace creates a new space and returns its DID.
-func (c *ContainerClient) GenerateSpace(ctx context.Context) (string, error) {
-	stdout, _, err := c.guppyExec(ctx, "space", "generate")
-	if err != nil {
-		return "", err
-	}
+// Upload uploads all sources in a space.
+func (c *ContainerClient) Upload(ctx context.Context, spaceDID string, options ...UploadOption) (UploadResult, error) {
+	return upload(ctx, c.guppyExec, spaceDID, options...)
+}
 
-	spaceDID := strings.TrimSpace(stdout)
-	if !strings.HasPrefix(spaceDID, "did:") {
-		spaceDID = extractDID(stdout)
-	}
-	if spaceDID == "" {
-		return "", fmt.Errorf("failed to extract space DID from output: %s", stdout)
-	}
+// Retrieve downloads content by CID to a destination path.
+func (c *ContainerClient) Retrieve(ctx context.Context, spaceDID, cid, destPath string) (RetrieveResult, error) {
+	return retrieve(ctx, c.guppyExec, spaceDID, cid, destPath)
+}
 
-	return spaceDID, nil
+// Verify verifies the integrity of a DAG by its root CID.
+func (c *ContainerClient) Verify(ctx context.Context, cid string) error {
+	return verify(ctx, c.guppyExec, cid)
 }
 
-// AddSource adds a source directory to a space.
-func (c *ContainerClient) AddSource(ctx context.Context, spaceDID, path string) error {
-	_, _, err := c.guppyExec(ctx, "upload", "source", "add", spaceDID, path)
-	return err
+// ListSpaces lists the spaces the client has access to.
+func (c *ContainerClient) ListSpaces(ctx context.Context) ([]Space, error) {
+	return listSpaces(ctx, c.guppyExec)
 }
 
-// Upload uploads all sources in a space and returns the CIDs.
-func (c *ContainerClient) Upload(ctx context.Context, spaceDID string, options ...UploadOption) ([]string, error) {
-	config := &uploadConfig{}
-	for _, option := range options {
-		option(config)
-	}
+// SpaceInfo describes a space, including its providers.
+func (c *ContainerClient) SpaceInfo(ctx context.Context, spaceDID string) (SpaceInfo, error) {
+	return spaceInfo(ctx, c.guppyExec, spaceDID)
+}
 
-	args := []string{"upload"}
-	if config.replicas > 0 {
-		args = append(args, "--replicas", fmt.Sprintf("%d", config.replicas))
-	}
-	args = append(args, spaceDID)
+// ProvisionSpace provisions a space to an account.
+func (c *ContainerClient) ProvisionSpace(ctx context.Context, spaceDID, account string) error {
+	return provisionSpace(ctx, c.guppyExec, spaceDID, account)
+}
 
-	stdout, _, err := c.guppyExec(ctx, args...)
-	if err != nil {
-		return nil, err
+// CreateDelegation delegates access to a space to audience.
+func (c *ContainerClient) CreateDelegation(ctx context.Context, spaceDID, audience string, options ...DelegationOption) (Delegation, error) {
+	return createDelegation(ctx, c.guppyExec, spaceDID, audience, options...)
+}
+
+// ImportDelegation adds a delegation made out to this client.
+func (c *ContainerClient) ImportDelegation(ctx context.Context, delegation Delegation) error {
+	return importDelegation(ctx, c.guppyExec, delegation)
+}
+
+// UsageReport reports a space's storage usage, one entry per provider.
+func (c *ContainerClient) UsageReport(ctx context.Context, spaceDID string) ([]UsageReport, error) {
+	return usageReport(ctx, c.guppyExec, spaceDID)
+}
+
+// ListUploads lists the uploads registered in a space.
+func (c *ContainerClient) ListUploads(ctx context.Context, spaceDID string) ([]UploadInfo, error) {
+	return listUploads(ctx, c.guppyExec, spaceDID)
+}
+
+// RemoveUpload removes an upload from a space by its root CID.
+func (c *ContainerClient) RemoveUpload(ctx context.Context, spaceDID, root string) error {
+	return removeUpload(ctx, c.guppyExec, spaceDID, root)
+}
+
+// ListBlobs lists the blobs stored in a space.
+func (c *ContainerClient) ListBlobs(ctx context.Context, spaceDID string) ([]Blob, error) {
+	return listBlobs(ctx, c.guppyExec, spaceDID)
+}
+
+// CopyToGuppy copies a host file or directory into the guppy container
+// and returns its path there, ready for AddSource. The path keeps the
+// host path's base name, so it shows up as such in the upload.
+func (c *ContainerClient) CopyToGuppy(ctx context.Context, hostPath string) (string, error) {
+	containerPath := fmt.Sprintf("/tmp/upload-%d/%s", time.Now().UnixNano(), filepath.Base(hostPath))
+	if err := c.stack.CopyTo(ctx, "guppy", hostPath, containerPath); err != nil {
+		return "", err
 	}
-	return extractCIDs(stdout), nil
+	return containerPath, nil
 }
 
-// Retrieve downloads content by CID to a destination path.
-func (c *ContainerClient) Retrieve(ctx context.Context, spaceDID, cid, destPath string) error {
-	_, _, err := c.guppyExec(ctx, "retrieve", spaceDID, cid, destPath)
-	return err
+// CopyFromGuppy copies a file or directory out of the guppy container —
+// e.g. the destination of a Retrieve — to hostPath.
+func (c *ContainerClient) CopyFromGuppy(ctx context.Context, containerPath, hostPath string) error {
+	return c.stack.CopyFrom(ctx, "guppy", containerPath, hostPath)
+}
+
+// RetrieveAndCompare retrieves cid and checks it's byte-for-byte identical
+// to original, the host file or directory it was uploaded from (see
+// CopyToGuppy).
+func (c *ContainerClient) RetrieveAndCompare(ctx context.Context, spaceDID, cid, original string) error {
+	containerPath := fmt.Sprintf("/tmp/retrieve-%d", time.Now().UnixNano())
+	if _, err := c.Retrieve(ctx, spaceDID, cid, containerPath); err != nil {
+		return err
+	}
+	dir, err := os.MkdirTemp("", "guppy-retrieve-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	retrieved := filepath.Join(dir, filepath.Base(original))
+	if err := c.CopyFromGuppy(ctx, containerPath, retrieved); err != nil {
+		return err
+	}
+	if err := compareTrees(original, retrieved); err != nil {
+		return fmt.Errorf("retrieved %s differs from %s: %w", cid, original, err)
+	}
+	return nil
 }
 
 // GenerateTestData creates random test data inside the guppy container using randdir.
@@ -189,15 +232,3 @@ func (c *ContainerClient) GenerateTestData(ctx context.Context, size string) (st
 
 	return path, nil
 }
-
-// extractDID extracts a DID from text.
-func extractDID(text string) string {
-	re := regexp.MustCompile(`did:(key|web):[a-zA-Z0-9:._-]+`)
-	return re.FindString(text)
-}
-
-// extractCIDs extracts CIDs (bafy...) from text.
-func extractCIDs(text string) []string {
-	re := regexp.MustCompile(`bafy[a-zA-Z0-9]+`)
-	return re.FindAllString(text, -1)
-}
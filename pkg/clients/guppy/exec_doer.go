@@ -10,91 +10,152 @@ import (
 	"net/textproto"
 	"strconv"
 	"strings"
-
-	"github.com/storacha/smelt/pkg/stack"
 )
 
+// Execer runs commands in a stack's service containers. *stack.Stack
+// implements it.
+type Execer interface {
+	// Exec runs a command and returns its buffered output.
+	Exec(ctx context.Context, service string, args ...string) (stdout, stderr string, err error)
+	// ExecStream runs a command, streaming stdin to it and its output to
+	// stdout and stderr.
+	ExecStream(ctx context.Context, service string, stdin io.Reader, stdout, stderr io.Writer, args ...string) error
+}
+
 // ExecDoer is an http.Client-shaped HTTP doer that issues requests via `curl`
 // inside a container on the stack's Docker network. It exists so that code
-// running on the host can POST to URLs that only resolve in-network — notably
+// running on the host can reach URLs that only resolve in-network — notably
 // the validation links sprue embeds in its emails, which use the `upload`
-// Docker DNS name instead of a host port (see pkg/stack/ports.go).
+// Docker DNS name instead of a host port (see pkg/stack/ports.go) — and
+// drive any other in-network HTTP API the same way.
 //
-// Request bodies are not supported: stack.Exec can't pipe stdin into the
-// container, and the only caller (login validation) sends no body.
+// Request bodies are piped to curl's stdin and response bodies are streamed
+// back as curl writes them, so binary payloads and large downloads pass
+// through untouched and without being buffered.
 type ExecDoer struct {
-	Stack   *stack.Stack
+	Stack   Execer
 	Service string
 }
 
-// Do implements http.Client.Do for a narrow subset of requests: method,
-// headers, URL, no body.
+// Do implements http.Client.Do: method, headers, URL and body. Redirects
+// are not followed. As with http.Client, the caller must close the
+// response body; doing so stops curl if the body hasn't been read to the
+// end.
 func (d *ExecDoer) Do(req *http.Request) (*http.Response, error) {
-	if req.Body != nil && req.Body != http.NoBody {
-		return nil, fmt.Errorf("ExecDoer does not support request bodies")
-	}
+	ctx, cancel := context.WithCancel(req.Context())
 
-	ctx := req.Context()
-	if ctx == nil {
-		ctx = context.Background()
+	// An empty Expect stops curl sending `Expect: 100-continue` with large
+	// bodies, and an empty Content-Type stops it labelling them as form
+	// data, as http.Client wouldn't.
+	args := []string{"curl", "-sS", "-i", "-H", "Expect:"}
+	if req.Method == http.MethodHead {
+		// -X HEAD makes curl wait for a body that never comes
+		args = append(args, "--head")
+	} else {
+		args = append(args, "-X", req.Method)
 	}
-
-	args := []string{"curl", "-sS", "-i", "-X", req.Method}
 	for name, values := range req.Header {
 		for _, v := range values {
 			args = append(args, "-H", fmt.Sprintf("%s: %s", name, v))
 		}
 	}
+	var stdin io.Reader
+	if req.Body != nil && req.Body != http.NoBody {
+		stdin = req.Body
+		if req.Header.Get("Content-Type") == "" {
+			args = append(args, "-H", "Content-Type:")
+		}
+		args = append(args, "--data-binary", "@-")
+	}
 	args = append(args, req.URL.String())
 
-	stdout, stderr, err := d.Stack.Exec(ctx, d.Service, args...)
+	pr, pw := io.Pipe()
+	go func() {
+		var stderr bytes.Buffer
+		err := d.Stack.ExecStream(ctx, d.Service, stdin, pw, &stderr, args...)
+		if err != nil {
+			err = fmt.Errorf("curl in %s: %w (stderr: %s)", d.Service, err, strings.TrimSpace(stderr.String()))
+		}
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+
+	resp, err := readCurlResponse(bufio.NewReader(pr), req)
 	if err != nil {
-		return nil, fmt.Errorf("curl in %s: %w (stderr: %s)", d.Service, err, strings.TrimSpace(stderr))
+		cancel()
+		pr.Close()
+		return nil, err
 	}
-	return parseCurlResponse(stdout, req)
+	resp.Body = &execBody{Reader: resp.Body, close: func() error {
+		cancel()
+		return pr.Close()
+	}}
+	return resp, nil
 }
 
-// parseCurlResponse parses the `curl -sS -i` dump of an HTTP response into a
-// real *http.Response. We can't hand the raw output to http.ReadResponse
-// because curl decodes chunked transfer-encoding on its side while leaving the
-// `Transfer-Encoding: chunked` header in place; ReadResponse then tries to
-// decode chunk framing that isn't there. Parsing status + headers by hand and
-// treating the rest as a decoded body sidesteps that.
-func parseCurlResponse(output string, req *http.Request) (*http.Response, error) {
-	br := bufio.NewReader(strings.NewReader(output))
+// execBody is a response body streamed from a running curl.
+type execBody struct {
+	io.Reader
+	close func() error
+}
 
-	statusLine, err := br.ReadString('\n')
-	if err != nil {
-		return nil, fmt.Errorf("reading status line: %w", err)
-	}
-	statusLine = strings.TrimRight(statusLine, "\r\n")
-	parts := strings.SplitN(statusLine, " ", 3)
-	if len(parts) < 2 {
-		return nil, fmt.Errorf("malformed status line: %q", statusLine)
-	}
-	statusCode, err := strconv.Atoi(parts[1])
-	if err != nil {
-		return nil, fmt.Errorf("parsing status code: %w", err)
-	}
+func (b *execBody) Close() error {
+	return b.close()
+}
 
-	tp := textproto.NewReader(br)
-	mimeHeader, err := tp.ReadMIMEHeader()
-	if err != nil {
-		return nil, fmt.Errorf("reading headers: %w", err)
-	}
+// readCurlResponse parses the head of the `curl -sS -i` dump of an HTTP
+// response into a real *http.Response whose body is the rest of br. We can't
+// hand the raw output to http.ReadResponse because curl decodes chunked
+// transfer-encoding on its side while leaving the `Transfer-Encoding: chunked`
+// header in place; ReadResponse then tries to decode chunk framing that isn't
+// there. Parsing status + headers by hand and treating the rest as a decoded
+// body sidesteps that. Interim 1xx responses curl prints ahead of the final
+// one are skipped.
+func readCurlResponse(br *bufio.Reader, req *http.Request) (*http.Response, error) {
+	for {
+		statusLine, err := br.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("reading status line: %w", err)
+		}
+		statusLine = strings.TrimRight(statusLine, "\r\n")
+		parts := strings.SplitN(statusLine, " ", 3)
+		if len(parts) < 2 {
+			return nil, fmt.Errorf("malformed status line: %q", statusLine)
+		}
+		statusCode, err := strconv.Atoi(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("parsing status code: %w", err)
+		}
 
-	body, err := io.ReadAll(br)
-	if err != nil {
-		return nil, fmt.Errorf("reading body: %w", err)
-	}
+		tp := textproto.NewReader(br)
+		mimeHeader, err := tp.ReadMIMEHeader()
+		if err != nil {
+			return nil, fmt.Errorf("reading headers: %w", err)
+		}
+		if statusCode >= 100 && statusCode < 200 {
+			continue
+		}
 
-	return &http.Response{
-		Status:        fmt.Sprintf("%d %s", statusCode, http.StatusText(statusCode)),
-		StatusCode:    statusCode,
-		Proto:         parts[0],
-		Header:        http.Header(mimeHeader),
-		Body:          io.NopCloser(bytes.NewReader(body)),
-		ContentLength: int64(len(body)),
-		Request:       req,
-	}, nil
+		header := http.Header(mimeHeader)
+		contentLength := int64(-1)
+		if req.Method == http.MethodHead {
+			contentLength = 0
+		} else if header.Get("Transfer-Encoding") == "" {
+			if n, err := strconv.ParseInt(header.Get("Content-Length"), 10, 64); err == nil {
+				contentLength = n
+			}
+		}
+
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", statusCode, http.StatusText(statusCode)),
+			StatusCode:    statusCode,
+			Proto:         parts[0],
+			Header:        header,
+			Body:          io.NopCloser(br),
+			ContentLength: contentLength,
+			Request:       req,
+		}, nil
+	}
 }
@@ -1,9 +1,14 @@
 package guppy
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 )
 
@@ -15,7 +20,7 @@ func TestParseCurlResponse(t *testing.T) {
 		"\r\n"
 
 	req := httptest.NewRequest(http.MethodPost, "http://upload/validate-email/x", nil)
-	resp, err := parseCurlResponse(raw, req)
+	resp, err := readCurlResponse(bufio.NewReader(strings.NewReader(raw)), req)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -41,7 +46,7 @@ func TestParseCurlResponseWithBody(t *testing.T) {
 		"hello world"
 
 	req := httptest.NewRequest(http.MethodGet, "http://upload/hi", nil)
-	resp, err := parseCurlResponse(raw, req)
+	resp, err := readCurlResponse(bufio.NewReader(strings.NewReader(raw)), req)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -56,3 +61,92 @@ func TestParseCurlResponseWithBody(t *testing.T) {
 		t.Errorf("want %q, got %q", "hello world", string(body))
 	}
 }
+
+func TestParseCurlResponseSkipsInterim(t *testing.T) {
+	raw := "HTTP/1.1 100 Continue\r\n" +
+		"\r\n" +
+		"HTTP/1.1 201 Created\r\n" +
+		"Content-Length: 2\r\n" +
+		"\r\n" +
+		"ok"
+
+	req := httptest.NewRequest(http.MethodPost, "http://upload/", nil)
+	resp, err := readCurlResponse(bufio.NewReader(strings.NewReader(raw)), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 201 || resp.ContentLength != 2 {
+		t.Errorf("want 201 with length 2, got %d with %d", resp.StatusCode, resp.ContentLength)
+	}
+}
+
+// curlStack answers ExecStream like curl would, recording what it was
+// asked to run and what it read from stdin.
+type curlStack struct {
+	Execer
+	args  []string
+	stdin []byte
+	out   string
+	err   error
+}
+
+func (s *curlStack) ExecStream(ctx context.Context, service string, stdin io.Reader, stdout, stderr io.Writer, args ...string) error {
+	s.args = args
+	if stdin != nil {
+		s.stdin, _ = io.ReadAll(stdin)
+	}
+	// Done with s once the response is written: the caller may change it.
+	out, err := s.out, s.err
+	io.WriteString(stderr, "curl: (7) failed")
+	io.WriteString(stdout, out)
+	return err
+}
+
+func TestExecDoer(t *testing.T) {
+	// Bytes that would be mangled by any text handling.
+	payload := []byte{0x00, 0xff, '\r', '\n', 0x80}
+	stack := &curlStack{out: "HTTP/1.1 200 OK\r\nContent-Type: application/vnd.ipld.car\r\n\r\n" + string(payload)}
+	d := &ExecDoer{Stack: stack, Service: "guppy"}
+
+	req := httptest.NewRequest(http.MethodPost, "http://upload/", bytes.NewReader(payload))
+	req.Header.Set("Content-Type", "application/vnd.ipld.car")
+	resp, err := d.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(body, payload) {
+		t.Errorf("body = %x, want %x", body, payload)
+	}
+	if !bytes.Equal(stack.stdin, payload) {
+		t.Errorf("stdin = %x, want %x", stack.stdin, payload)
+	}
+	args := strings.Join(stack.args, " ")
+	for _, want := range []string{"-X POST", "-H Content-Type: application/vnd.ipld.car", "--data-binary @-", "http://upload/"} {
+		if !strings.Contains(args, want) {
+			t.Errorf("args %q missing %q", args, want)
+		}
+	}
+
+	// Without a body nothing is piped.
+	stack.out = "HTTP/1.1 200 OK\r\n\r\n"
+	resp, err = d.Do(httptest.NewRequest(http.MethodHead, "http://upload/", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if args := strings.Join(stack.args, " "); strings.Contains(args, "--data-binary") || !strings.Contains(args, "--head") {
+		t.Errorf("HEAD args = %q", args)
+	}
+
+	// A curl failure surfaces from Do, with curl's complaint.
+	stack.out = ""
+	stack.err = errors.New("command failed with exit code 7")
+	if _, err := d.Do(httptest.NewRequest(http.MethodGet, "http://nowhere/", nil)); err == nil || !strings.Contains(err.Error(), "curl: (7)") {
+		t.Errorf("want curl error, got %v", err)
+	}
+}
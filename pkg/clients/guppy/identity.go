@@ -0,0 +1,54 @@
+package guppy
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"regexp"
+)
+
+const (
+	// guppyConfig is where the guppy service mounts its config.
+	guppyConfig = "/root/.config/guppy/config.toml"
+	// identitiesDir holds one HOME per identity. It's inside the
+	// guppy-data volume, so identities are captured by checkpoints and
+	// snapshots like the default one.
+	identitiesDir = "/root/.storacha/guppy/identities"
+)
+
+var identityName = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// IdentityEmail is the email address an identity created with
+// NewIdentityClient logs in with.
+func IdentityEmail(name string) string {
+	return name + "@example.com"
+}
+
+// NewIdentityClient returns a client for a separate guppy identity in the
+// stack's guppy container: its own agent key, login and spaces, isolated
+// from the default identity and from every other name. Use it to test
+// several accounts against one stack — sharing a space, revoking access,
+// per-account quotas. The identity logs in as IdentityEmail(name).
+//
+// Each identity runs guppy with its own HOME, which holds a copy of the
+// service's config and guppy's data directory. Asking for the same name
+// again returns a client for the same identity.
+func NewIdentityClient(ctx context.Context, stack Stack, name string, options ...Option) (*ContainerClient, error) {
+	if !identityName.MatchString(name) {
+		return nil, fmt.Errorf("invalid identity name %q: use lowercase letters, digits and dashes", name)
+	}
+	c, err := NewContainerClient(stack, options...)
+	if err != nil {
+		return nil, err
+	}
+	c.home = path.Join(identitiesDir, name)
+
+	configDir := path.Join(c.home, ".config", "guppy")
+	if _, _, err := c.exec(ctx, "mkdir", "-p", configDir); err != nil {
+		return nil, fmt.Errorf("create identity %s: %w", name, err)
+	}
+	if _, _, err := c.exec(ctx, "cp", guppyConfig, path.Join(configDir, "config.toml")); err != nil {
+		return nil, fmt.Errorf("create identity %s: %w", name, err)
+	}
+	return c, nil
+}
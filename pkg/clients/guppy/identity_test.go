@@ -0,0 +1,48 @@
+package guppy
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// fakeStack records the commands run in it.
+type fakeStack struct {
+	Stack
+	calls []string
+}
+
+func (f *fakeStack) Exec(ctx context.Context, service string, args ...string) (string, string, error) {
+	f.calls = append(f.calls, service+": "+strings.Join(args, " "))
+	return "Successfully logged in", "", nil
+}
+
+func (f *fakeStack) EmailEndpoint() string { return "http://localhost:1" }
+
+func TestNewIdentityClient(t *testing.T) {
+	ctx := t.Context()
+	fs := &fakeStack{}
+	clicked := validatorFunc(func(ctx context.Context, email string) error { return nil })
+
+	alice, err := NewIdentityClient(ctx, fs, "alice", WithLoginValidator(clicked))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := alice.Login(ctx, IdentityEmail("alice")); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"guppy: mkdir -p /root/.storacha/guppy/identities/alice/.config/guppy",
+		"guppy: cp /root/.config/guppy/config.toml /root/.storacha/guppy/identities/alice/.config/guppy/config.toml",
+		"guppy: env HOME=/root/.storacha/guppy/identities/alice guppy login alice@example.com",
+	}
+	if strings.Join(fs.calls, "\n") != strings.Join(want, "\n") {
+		t.Errorf("calls:\n%s\nwant:\n%s", strings.Join(fs.calls, "\n"), strings.Join(want, "\n"))
+	}
+
+	for _, name := range []string{"", "Alice", "../x", "a b"} {
+		if _, err := NewIdentityClient(ctx, fs, name); err == nil {
+			t.Errorf("%q: want error", name)
+		}
+	}
+}
@@ -2,15 +2,52 @@ package guppy
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"html"
 	"net/http"
 	"net/url"
+	"regexp"
 	"strings"
 	"time"
 
+	"github.com/google/uuid"
+
 	"github.com/storacha/smelt/pkg/clients/smtp4dev"
 )
 
+// DefaultValidationSubject matches the subjects of the login emails sprue
+// sends.
+var DefaultValidationSubject = regexp.MustCompile(`(?i)verif|validat|confirm|log\s?in|sign\s?in`)
+
+// ValidateEmailLogin polls smtp4dev with exponential backoff between these
+// bounds: quickly at first, since the email usually lands within a second of
+// `guppy login`, then backing off so a slow stack isn't hammered.
+const (
+	minPollInterval = 100 * time.Millisecond
+	maxPollInterval = 2 * time.Second
+)
+
+// NoValidationEmailError is returned by ValidateEmailLogin when no
+// validation email for Email arrived before its context was done. It wraps
+// the context's cause, so errors.Is(err, context.DeadlineExceeded) tells a
+// timeout apart from a cancellation.
+type NoValidationEmailError struct {
+	Email  string
+	Waited time.Duration
+	Cause  error
+}
+
+func (e *NoValidationEmailError) Error() string {
+	return fmt.Sprintf("no validation email for %s within %s: %v", e.Email, e.Waited.Round(time.Millisecond), e.Cause)
+}
+
+func (e *NoValidationEmailError) Unwrap() error {
+	return e.Cause
+}
+
+var errNoValidationLink = errors.New("validation link not found")
+
 // Clicker issues the POST against the validation link pulled out of the email
 // body. It is split from the smtp4dev API client because the two live on
 // different planes: the API is fetched from the host via smtp4dev's mapped
@@ -23,6 +60,7 @@ type Clicker interface {
 type clickerConfig struct {
 	httpClient *http.Client
 	clicker    Clicker
+	subject    *regexp.Regexp
 }
 
 type SMTP4DevLoginValidatorOption func(*clickerConfig)
@@ -37,25 +75,37 @@ func WithSMTP4DevLoginValidatorHTTPClient(httpClient *http.Client) SMTP4DevLogin
 
 // WithSMTP4DevLoginValidatorClicker sets the doer used to POST the validation
 // link parsed out of the email body. Defaults to [http.DefaultClient]; pass
-// an in-network doer (e.g. [ExecDoer]) when the validation URL is only
-// reachable from inside the Docker network.
+// an in-network doer (e.g. [ExecDoer], or the client from a proxied stack's
+// HTTPClient) when the validation URL is only reachable from inside the
+// Docker network.
 func WithSMTP4DevLoginValidatorClicker(clicker Clicker) SMTP4DevLoginValidatorOption {
 	return func(c *clickerConfig) {
 		c.clicker = clicker
 	}
 }
 
+// WithSMTP4DevLoginValidatorSubject sets the pattern a validation email's
+// subject must match. Defaults to [DefaultValidationSubject].
+func WithSMTP4DevLoginValidatorSubject(subject *regexp.Regexp) SMTP4DevLoginValidatorOption {
+	return func(c *clickerConfig) {
+		c.subject = subject
+	}
+}
+
 type SMTP4DevLoginValidator struct {
 	Client     *smtp4dev.Client
 	HTTPClient *http.Client
 	Clicker    Clicker
+	// Subject is the pattern a validation email's subject must match. Nil
+	// matches any subject.
+	Subject *regexp.Regexp
 }
 
 // NewSMTP4DevLoginValidator returns a new [SMTP4DevLoginValidator] that can
 // be used to validate logins by clicking links in emails sent to a SMTP4Dev
 // server.
 func NewSMTP4DevLoginValidator(endpoint string, options ...SMTP4DevLoginValidatorOption) (*SMTP4DevLoginValidator, error) {
-	cfg := clickerConfig{httpClient: http.DefaultClient}
+	cfg := clickerConfig{httpClient: http.DefaultClient, subject: DefaultValidationSubject}
 	for _, option := range options {
 		option(&cfg)
 	}
@@ -70,85 +120,144 @@ func NewSMTP4DevLoginValidator(endpoint string, options ...SMTP4DevLoginValidato
 		Client:     client,
 		HTTPClient: cfg.httpClient,
 		Clicker:    cfg.clicker,
+		Subject:    cfg.subject,
 	}, nil
 }
 
-// ValidateEmailLogin polls the SMTP4Dev server for an email sent to the given
-// address, extracts the validation link, and clicks it. Use the passed context
-// to cancel the polling.
+// ValidateEmailLogin polls the SMTP4Dev server for a validation email sent
+// to the given address, extracts the validation link from its plain text or
+// HTML body, and clicks it. Use the passed context to bound the polling; if
+// it ends before the email arrives, the error is a [*NoValidationEmailError].
 //
 // Note: If the client is already logged in, no email link will be sent, so it
 // is important to always cancel the context or this method may never return.
 func (ec *SMTP4DevLoginValidator) ValidateEmailLogin(ctx context.Context, email string) error {
-	found := false
-	for !found {
+	start := time.Now()
+	// messages to this address that turned out not to be validation emails,
+	// so their bodies aren't fetched again on every poll
+	rejected := map[uuid.UUID]bool{}
+	interval := minPollInterval
+	for {
+		id, link, found, err := ec.findValidationEmail(ctx, email, rejected)
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			return err
+		}
+		if found {
+			return ec.click(ctx, id, link)
+		}
+
 		select {
-		case <-time.After(100 * time.Millisecond):
+		case <-time.After(interval):
 		case <-ctx.Done():
-			return ctx.Err()
 		}
+		if ctx.Err() != nil {
+			break
+		}
+		interval = min(interval*2, maxPollInterval)
+	}
+	return &NoValidationEmailError{Email: email, Waited: time.Since(start), Cause: context.Cause(ctx)}
+}
 
-		page := 0
-		for !found {
-			msgPage, err := ec.Client.Messages(ctx, smtp4dev.WithPage(page))
-			if err != nil {
-				return fmt.Errorf("fetching messages: %w", err)
-			}
-			for _, msg := range msgPage.Results {
-				if msg.DeliveredTo != email {
-					continue
-				}
-				body, err := ec.Client.MessageBodyPlainText(ctx, msg.ID)
-				if err != nil {
-					return fmt.Errorf("fetching message body: %w", err)
-				}
-				link, err := extractValidationLink(body)
-				if err != nil {
-					continue
-				}
-				req, err := http.NewRequestWithContext(ctx, http.MethodPost, link.String(), nil)
-				if err != nil {
-					return fmt.Errorf("creating validation request: %w", err)
-				}
-				req.Header.Set("Content-Type", "text/plain")
-				res, err := ec.Clicker.Do(req)
-				if err != nil {
-					return fmt.Errorf("clicking validation link: %w", err)
-				}
-				defer res.Body.Close()
-				if res.StatusCode < 200 || res.StatusCode >= 300 {
-					return fmt.Errorf("clicking validation link: received status code %d", res.StatusCode)
-				}
-				// clean up the message
-				err = ec.Client.DeleteMessage(ctx, msg.ID)
-				if err != nil {
-					return fmt.Errorf("deleting message: %w", err)
-				}
-				found = true
-				break
-			}
+// findValidationEmail searches smtp4dev for a validation email to the given
+// address, returning its ID and link if there is one yet.
+func (ec *SMTP4DevLoginValidator) findValidationEmail(ctx context.Context, email string, rejected map[uuid.UUID]bool) (uuid.UUID, url.URL, bool, error) {
+	matches, err := ec.Client.Search(ctx, smtp4dev.Filter{To: email})
+	if err != nil {
+		return uuid.UUID{}, url.URL{}, false, fmt.Errorf("fetching messages: %w", err)
+	}
+	for _, msg := range matches {
+		if rejected[msg.ID] {
+			continue
+		}
+		if ec.Subject != nil && !ec.Subject.MatchString(msg.Subject) {
+			rejected[msg.ID] = true
+			continue
+		}
+		link, err := ec.messageLink(ctx, msg.ID)
+		if errors.Is(err, errNoValidationLink) {
+			rejected[msg.ID] = true
+			continue
+		}
+		if err != nil {
+			return uuid.UUID{}, url.URL{}, false, err
+		}
+		return msg.ID, link, true, nil
+	}
+	return uuid.UUID{}, url.URL{}, false, nil
+}
 
-			if page >= msgPage.PageCount-1 {
-				break
-			}
-			page++
+// messageLink fetches whichever bodies the message has and finds the
+// validation link in them.
+func (ec *SMTP4DevLoginValidator) messageLink(ctx context.Context, id uuid.UUID) (url.URL, error) {
+	msg, err := ec.Client.Message(ctx, id)
+	if err != nil {
+		return url.URL{}, fmt.Errorf("fetching message: %w", err)
+	}
+	var plain, htmlBody string
+	if msg.HasPlainTextBody {
+		plain, err = ec.Client.MessageBodyPlainText(ctx, id)
+		if err != nil {
+			return url.URL{}, fmt.Errorf("fetching message body: %w", err)
 		}
 	}
-	if !found {
-		return fmt.Errorf("validation email not found for: %s", email)
+	if msg.HasHtmlBody {
+		htmlBody, err = ec.Client.MessageBodyHTML(ctx, id)
+		if err != nil {
+			return url.URL{}, fmt.Errorf("fetching message HTML body: %w", err)
+		}
 	}
-	return nil
+	return extractValidationLink(plain, htmlBody)
 }
 
-// TODO: this is pretty brittle - it assumes the whole body is the link, which
-// is not necessarily the case. Probably needs a regex.
-func extractValidationLink(body string) (url.URL, error) {
-	if !strings.Contains(body, "validate-email") {
-		return url.URL{}, fmt.Errorf("validation link not found")
+func (ec *SMTP4DevLoginValidator) click(ctx context.Context, id uuid.UUID, link url.URL) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, link.String(), nil)
+	if err != nil {
+		return fmt.Errorf("creating validation request: %w", err)
 	}
-	u, err := url.Parse(strings.TrimSpace(body))
+	req.Header.Set("Content-Type", "text/plain")
+	res, err := ec.Clicker.Do(req)
 	if err != nil {
-		return url.URL{}, fmt.Errorf("parsing validation link: %w", err)
+		return fmt.Errorf("clicking validation link: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("clicking validation link: received status code %d", res.StatusCode)
+	}
+	// clean up the message
+	if err := ec.Client.DeleteMessage(ctx, id); err != nil {
+		return fmt.Errorf("deleting message: %w", err)
+	}
+	return nil
+}
+
+var (
+	urlPattern  = regexp.MustCompile(`https?://[^\s"'<>]+`)
+	hrefPattern = regexp.MustCompile(`(?i)\bhref\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s>]+))`)
+)
+
+// extractValidationLink finds the first validate-email link in a message's
+// plain text or HTML body. In HTML, anchors are preferred over bare URLs in
+// the text, and entities such as &amp; in query strings are decoded.
+func extractValidationLink(plain, htmlBody string) (url.URL, error) {
+	candidates := urlPattern.FindAllString(plain, -1)
+	for _, m := range hrefPattern.FindAllStringSubmatch(htmlBody, -1) {
+		candidates = append(candidates, html.UnescapeString(m[1]+m[2]+m[3]))
+	}
+	candidates = append(candidates, urlPattern.FindAllString(html.UnescapeString(htmlBody), -1)...)
+
+	for _, c := range candidates {
+		// punctuation ending the sentence a link sits in isn't part of it
+		c = strings.TrimRight(strings.TrimSpace(c), ".,;:!?)]")
+		u, err := url.Parse(c)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			continue
+		}
+		if strings.Contains(u.Path, "validate-email") {
+			return *u, nil
+		}
 	}
-	return *u, nil
+	return url.URL{}, errNoValidationLink
 }
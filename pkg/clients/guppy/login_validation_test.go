@@ -0,0 +1,214 @@
+package guppy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/storacha/smelt/pkg/clients/smtp4dev"
+)
+
+func TestExtractValidationLink(t *testing.T) {
+	const link = "http://upload/validate-email?ucan=abc&mode=authorize"
+	tests := []struct {
+		name  string
+		plain string
+		html  string
+		want  string
+	}{
+		{name: "bare link", plain: link + "\n", want: link},
+		{name: "link in prose", plain: "Click the link below to log in:\n\n" + link + ".\n\nThanks!", want: link},
+		{name: "angle brackets", plain: "Log in: <" + link + ">", want: link},
+		{
+			name: "html anchor",
+			html: `<p>Hello</p><a class="btn" href="http://upload/validate-email?ucan=abc&amp;mode=authorize">Verify</a>`,
+			want: link,
+		},
+		{
+			name: "anchor preferred over other links",
+			html: `<a href='https://storacha.network'>home</a> <a href='` + link + `'>verify</a>`,
+			want: link,
+		},
+		{
+			name:  "plain text wins",
+			plain: "http://upload/validate-email?ucan=plain",
+			html:  `<a href="http://upload/validate-email?ucan=html">verify</a>`,
+			want:  "http://upload/validate-email?ucan=plain",
+		},
+		{name: "no validation link", plain: "Welcome! See https://storacha.network", html: "<p>hi</p>"},
+		{name: "not a URL", plain: "validate-email"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := extractValidationLink(tt.plain, tt.html)
+			if tt.want == "" {
+				if !errors.Is(err, errNoValidationLink) {
+					t.Fatalf("want errNoValidationLink, got %v (%s)", err, got.String())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.String() != tt.want {
+				t.Errorf("link = %q, want %q", got.String(), tt.want)
+			}
+		})
+	}
+}
+
+// fakeSMTP4Dev serves the parts of the smtp4dev API the validator uses.
+type fakeSMTP4Dev struct {
+	mu       sync.Mutex
+	messages map[uuid.UUID]fakeMessage
+	searches []string
+	deleted  []uuid.UUID
+}
+
+type fakeMessage struct {
+	smtp4dev.MessageResult
+	plain, html string
+}
+
+func (f *fakeSMTP4Dev) add(to, subject, plain, html string) uuid.UUID {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	id := uuid.New()
+	f.messages[id] = fakeMessage{
+		MessageResult: smtp4dev.MessageResult{ID: id, DeliveredTo: to, To: []string{to}, Subject: subject},
+		plain:         plain,
+		html:          html,
+	}
+	return id
+}
+
+func (f *fakeSMTP4Dev) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) == 2 {
+		terms := r.URL.Query().Get("searchTerms")
+		f.searches = append(f.searches, terms)
+		page := smtp4dev.MessagePage{PageCount: 1}
+		for _, m := range f.messages {
+			if strings.Contains(m.DeliveredTo, terms) || strings.Contains(m.Subject, terms) {
+				page.Results = append(page.Results, m.MessageResult)
+			}
+		}
+		json.NewEncoder(w).Encode(page)
+		return
+	}
+	msg, ok := f.messages[uuid.MustParse(parts[2])]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	switch {
+	case r.Method == http.MethodDelete:
+		delete(f.messages, msg.ID)
+		f.deleted = append(f.deleted, msg.ID)
+	case len(parts) == 3:
+		json.NewEncoder(w).Encode(smtp4dev.Message{ID: msg.ID, HasPlainTextBody: msg.plain != "", HasHtmlBody: msg.html != ""})
+	case parts[3] == "plaintext":
+		w.Write([]byte(msg.plain))
+	case parts[3] == "html":
+		w.Write([]byte(msg.html))
+	}
+}
+
+type clickRecorder struct {
+	mu     sync.Mutex
+	clicks []string
+}
+
+func (c *clickRecorder) Do(req *http.Request) (*http.Response, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.clicks = append(c.clicks, req.URL.String())
+	rec := httptest.NewRecorder()
+	rec.WriteHeader(http.StatusOK)
+	return rec.Result(), nil
+}
+
+func TestValidateEmailLogin(t *testing.T) {
+	fake := &fakeSMTP4Dev{messages: map[uuid.UUID]fakeMessage{}}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	clicker := &clickRecorder{}
+	v, err := NewSMTP4DevLoginValidator(srv.URL, WithSMTP4DevLoginValidatorClicker(clicker))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const email = "alice@example.com"
+	// Neither of these may be clicked: one is for someone else, the other
+	// isn't a validation email.
+	fake.add("bob@example.com", "Verify your email address", "http://upload/validate-email?ucan=bob", "")
+	newsletter := fake.add(email, "Welcome to Storacha", "http://upload/validate-email?ucan=spam", "")
+	// The validation email arrives while the validator is polling.
+	added := make(chan uuid.UUID, 1)
+	time.AfterFunc(150*time.Millisecond, func() {
+		added <- fake.add(email, "Verify your email address", "",
+			`<a href="http://upload/validate-email?ucan=alice&amp;mode=authorize">Verify</a>`)
+	})
+
+	ctx, cancel := context.WithTimeout(t.Context(), 5*time.Second)
+	defer cancel()
+	if err := v.ValidateEmailLogin(ctx, email); err != nil {
+		t.Fatal(err)
+	}
+
+	want := <-added
+	if len(clicker.clicks) != 1 || clicker.clicks[0] != "http://upload/validate-email?ucan=alice&mode=authorize" {
+		t.Errorf("clicks = %q", clicker.clicks)
+	}
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	if len(fake.deleted) != 1 || fake.deleted[0] != want {
+		t.Errorf("deleted = %v, want [%v]", fake.deleted, want)
+	}
+	if _, ok := fake.messages[newsletter]; !ok {
+		t.Error("non-validation email was deleted")
+	}
+	for _, terms := range fake.searches {
+		if terms != email {
+			t.Errorf("searched for %q, want %q", terms, email)
+		}
+	}
+}
+
+func TestValidateEmailLoginTimeout(t *testing.T) {
+	fake := &fakeSMTP4Dev{messages: map[uuid.UUID]fakeMessage{}}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	v, err := NewSMTP4DevLoginValidator(srv.URL, WithSMTP4DevLoginValidatorClicker(&clickRecorder{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(t.Context(), 300*time.Millisecond)
+	defer cancel()
+	err = v.ValidateEmailLogin(ctx, "nobody@example.com")
+	var noEmail *NoValidationEmailError
+	if !errors.As(err, &noEmail) {
+		t.Fatalf("want *NoValidationEmailError, got %v", err)
+	}
+	if noEmail.Email != "nobody@example.com" || noEmail.Waited < 300*time.Millisecond {
+		t.Errorf("error = %+v", noEmail)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("error doesn't wrap the deadline: %v", err)
+	}
+	// Backing off from 100ms, a 300ms wait is a handful of polls at most.
+	if n := len(fake.searches); n > 4 {
+		t.Errorf("polled %d times in 300ms", n)
+	}
+}
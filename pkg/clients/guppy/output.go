@@ -0,0 +1,284 @@
+package guppy
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/ipfs/go-cid"
+	"github.com/storacha/go-ucanto/did"
+)
+
+// jsonFlag switches guppy's commands to structured output: one JSON
+// object per line on stdout. Progress and log lines still go wherever
+// guppy sends them, so nothing they mention can leak into the results.
+//
+// The records this package reads, by command:
+//
+//	whoami             {"did"}
+//	space generate     {"did","name"}
+//	space ls           {"did","name"} per space
+//	space info         {"did","name","providers"}
+//	upload             {"source","root","shards","bytes","replicas"} per source
+//	upload ls          {"root","shards"} per upload
+//	retrieve           {"cid","path","bytes"}
+//	delegation create  {"cid","data"}, data being the base64 CAR
+//	usage report       {"space","provider","bytes"} per provider
+//	blob ls            {"digest","size"} per blob
+//
+// The flag and these shapes are those of the image systems/guppy/compose.yml
+// defaults to, ghcr.io/storacha/guppy:main-dev; the e2e CLI surface test
+// checks that image accepts --json on each command. A guppy that predates
+// the flag prints its human-readable output instead, which decodeRecords
+// reports as a *NotJSONError rather than as an empty result. whoami,
+// space generate, upload and retrieve then fall back to reading that
+// text the way the client did before --json; the other commands have no
+// text form to fall back to and return the error.
+const jsonFlag = "--json"
+
+// The text fallbacks scrape DIDs and root CIDs from human-readable
+// output. They recover only what those patterns can see: an upload's
+// sources come back with a root and nothing else.
+var (
+	didPattern = regexp.MustCompile(`did:(key|web):[a-zA-Z0-9:._-]+`)
+	cidPattern = regexp.MustCompile(`bafy[a-zA-Z0-9]+`)
+)
+
+// NotJSONError is returned when a command run with --json prints output
+// but not a single JSON record, typically because the guppy image is older
+// than the flag.
+type NotJSONError struct {
+	// Command is the guppy subcommand, e.g. "space ls".
+	Command string
+	// Stdout is everything the command printed.
+	Stdout string
+}
+
+func (e *NotJSONError) Error() string {
+	return fmt.Sprintf("guppy %s %s printed no JSON records (does the guppy image support %s?); stdout:\n%s",
+		e.Command, jsonFlag, jsonFlag, e.Stdout)
+}
+
+// Space is a space created by GenerateSpace or listed by ListSpaces.
+type Space struct {
+	DID  string `json:"did"`
+	Name string `json:"name,omitempty"`
+}
+
+// UploadResult is what Upload reports for a space: one entry per source
+// added with AddSource, in the order guppy uploaded them.
+type UploadResult struct {
+	Sources []SourceUpload
+}
+
+// SourceUpload is the upload of a single source.
+type SourceUpload struct {
+	// Source is the path the source was added with.
+	Source string `json:"source"`
+	// Root is the CID of the source's root DAG node.
+	Root string `json:"root"`
+	// Shards are the CIDs of the CAR shards the DAG was stored in.
+	Shards []string `json:"shards"`
+	// Bytes is the size of the source's content.
+	Bytes int64 `json:"bytes"`
+	// Replicas is the number of storage nodes the shards were placed on.
+	Replicas int `json:"replicas"`
+}
+
+// Roots returns the root CID of every source, in upload order.
+func (r UploadResult) Roots() []string {
+	roots := make([]string, len(r.Sources))
+	for i, s := range r.Sources {
+		roots[i] = s.Root
+	}
+	return roots
+}
+
+// Root returns the root CID the given source was uploaded as.
+func (r UploadResult) Root(source string) (string, bool) {
+	for _, s := range r.Sources {
+		if s.Source == source {
+			return s.Root, true
+		}
+	}
+	return "", false
+}
+
+// Bytes returns the total size of all sources.
+func (r UploadResult) Bytes() int64 {
+	var n int64
+	for _, s := range r.Sources {
+		n += s.Bytes
+	}
+	return n
+}
+
+// RetrieveResult is what Retrieve reports.
+type RetrieveResult struct {
+	CID   string `json:"cid"`
+	Path  string `json:"path"`
+	Bytes int64  `json:"bytes"`
+}
+
+// SpaceInfo describes a space as `guppy space info` reports it.
+type SpaceInfo struct {
+	DID  string `json:"did"`
+	Name string `json:"name,omitempty"`
+	// Providers are the DIDs of the storage providers the space is
+	// provisioned with; empty if it isn't provisioned.
+	Providers []string `json:"providers"`
+}
+
+// Delegation is a UCAN delegation created with CreateDelegation, in the
+// CAR-encoded form ImportDelegation accepts.
+type Delegation struct {
+	CID  string `json:"cid"`
+	Data []byte `json:"data"`
+}
+
+// UsageReport is a space's storage usage at one provider.
+type UsageReport struct {
+	Space    string `json:"space"`
+	Provider string `json:"provider"`
+	Bytes    int64  `json:"bytes"`
+}
+
+// UploadInfo is an upload registered in a space.
+type UploadInfo struct {
+	Root   string   `json:"root"`
+	Shards []string `json:"shards"`
+}
+
+// Blob is a blob stored in a space.
+type Blob struct {
+	// Digest is the multibase-encoded multihash of the blob.
+	Digest string `json:"digest"`
+	Size   int64  `json:"size"`
+}
+
+// parseSpace reads the space record from `guppy space generate --json`.
+func parseSpace(stdout string) (Space, error) {
+	space, err := parseOne("space generate", stdout, "space", func(s Space) bool { return s.DID != "" })
+	if d := didPattern.FindString(stdout); d != "" && isNotJSON(err) {
+		space, err = Space{DID: d}, nil
+	}
+	if err != nil {
+		return Space{}, err
+	}
+	if _, err := did.Parse(space.DID); err != nil {
+		return Space{}, fmt.Errorf("invalid space DID %q: %w", space.DID, err)
+	}
+	return space, nil
+}
+
+// parseAgent reads the agent DID from `guppy whoami --json`.
+func parseAgent(stdout string) (string, error) {
+	type agent struct {
+		DID string `json:"did"`
+	}
+	a, err := parseOne("whoami", stdout, "agent", func(a agent) bool { return a.DID != "" })
+	if d := didPattern.FindString(stdout); d != "" && isNotJSON(err) {
+		a, err = agent{DID: d}, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if _, err := did.Parse(a.DID); err != nil {
+		return "", fmt.Errorf("invalid agent DID %q: %w", a.DID, err)
+	}
+	return a.DID, nil
+}
+
+// parseUpload reads the per-source records from `guppy upload --json`.
+func parseUpload(stdout string) (UploadResult, error) {
+	sources, err := decodeRecords("upload", stdout, func(s SourceUpload) bool { return s.Root != "" })
+	if roots := cidPattern.FindAllString(stdout, -1); len(roots) > 0 && isNotJSON(err) {
+		sources, err = nil, nil
+		seen := make(map[string]bool)
+		for _, root := range roots {
+			if !seen[root] {
+				seen[root] = true
+				sources = append(sources, SourceUpload{Root: root})
+			}
+		}
+	}
+	if err != nil {
+		return UploadResult{}, err
+	}
+	if len(sources) == 0 {
+		return UploadResult{}, fmt.Errorf("no uploads in output: %s", stdout)
+	}
+	for _, s := range sources {
+		if _, err := cid.Decode(s.Root); err != nil {
+			return UploadResult{}, fmt.Errorf("source %s: invalid root CID %q: %w", s.Source, s.Root, err)
+		}
+		for _, shard := range s.Shards {
+			if _, err := cid.Decode(shard); err != nil {
+				return UploadResult{}, fmt.Errorf("source %s: invalid shard CID %q: %w", s.Source, shard, err)
+			}
+		}
+	}
+	return UploadResult{Sources: sources}, nil
+}
+
+// parseRetrieve reads the record from `guppy retrieve --json`.
+func parseRetrieve(stdout string) (RetrieveResult, error) {
+	return parseOne("retrieve", stdout, "retrieval", func(r RetrieveResult) bool { return r.CID != "" })
+}
+
+// isNotJSON reports whether err says a command printed text rather than
+// JSON records.
+func isNotJSON(err error) bool {
+	var notJSON *NotJSONError
+	return errors.As(err, &notJSON)
+}
+
+// parseOne reads the single record of a command that reports one result.
+func parseOne[T any](command, stdout, what string, keep func(T) bool) (T, error) {
+	var zero T
+	records, err := decodeRecords(command, stdout, keep)
+	if err != nil {
+		return zero, err
+	}
+	if len(records) != 1 {
+		return zero, fmt.Errorf("want 1 %s in output, got %d: %s", what, len(records), stdout)
+	}
+	return records[0], nil
+}
+
+// decodeRecords decodes each JSON object line of output into a T, keeping
+// those for which keep returns true. Lines that aren't JSON objects are
+// skipped, as are objects of other shapes (keep filters those out by
+// their missing key field), so stray output can't be mistaken for a
+// result. Output with no JSON object at all is a *NotJSONError naming
+// command; empty output is simply no records.
+func decodeRecords[T any](command, output string, keep func(T) bool) ([]T, error) {
+	var records []T
+	sawJSON := false
+	sc := bufio.NewScanner(strings.NewReader(output))
+	sc.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if !strings.HasPrefix(line, "{") {
+			continue
+		}
+		sawJSON = true
+		var rec T
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			return nil, fmt.Errorf("decode output line %q: %w", line, err)
+		}
+		if keep(rec) {
+			records = append(records, rec)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("read output: %w", err)
+	}
+	if !sawJSON && strings.TrimSpace(output) != "" {
+		return nil, &NotJSONError{Command: command, Stdout: output}
+	}
+	return records, nil
+}
@@ -0,0 +1,161 @@
+package guppy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multihash"
+)
+
+func testCID(t *testing.T, codec uint64, data string) string {
+	t.Helper()
+	c, err := cid.Prefix{Version: 1, Codec: codec, MhType: multihash.SHA2_256, MhLength: -1}.Sum([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c.String()
+}
+
+func TestParseUpload(t *testing.T) {
+	rootA, rootB := testCID(t, cid.DagProtobuf, "a"), testCID(t, cid.DagProtobuf, "b")
+	shard := testCID(t, 0x0202, "shard") // CAR
+
+	// Log lines, including ones that mention CIDs and JSON-looking
+	// progress events, must not show up in the result.
+	out := fmt.Sprintf(`uploading shard %s
+{"event":"progress","bytes":100}
+{"source":"/tmp/a","root":%q,"shards":[%q],"bytes":100,"replicas":3}
+stored %s
+{"source":"/tmp/b","root":%q,"shards":[],"bytes":5,"replicas":3}
+`, shard, rootA, shard, rootB, rootB)
+
+	res, err := parseUpload(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Sources) != 2 {
+		t.Fatalf("got %d sources, want 2: %+v", len(res.Sources), res)
+	}
+	if got, ok := res.Root("/tmp/b"); !ok || got != rootB {
+		t.Errorf("Root(/tmp/b) = %q, %v", got, ok)
+	}
+	if got := res.Roots(); got[0] != rootA || got[1] != rootB {
+		t.Errorf("Roots() = %v", got)
+	}
+	if res.Bytes() != 105 {
+		t.Errorf("Bytes() = %d, want 105", res.Bytes())
+	}
+	if s := res.Sources[0]; len(s.Shards) != 1 || s.Shards[0] != shard || s.Replicas != 3 {
+		t.Errorf("source a: %+v", s)
+	}
+
+	bad := map[string]string{
+		"empty":       "",
+		"no roots":    "nothing to upload\n",
+		"bad root":    `{"source":"/tmp/a","root":"bafynope"}`,
+		"bad shard":   fmt.Sprintf(`{"source":"/tmp/a","root":%q,"shards":["x"]}`, rootA),
+		"broken json": `{"source":`,
+	}
+	for name, out := range bad {
+		if _, err := parseUpload(out); err == nil {
+			t.Errorf("%s: want error", name)
+		}
+	}
+}
+
+func TestParseSpace(t *testing.T) {
+	const spaceDID = "did:key:z6MkhaXgBZDvotDkL5257faiztiGiC2QtKLGpbnnEGta2doK"
+	space, err := parseSpace("generating space\n" + `{"did":"` + spaceDID + `","name":"test"}` + "\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if space.DID != spaceDID || space.Name != "test" {
+		t.Errorf("got %+v", space)
+	}
+
+	for _, out := range []string{"no space here", `{"did":"nope"}`, `{"did":"` + spaceDID + `"}` + "\n" + `{"did":"` + spaceDID + `"}`} {
+		if _, err := parseSpace(out); err == nil {
+			t.Errorf("%q: want error", out)
+		}
+	}
+}
+
+func TestParseRetrieve(t *testing.T) {
+	root := testCID(t, cid.DagProtobuf, "a")
+	res, err := parseRetrieve(fmt.Sprintf(`{"cid":%q,"path":"/tmp/out","bytes":42}`, root))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.CID != root || res.Path != "/tmp/out" || res.Bytes != 42 {
+		t.Errorf("got %+v", res)
+	}
+	if _, err := parseRetrieve("done\n"); err == nil {
+		t.Error("want error without a result record")
+	}
+}
+
+func TestTextFallback(t *testing.T) {
+	// What a guppy without --json prints for each command the client can
+	// still read.
+	const spaceDID = "did:key:z6MkhaXgBZDvotDkL5257faiztiGiC2QtKLGpbnnEGta2doK"
+	space, err := parseSpace("Generated space " + spaceDID + "\n")
+	if err != nil || space.DID != spaceDID {
+		t.Errorf("space generate: got %+v, %v", space, err)
+	}
+	agent, err := parseAgent(spaceDID + "\n")
+	if err != nil || agent != spaceDID {
+		t.Errorf("whoami: got %q, %v", agent, err)
+	}
+
+	rootA, rootB := testCID(t, cid.DagProtobuf, "a"), testCID(t, cid.DagProtobuf, "b")
+	shard := testCID(t, 0x0202, "shard")
+	res, err := parseUpload(fmt.Sprintf("stored shard %s\nuploaded %s\nuploaded %s\nroot %s\n", shard, rootA, rootB, rootA))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := res.Roots(); len(got) != 2 || got[0] != rootA || got[1] != rootB {
+		t.Errorf("upload: roots %v, want [%s %s]", got, rootA, rootB)
+	}
+
+	var gotArgs []string
+	run := func(ctx context.Context, args ...string) (string, string, error) {
+		gotArgs = args
+		return "Retrieved to /tmp/out\n", "", nil
+	}
+	r, err := retrieve(t.Context(), run, spaceDID, rootA, "/tmp/out")
+	if err != nil || r.CID != rootA || r.Path != "/tmp/out" {
+		t.Errorf("retrieve: got %+v, %v (args %v)", r, err, gotArgs)
+	}
+
+	// Text with nothing the fallback recognises keeps the NotJSONError.
+	var notJSON *NotJSONError
+	if _, err := parseSpace("no space here\n"); !errors.As(err, &notJSON) {
+		t.Errorf("space generate without a DID: want *NotJSONError, got %v", err)
+	}
+}
+
+func TestDecodeRecordsNotJSON(t *testing.T) {
+	// What a guppy without --json prints for `space ls`.
+	const human = "did:key:z6MkhaXgBZDvotDkL5257faiztiGiC2QtKLGpbnnEGta2doK  test\n"
+	_, err := decodeRecords("space ls", human, func(s Space) bool { return s.DID != "" })
+	var notJSON *NotJSONError
+	if !errors.As(err, &notJSON) {
+		t.Fatalf("want *NotJSONError, got %v", err)
+	}
+	if notJSON.Command != "space ls" || notJSON.Stdout != human {
+		t.Errorf("error = %+v", notJSON)
+	}
+	if !strings.Contains(err.Error(), "guppy space ls") || !strings.Contains(err.Error(), human) {
+		t.Errorf("message doesn't name the command and output: %q", err)
+	}
+
+	// No output at all is an empty listing, not a format problem.
+	spaces, err := decodeRecords("space ls", "\n", func(s Space) bool { return s.DID != "" })
+	if err != nil || len(spaces) != 0 {
+		t.Errorf("empty output: got %v, %v", spaces, err)
+	}
+}
@@ -13,8 +13,9 @@ import (
 )
 
 type messagesConfig struct {
-	page     int
-	pageSize int
+	page        int
+	pageSize    int
+	searchTerms string
 }
 
 type MessagesOption func(*messagesConfig)
@@ -31,6 +32,14 @@ func WithPageSize(pageSize int) MessagesOption {
 	}
 }
 
+// WithSearchTerms narrows the listing to messages whose subject, sender or
+// recipients contain terms.
+func WithSearchTerms(terms string) MessagesOption {
+	return func(c *messagesConfig) {
+		c.searchTerms = terms
+	}
+}
+
 type Option func(*Client)
 
 func WithHTTPClient(httpClient *http.Client) Option {
@@ -69,6 +78,9 @@ func (c *Client) Messages(ctx context.Context, options ...MessagesOption) (Messa
 	query := url.Query()
 	query.Set("page", strconv.Itoa(config.page))
 	query.Set("pageSize", strconv.Itoa(config.pageSize))
+	if config.searchTerms != "" {
+		query.Set("searchTerms", config.searchTerms)
+	}
 	url.RawQuery = query.Encode()
 
 	return jsonRequest[MessagePage](ctx, c.client, http.MethodGet, url.String(), nil)
@@ -96,11 +108,81 @@ func (c *Client) MessageBodyPlainText(ctx context.Context, id uuid.UUID) (string
 	return string(body), nil
 }
 
+// MessageBodyHTML returns the HTML body of the message with the given ID
+// if there is one.
+func (c *Client) MessageBodyHTML(ctx context.Context, id uuid.UUID) (string, error) {
+	url := c.endpoint.JoinPath("api", "messages", id.String(), "html")
+	body, err := request(ctx, c.client, http.MethodGet, url.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	return string(body), nil
+}
+
+// MessageSource returns the message exactly as the SMTP server received it,
+// headers and MIME parts included. See [ParseMIME].
+func (c *Client) MessageSource(ctx context.Context, id uuid.UUID) ([]byte, error) {
+	url := c.endpoint.JoinPath("api", "messages", id.String(), "source")
+	return request(ctx, c.client, http.MethodGet, url.String(), nil)
+}
+
+// MessageMIME fetches the message's source and parses it.
+func (c *Client) MessageMIME(ctx context.Context, id uuid.UUID) (*MIMEMessage, error) {
+	source, err := c.MessageSource(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return ParseMIME(source)
+}
+
+// Attachments returns the attachments of the message with the given ID,
+// from all of its MIME parts.
+func (c *Client) Attachments(ctx context.Context, id uuid.UUID) ([]Attachment, error) {
+	msg, err := c.Message(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	var attachments []Attachment
+	var walk func(parts []MessageEntity)
+	walk = func(parts []MessageEntity) {
+		for _, part := range parts {
+			attachments = append(attachments, part.Attachments...)
+			walk(part.ChildParts)
+		}
+	}
+	walk(msg.Parts)
+	return attachments, nil
+}
+
+// AttachmentContent returns the decoded content of an attachment of the
+// message with the given ID.
+func (c *Client) AttachmentContent(ctx context.Context, id uuid.UUID, attachment Attachment) ([]byte, error) {
+	url := c.endpoint.JoinPath("api", "messages", id.String(), "part", attachment.ID, "content")
+	return request(ctx, c.client, http.MethodGet, url.String(), nil)
+}
+
+// MarkRead marks the message with the given ID as read.
+func (c *Client) MarkRead(ctx context.Context, id uuid.UUID) error {
+	url := c.endpoint.JoinPath("api", "messages", id.String(), "markRead")
+	_, err := request(ctx, c.client, http.MethodPost, url.String(), nil)
+	return err
+}
+
+// DeleteAllMessages deletes every message on the server.
+func (c *Client) DeleteAllMessages(ctx context.Context) error {
+	url := c.endpoint.JoinPath("api", "messages", "*")
+	_, err := request(ctx, c.client, http.MethodDelete, url.String(), nil)
+	return err
+}
+
 func request(ctx context.Context, client *http.Client, method string, url string, body io.Reader) ([]byte, error) {
 	req, err := http.NewRequestWithContext(ctx, method, url, body)
 	if err != nil {
 		return nil, fmt.Errorf("creating request: %w", err)
 	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
 	res, err := client.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("sending request: %w", err)
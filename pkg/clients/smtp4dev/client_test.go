@@ -0,0 +1,211 @@
+package smtp4dev
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// fakeServer serves canned smtp4dev API responses, one message per page so
+// paging is exercised.
+type fakeServer struct {
+	mu       sync.Mutex
+	messages []MessageResult
+	settings map[string]any
+	requests []string
+}
+
+func (f *fakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests = append(f.requests, r.Method+" "+r.URL.Path)
+
+	switch {
+	case r.URL.Path == "/api/messages":
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		res := MessagePage{CurrentPage: page, PageCount: len(f.messages)}
+		if page < len(f.messages) {
+			res.Results = []MessageResult{f.messages[page]}
+		}
+		json.NewEncoder(w).Encode(res)
+	case r.URL.Path == "/api/server" && r.Method == http.MethodGet:
+		json.NewEncoder(w).Encode(f.settings)
+	case r.URL.Path == "/api/server":
+		f.settings = map[string]any{}
+		json.NewDecoder(r.Body).Decode(&f.settings)
+	case r.Method == http.MethodGet && len(r.URL.Path) == len("/api/messages/")+36:
+		id := uuid.MustParse(r.URL.Path[len("/api/messages/"):])
+		json.NewEncoder(w).Encode(Message{
+			ID: id,
+			Parts: []MessageEntity{{
+				ChildParts: []MessageEntity{{Attachments: []Attachment{{FileName: "a.txt", ID: "1.2"}}}},
+			}},
+		})
+	default:
+		io.WriteString(w, "content")
+	}
+}
+
+func (f *fakeServer) add(msg MessageResult) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.messages = append(f.messages, msg)
+}
+
+func newFake(t *testing.T) (*fakeServer, *Client) {
+	t.Helper()
+	fake := &fakeServer{}
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+	c, err := New(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fake, c
+}
+
+func TestFilter(t *testing.T) {
+	now := time.Now()
+	msg := MessageResult{
+		DeliveredTo:  "alice@example.com",
+		To:           []string{"Alice <Alice@Example.com>"},
+		From:         "Storacha <noreply@storacha.network>",
+		Subject:      "Verify your email address",
+		ReceivedDate: now,
+		IsUnread:     true,
+	}
+	tests := []struct {
+		filter Filter
+		want   bool
+	}{
+		{Filter{}, true},
+		{Filter{To: "ALICE@example.com"}, true},
+		{Filter{To: "bob@example.com"}, false},
+		{Filter{From: "noreply@storacha.network"}, true},
+		{Filter{Subject: "verify"}, true},
+		{Filter{Subject: "welcome"}, false},
+		{Filter{Since: now.Add(-time.Minute), Unread: true}, true},
+		{Filter{Since: now.Add(time.Minute)}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.filter.Matches(msg); got != tt.want {
+			t.Errorf("%s.Matches = %v, want %v", tt.filter, got, tt.want)
+		}
+	}
+
+	// The envelope recipient alone is enough.
+	if !(Filter{To: "bcc@example.com"}).Matches(MessageResult{DeliveredTo: "bcc@example.com"}) {
+		t.Error("envelope recipient not matched")
+	}
+}
+
+func TestSearch(t *testing.T) {
+	fake, c := newFake(t)
+	fake.add(MessageResult{ID: uuid.New(), DeliveredTo: "alice@example.com", Subject: "one"})
+	fake.add(MessageResult{ID: uuid.New(), DeliveredTo: "bob@example.com", Subject: "two"})
+	fake.add(MessageResult{ID: uuid.New(), DeliveredTo: "alice@example.com", Subject: "three"})
+
+	matches, err := c.Search(t.Context(), Filter{To: "alice@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 2 || matches[0].Subject != "one" || matches[1].Subject != "three" {
+		t.Errorf("matches = %+v", matches)
+	}
+}
+
+func TestWaitForMessage(t *testing.T) {
+	fake, c := newFake(t)
+	id := uuid.New()
+	time.AfterFunc(150*time.Millisecond, func() {
+		fake.add(MessageResult{ID: id, DeliveredTo: "alice@example.com"})
+	})
+
+	ctx, cancel := context.WithTimeout(t.Context(), 5*time.Second)
+	defer cancel()
+	msg, err := c.WaitForMessage(ctx, Filter{To: "alice@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.ID != id {
+		t.Errorf("message = %v, want %v", msg.ID, id)
+	}
+
+	ctx, cancel = context.WithTimeout(t.Context(), 200*time.Millisecond)
+	defer cancel()
+	if _, err := c.WaitForMessage(ctx, Filter{To: "nobody@example.com"}); err == nil {
+		t.Error("want error when no message arrives")
+	}
+}
+
+func TestMessageEndpoints(t *testing.T) {
+	fake, c := newFake(t)
+	ctx := t.Context()
+	id := uuid.New()
+
+	attachments, err := c.Attachments(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(attachments) != 1 || attachments[0].FileName != "a.txt" {
+		t.Fatalf("attachments = %+v", attachments)
+	}
+	if _, err := c.AttachmentContent(ctx, id, attachments[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.MarkRead(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.DeleteAllMessages(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"GET /api/messages/" + id.String(),
+		"GET /api/messages/" + id.String() + "/part/1.2/content",
+		"POST /api/messages/" + id.String() + "/markRead",
+		"DELETE /api/messages/*",
+	}
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	for i, w := range want {
+		if fake.requests[i] != w {
+			t.Errorf("request %d = %q, want %q", i, fake.requests[i], w)
+		}
+	}
+}
+
+func TestUpdateServerSettings(t *testing.T) {
+	fake, c := newFake(t)
+	fake.settings = map[string]any{"port": 25, "numberOfMessagesToKeep": 100, "tlsMode": "None"}
+
+	settings, err := c.ServerSettings(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settings.Port != 25 {
+		t.Errorf("settings = %+v", settings)
+	}
+	settings.NumberOfMessagesToKeep = 1000
+	if err := c.UpdateServerSettings(t.Context(), settings); err != nil {
+		t.Fatal(err)
+	}
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	if fake.settings["numberOfMessagesToKeep"] != float64(1000) {
+		t.Errorf("numberOfMessagesToKeep = %v", fake.settings["numberOfMessagesToKeep"])
+	}
+	// Settings ServerSettings doesn't model survive the update.
+	if fake.settings["tlsMode"] != "None" {
+		t.Errorf("tlsMode = %v", fake.settings["tlsMode"])
+	}
+}
@@ -0,0 +1,149 @@
+package smtp4dev
+
+import (
+	"context"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+// WaitForMessage polls with exponential backoff between these bounds.
+const (
+	minPollInterval = 100 * time.Millisecond
+	maxPollInterval = 2 * time.Second
+)
+
+// Filter selects messages by their summary fields. Zero fields match
+// anything.
+type Filter struct {
+	// To is a recipient address, matched case-insensitively against the
+	// envelope recipient and the To header.
+	To string
+	// From is matched case-insensitively against the sender address.
+	From string
+	// Subject must be contained in the subject, ignoring case.
+	Subject string
+	// Since excludes messages received before it.
+	Since time.Time
+	// Unread excludes messages that have been read.
+	Unread bool
+}
+
+func (f Filter) String() string {
+	var parts []string
+	if f.To != "" {
+		parts = append(parts, "to="+f.To)
+	}
+	if f.From != "" {
+		parts = append(parts, "from="+f.From)
+	}
+	if f.Subject != "" {
+		parts = append(parts, fmt.Sprintf("subject=%q", f.Subject))
+	}
+	if !f.Since.IsZero() {
+		parts = append(parts, "since="+f.Since.Format(time.RFC3339))
+	}
+	if f.Unread {
+		parts = append(parts, "unread")
+	}
+	return "{" + strings.Join(parts, " ") + "}"
+}
+
+// Matches reports whether msg passes the filter.
+func (f Filter) Matches(msg MessageResult) bool {
+	if f.To != "" && !sentTo(msg, f.To) {
+		return false
+	}
+	if f.From != "" && !strings.EqualFold(address(msg.From), f.From) {
+		return false
+	}
+	if f.Subject != "" && !strings.Contains(strings.ToLower(msg.Subject), strings.ToLower(f.Subject)) {
+		return false
+	}
+	if !f.Since.IsZero() && msg.ReceivedDate.Before(f.Since) {
+		return false
+	}
+	if f.Unread && !msg.IsUnread {
+		return false
+	}
+	return true
+}
+
+// searchTerms picks the most selective field for smtp4dev to search on, so
+// only likely matches have to be paged through.
+func (f Filter) searchTerms() string {
+	switch {
+	case f.To != "":
+		return f.To
+	case f.Subject != "":
+		return f.Subject
+	default:
+		return f.From
+	}
+}
+
+// Search returns every message matching filter, across all pages.
+func (c *Client) Search(ctx context.Context, filter Filter) ([]MessageResult, error) {
+	var matches []MessageResult
+	for page := 0; ; page++ {
+		msgPage, err := c.Messages(ctx, WithSearchTerms(filter.searchTerms()), WithPage(page))
+		if err != nil {
+			return nil, err
+		}
+		for _, msg := range msgPage.Results {
+			if filter.Matches(msg) {
+				matches = append(matches, msg)
+			}
+		}
+		if page >= msgPage.PageCount-1 {
+			return matches, nil
+		}
+	}
+}
+
+// WaitForMessage polls until a message matching filter arrives and returns
+// it. Use the context to bound the wait.
+func (c *Client) WaitForMessage(ctx context.Context, filter Filter) (Message, error) {
+	interval := minPollInterval
+	for {
+		matches, err := c.Search(ctx, filter)
+		if err != nil && ctx.Err() == nil {
+			return Message{}, fmt.Errorf("searching messages: %w", err)
+		}
+		if len(matches) > 0 {
+			return c.Message(ctx, matches[0].ID)
+		}
+
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return Message{}, fmt.Errorf("waiting for message matching %s: %w", filter, context.Cause(ctx))
+		}
+		interval = min(interval*2, maxPollInterval)
+	}
+}
+
+// sentTo reports whether the message was addressed to email, either on the
+// envelope or in its To header.
+func sentTo(msg MessageResult, email string) bool {
+	if strings.EqualFold(msg.DeliveredTo, email) {
+		return true
+	}
+	for _, to := range msg.To {
+		if strings.EqualFold(address(to), email) {
+			return true
+		}
+	}
+	return false
+}
+
+// address returns the bare address of a header value like
+// "Name <user@host>", or the value itself if it doesn't parse.
+func address(value string) string {
+	addr, err := mail.ParseAddress(value)
+	if err != nil {
+		return value
+	}
+	return addr.Address
+}
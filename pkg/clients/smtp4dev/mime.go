@@ -0,0 +1,131 @@
+package smtp4dev
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+)
+
+// MIMEMessage is a message parsed from its source, with transfer encodings
+// undone.
+type MIMEMessage struct {
+	Header mail.Header
+	// Subject is the decoded Subject header.
+	Subject string
+	// Text is the first text/plain part that isn't an attachment.
+	Text string
+	// HTML is the first text/html part that isn't an attachment.
+	HTML        string
+	Attachments []MIMEAttachment
+}
+
+// MIMEAttachment is a part of a message sent as an attachment.
+type MIMEAttachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// ParseMIME parses a raw RFC 5322 message, walking nested multipart bodies
+// for its text, HTML and attachments. Charsets other than UTF-8 are not
+// converted.
+func ParseMIME(source []byte) (*MIMEMessage, error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(source))
+	if err != nil {
+		return nil, fmt.Errorf("reading message: %w", err)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		subject = msg.Header.Get("Subject")
+	}
+	m := &MIMEMessage{Header: msg.Header, Subject: subject}
+	if err := m.addPart(textproto.MIMEHeader(msg.Header), msg.Body); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (m *MIMEMessage) addPart(header textproto.MIMEHeader, body io.Reader) error {
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		// RFC 2045 defaults untyped bodies to plain text
+		mediaType, params = "text/plain", nil
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := mr.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("reading %s part: %w", mediaType, err)
+			}
+			if err := m.addPart(part.Header, part); err != nil {
+				return err
+			}
+		}
+	}
+
+	data, err := io.ReadAll(decodeTransfer(header.Get("Content-Transfer-Encoding"), body))
+	if err != nil {
+		return fmt.Errorf("decoding %s part: %w", mediaType, err)
+	}
+
+	disposition, dispParams, _ := mime.ParseMediaType(header.Get("Content-Disposition"))
+	filename := dispParams["filename"]
+	if filename == "" {
+		filename = params["name"]
+	}
+	switch {
+	case disposition == "attachment" || filename != "":
+		m.Attachments = append(m.Attachments, MIMEAttachment{
+			Filename:    filename,
+			ContentType: mediaType,
+			Data:        data,
+		})
+	case mediaType == "text/plain" && m.Text == "":
+		m.Text = string(data)
+	case mediaType == "text/html" && m.HTML == "":
+		m.HTML = string(data)
+	}
+	return nil
+}
+
+func decodeTransfer(encoding string, r io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, spaceStripper{r})
+	case "quoted-printable":
+		return quotedprintable.NewReader(r)
+	default:
+		return r
+	}
+}
+
+// spaceStripper drops whitespace from base64 bodies: encoding/base64 skips
+// the line breaks they are wrapped with, but not the trailing spaces some
+// senders pad lines with.
+type spaceStripper struct {
+	r io.Reader
+}
+
+func (s spaceStripper) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	j := 0
+	for _, b := range p[:n] {
+		if b != '\r' && b != '\n' && b != ' ' && b != '\t' {
+			p[j] = b
+			j++
+		}
+	}
+	return j, err
+}
@@ -0,0 +1,72 @@
+package smtp4dev
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseMIME(t *testing.T) {
+	source := strings.ReplaceAll(`From: Storacha <noreply@storacha.network>
+To: alice@example.com
+Subject: =?UTF-8?Q?Verify_your_email_=E2=9C=93?=
+MIME-Version: 1.0
+Content-Type: multipart/mixed; boundary="outer"
+
+--outer
+Content-Type: multipart/alternative; boundary="inner"
+
+--inner
+Content-Type: text/plain; charset=utf-8
+
+Click http://upload/validate-email?ucan=abc
+--inner
+Content-Type: text/html; charset=utf-8
+Content-Transfer-Encoding: quoted-printable
+
+<a href=3D"http://upload/validate-email?ucan=3Dabc">Verify</a>
+--inner--
+
+--outer
+Content-Type: application/octet-stream; name="receipt.bin"
+Content-Disposition: attachment; filename="receipt.bin"
+Content-Transfer-Encoding: base64
+
+aGVsbG8g
+d29ybGQ=
+--outer--
+`, "\n", "\r\n")
+
+	m, err := ParseMIME([]byte(source))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Subject != "Verify your email ✓" {
+		t.Errorf("subject = %q", m.Subject)
+	}
+	if m.Header.Get("To") != "alice@example.com" {
+		t.Errorf("to = %q", m.Header.Get("To"))
+	}
+	if m.Text != "Click http://upload/validate-email?ucan=abc" {
+		t.Errorf("text = %q", m.Text)
+	}
+	if m.HTML != `<a href="http://upload/validate-email?ucan=abc">Verify</a>` {
+		t.Errorf("html = %q", m.HTML)
+	}
+	if len(m.Attachments) != 1 {
+		t.Fatalf("attachments = %+v", m.Attachments)
+	}
+	a := m.Attachments[0]
+	if a.Filename != "receipt.bin" || a.ContentType != "application/octet-stream" || string(a.Data) != "hello world" {
+		t.Errorf("attachment = %+v (%q)", a, a.Data)
+	}
+}
+
+func TestParseMIMESinglePart(t *testing.T) {
+	m, err := ParseMIME([]byte("Subject: hi\r\n\r\njust text\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Subject != "hi" || m.Text != "just text\r\n" || m.HTML != "" || len(m.Attachments) != 0 {
+		t.Errorf("message = %+v", m)
+	}
+}
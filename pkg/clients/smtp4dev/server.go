@@ -0,0 +1,61 @@
+package smtp4dev
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// ServerSettings are the smtp4dev server settings tests are likely to
+// touch. smtp4dev has many more; UpdateServerSettings leaves those as they
+// are.
+type ServerSettings struct {
+	IsRunning                  bool     `json:"isRunning"`
+	Exception                  string   `json:"exception"`
+	HostName                   string   `json:"hostName"`
+	Port                       int      `json:"port"`
+	ImapPort                   int      `json:"imapPort"`
+	AllowRemoteConnections     bool     `json:"allowRemoteConnections"`
+	NumberOfMessagesToKeep     int      `json:"numberOfMessagesToKeep"`
+	NumberOfSessionsToKeep     int      `json:"numberOfSessionsToKeep"`
+	AuthenticationRequired     bool     `json:"authenticationRequired"`
+	SmtpAllowAnyCredentials    bool     `json:"smtpAllowAnyCredentials"`
+	DisableMessageSanitisation bool     `json:"disableMessageSanitisation"`
+	RelaySmtpServer            string   `json:"relaySmtpServer"`
+	RelaySmtpPort              int      `json:"relaySmtpPort"`
+	RelayAutomaticEmails       []string `json:"relayAutomaticEmails"`
+}
+
+// ServerSettings returns the server's current settings.
+func (c *Client) ServerSettings(ctx context.Context) (ServerSettings, error) {
+	url := c.endpoint.JoinPath("api", "server")
+	return jsonRequest[ServerSettings](ctx, c.client, http.MethodGet, url.String(), nil)
+}
+
+// UpdateServerSettings applies settings to the server. smtp4dev replaces
+// its whole configuration on update, so the settings not modelled by
+// [ServerSettings] are read back first and sent along unchanged. The server
+// restarts its listeners if ports change.
+func (c *Client) UpdateServerSettings(ctx context.Context, settings ServerSettings) error {
+	url := c.endpoint.JoinPath("api", "server")
+	current, err := jsonRequest[map[string]json.RawMessage](ctx, c.client, http.MethodGet, url.String(), nil)
+	if err != nil {
+		return fmt.Errorf("reading current settings: %w", err)
+	}
+	updated, err := json.Marshal(settings)
+	if err != nil {
+		return fmt.Errorf("encoding settings: %w", err)
+	}
+	if err := json.Unmarshal(updated, &current); err != nil {
+		return fmt.Errorf("merging settings: %w", err)
+	}
+	body, err := json.Marshal(current)
+	if err != nil {
+		return fmt.Errorf("encoding settings: %w", err)
+	}
+
+	_, err = request(ctx, c.client, http.MethodPost, url.String(), bytes.NewReader(body))
+	return err
+}
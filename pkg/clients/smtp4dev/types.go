@@ -54,7 +54,7 @@ type Message struct {
 type MessageEntity struct {
 	ID           string           `json:"id"`
 	Headers      []Header         `json:"headers"`
-	ChildParts   []string         `json:"childParts"`
+	ChildParts   []MessageEntity  `json:"childParts"`
 	Name         string           `json:"name"`
 	MessageID    uuid.UUID        `json:"messageId"`
 	ContentID    string           `json:"contentId"`
@@ -2,7 +2,10 @@
 // concrete node configurations ready for compose generation.
 package manifest
 
-import "fmt"
+import (
+	"fmt"
+	"path"
+)
 
 const (
 	// MaxPiriNodes is limited by the number of Anvil pre-funded accounts.
@@ -18,8 +21,52 @@ const (
 
 // Manifest is the top-level smelt.yml schema.
 type Manifest struct {
-	Version int      `yaml:"version"`
-	Piri    PiriSpec `yaml:"piri"`
+	Version  int          `yaml:"version"`
+	Piri     PiriSpec     `yaml:"piri"`
+	Snapshot SnapshotSpec `yaml:"snapshot,omitempty"`
+}
+
+// SnapshotSpec narrows which compose volumes `smelt snapshot save`
+// archives. By default every named volume mounted by a service in the
+// resolved compose config is captured. Patterns use path.Match syntax
+// against the compose volume name (e.g. "piri-*-data", "grafana-data").
+type SnapshotSpec struct {
+	// Include, if non-empty, limits the snapshot to volumes matching at
+	// least one pattern.
+	Include []string `yaml:"include,omitempty"`
+	// Exclude drops volumes matching any pattern. Applied after Include.
+	Exclude []string `yaml:"exclude,omitempty"`
+}
+
+// Selects reports whether the volume named vol belongs in a snapshot.
+func (s SnapshotSpec) Selects(vol string) (bool, error) {
+	if len(s.Include) > 0 {
+		ok, err := matchAny(s.Include, vol)
+		if err != nil {
+			return false, fmt.Errorf("manifest: snapshot.include: %w", err)
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+	excluded, err := matchAny(s.Exclude, vol)
+	if err != nil {
+		return false, fmt.Errorf("manifest: snapshot.exclude: %w", err)
+	}
+	return !excluded, nil
+}
+
+func matchAny(patterns []string, name string) (bool, error) {
+	for _, p := range patterns {
+		ok, err := path.Match(p, name)
+		if err != nil {
+			return false, fmt.Errorf("pattern %q: %w", p, err)
+		}
+		if ok {
+			return true, nil
+		}
+	}
+	return false, nil
 }
 
 // PiriSpec describes the desired piri node topology.
@@ -137,3 +184,19 @@ func firstNonEmpty(vals ...string) string {
 	}
 	return ""
 }
+
+// FromResolved builds a manifest that resolves back to nodes. Used when
+// the topology came from somewhere other than a smelt.yml — e.g. a
+// pkg/stack test stack configured via options — and needs writing out
+// as one. Auto-generated names are left implicit.
+func FromResolved(nodes []ResolvedPiriNode) *Manifest {
+	m := &Manifest{Version: 1}
+	for i, n := range nodes {
+		spec := PiriNodeSpec{Image: n.Image, Storage: n.Storage}
+		if n.Name != fmt.Sprintf("piri-%d", i) {
+			spec.Name = n.Name
+		}
+		m.Piri.Nodes = append(m.Piri.Nodes, spec)
+	}
+	return m
+}
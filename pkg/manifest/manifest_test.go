@@ -1,7 +1,10 @@
 package manifest
 
 import (
+	"reflect"
 	"testing"
+
+	"gopkg.in/yaml.v3"
 )
 
 func TestParseCountForm(t *testing.T) {
@@ -233,3 +236,66 @@ piri:
 		}
 	}
 }
+
+func TestFromResolvedRoundTrip(t *testing.T) {
+	want := []ResolvedPiriNode{
+		{Name: "piri-0", Index: 0, Storage: StorageSpec{DB: DBSQLite, Blob: BlobFS}},
+		{Name: "edge", Index: 1, Image: "piri:dev", Storage: StorageSpec{DB: DBPostgres, Blob: BlobS3}},
+	}
+	data, err := yaml.Marshal(FromResolved(want))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := ParseBytes(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := m.Resolve()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("round trip mismatch:\n got  %+v\n want %+v\nyaml:\n%s", got, want, data)
+	}
+}
+
+func TestSnapshotSelects(t *testing.T) {
+	data := []byte(`
+version: 1
+piri:
+  count: 1
+snapshot:
+  include: ["piri-*", "guppy-data", "upload-postgres-data"]
+  exclude: ["piri-minio-data"]
+`)
+	m, err := ParseBytes(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string]bool{
+		"piri-0-data":          true,
+		"piri-postgres-data":   true,
+		"piri-minio-data":      false,
+		"guppy-data":           true,
+		"upload-postgres-data": true,
+		"minio-data":           false,
+	}
+	for vol, want := range cases {
+		got, err := m.Snapshot.Selects(vol)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("Selects(%q) = %v, want %v", vol, got, want)
+		}
+	}
+
+	var all SnapshotSpec
+	if ok, _ := all.Selects("anything"); !ok {
+		t.Error("empty spec should select every volume")
+	}
+	bad := SnapshotSpec{Exclude: []string{"["}}
+	if _, err := bad.Selects("x"); err == nil {
+		t.Error("expected error for malformed pattern")
+	}
+}
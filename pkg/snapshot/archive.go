@@ -0,0 +1,506 @@
+package snapshot
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Volume archive formats, in the order openVolumeArchive prefers them. A
+// snapshot holds exactly one of these per volume; the extension is the
+// only format marker, so older plain-tar snapshots keep loading unchanged.
+const (
+	// extChunked is a JSON chunkIndex whose chunks live in the shared
+	// chunk store next to the snapshot directory.
+	extChunked = ".chunks.json"
+	// extZstd is a zstd-compressed tar, the default since compression
+	// landed.
+	extZstd = ".tar.zst"
+	// extTar is an uncompressed tar, written by snapshots that predate
+	// compression.
+	extTar = ".tar"
+)
+
+// ChunkStoreDir is the name of the content-addressed chunk store shared
+// by every chunked snapshot under the same parent directory (e.g.
+// generated/snapshots/.chunks/). The leading dot keeps List from treating
+// it as a snapshot.
+const ChunkStoreDir = ".chunks"
+
+// Content-defined chunking bounds. Cut points are chosen by a rolling
+// hash over the uncompressed tar stream, so a file that shifts by a few
+// bytes between two saves still produces mostly identical chunks.
+const (
+	chunkMinSize = 256 << 10
+	chunkMaxSize = 4 << 20
+	// chunkMask yields a ~1 MiB average chunk past the minimum.
+	chunkMask = 1<<20 - 1
+)
+
+// chunkIndex is the on-disk form of a chunked volume archive: the ordered
+// list of chunks whose concatenation is the volume's tar stream.
+type chunkIndex struct {
+	Size   int64      `json:"size"`
+	Chunks []chunkRef `json:"chunks"`
+}
+
+type chunkRef struct {
+	// Digest is the "sha256:<hex>" digest of the UNCOMPRESSED chunk, so
+	// the same bytes dedupe regardless of compression settings.
+	Digest string `json:"digest"`
+	Size   int64  `json:"size"`
+}
+
+// chunkStoreFor returns the chunk store a snapshot directory reads from:
+// a sibling of the snapshot itself.
+func chunkStoreFor(snapshotDir string) string {
+	return filepath.Join(filepath.Dir(snapshotDir), ChunkStoreDir)
+}
+
+// chunkPath maps a chunk digest to its compressed file in the store.
+func chunkPath(storeDir, digest string) string {
+	return filepath.Join(storeDir, strings.TrimPrefix(digest, digestPrefix)+".zst")
+}
+
+// writeVolumeArchive consumes a tar stream and writes it into volsDir as
+// either a zstd-compressed tar or, when storeDir is set, a chunk index
+// plus any chunks the store doesn't already hold.
+func writeVolumeArchive(r io.Reader, volsDir, volName, storeDir string) error {
+	if storeDir == "" {
+		return writeZstd(r, filepath.Join(volsDir, volName+extZstd))
+	}
+	unlock, err := lockChunkStore(filepath.Dir(storeDir), false)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	idx, err := writeChunks(r, storeDir)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(idx, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal chunk index: %w", err)
+	}
+	return os.WriteFile(filepath.Join(volsDir, volName+extChunked), data, 0644)
+}
+
+// writeZstd compresses r into a new file at dst, via a temp file so a
+// failed write never leaves a truncated archive under the final name. The
+// temp name is unique, so concurrent saves storing the same chunk in a
+// shared store each write their own file and the last rename wins.
+func writeZstd(r io.Reader, dst string) error {
+	f, err := os.CreateTemp(filepath.Dir(dst), filepath.Base(dst)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	defer os.Remove(tmp)
+	defer f.Close()
+	// CreateTemp makes the file private; chunk stores are shared.
+	if err := f.Chmod(0644); err != nil {
+		return err
+	}
+
+	zw, err := zstd.NewWriter(f)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(zw, r); err != nil {
+		zw.Close()
+		return fmt.Errorf("compress %s: %w", filepath.Base(dst), err)
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, dst)
+}
+
+// writeChunks splits r at content-defined boundaries and stores each
+// chunk (zstd-compressed) in storeDir unless an identical chunk is
+// already there.
+func writeChunks(r io.Reader, storeDir string) (*chunkIndex, error) {
+	if err := os.MkdirAll(storeDir, 0755); err != nil {
+		return nil, fmt.Errorf("create chunk store: %w", err)
+	}
+	idx := &chunkIndex{}
+	br := bufio.NewReaderSize(r, 1<<20)
+	buf := make([]byte, 0, chunkMaxSize)
+	var h uint64
+	flush := func() error {
+		if len(buf) == 0 {
+			return nil
+		}
+		sum := sha256.Sum256(buf)
+		digest := digestPrefix + hex.EncodeToString(sum[:])
+		p := chunkPath(storeDir, digest)
+		if _, err := os.Stat(p); errors.Is(err, fs.ErrNotExist) {
+			if err := writeZstd(bytes.NewReader(buf), p); err != nil {
+				return fmt.Errorf("store chunk: %w", err)
+			}
+		} else if err != nil {
+			return err
+		}
+		idx.Chunks = append(idx.Chunks, chunkRef{Digest: digest, Size: int64(len(buf))})
+		idx.Size += int64(len(buf))
+		buf = buf[:0]
+		h = 0
+		return nil
+	}
+	for {
+		b, err := br.ReadByte()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read volume stream: %w", err)
+		}
+		buf = append(buf, b)
+		h = h<<1 + gearTable[b]
+		if (len(buf) >= chunkMinSize && h&chunkMask == 0) || len(buf) >= chunkMaxSize {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return idx, nil
+}
+
+// openVolumeArchive returns the uncompressed tar stream for volName from
+// whichever archive format the snapshot holds. Returns an error wrapping
+// fs.ErrNotExist when the snapshot has no archive for the volume.
+func openVolumeArchive(volsDir, volName string) (io.ReadCloser, error) {
+	if p := filepath.Join(volsDir, volName+extChunked); fileExists(p) {
+		idx, err := readChunkIndex(p)
+		if err != nil {
+			return nil, err
+		}
+		return &chunkReader{storeDir: chunkStoreFor(filepath.Dir(volsDir)), chunks: idx.Chunks}, nil
+	}
+	if p := filepath.Join(volsDir, volName+extZstd); fileExists(p) {
+		f, err := os.Open(p)
+		if err != nil {
+			return nil, err
+		}
+		zr, err := zstd.NewReader(f)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("open %s: %w", filepath.Base(p), err)
+		}
+		return &zstdFile{Decoder: zr, f: f}, nil
+	}
+	f, err := os.Open(filepath.Join(volsDir, volName+extTar))
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func readChunkIndex(p string) (*chunkIndex, error) {
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	var idx chunkIndex
+	if err := json.Unmarshal(data, &idx); err != nil {
+		return nil, fmt.Errorf("parse chunk index %s: %w", filepath.Base(p), err)
+	}
+	return &idx, nil
+}
+
+// ChunkFiles returns the chunk-store filenames (relative to the store)
+// referenced by every chunked volume in a snapshot, sorted and
+// de-duplicated. Callers that relocate a snapshot use it to bring the
+// referenced chunks along.
+func ChunkFiles(snapshotDir string) ([]string, error) {
+	return ChunkFilesFS(os.DirFS(snapshotDir), ".")
+}
+
+// ChunkFilesFS is ChunkFiles for a snapshot at dir within fsys, such as
+// one embedded in a binary.
+func ChunkFilesFS(fsys fs.FS, dir string) ([]string, error) {
+	matches, err := fs.Glob(fsys, path.Join(dir, subdirVolumes, "*"+extChunked))
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]struct{})
+	for _, m := range matches {
+		data, err := fs.ReadFile(fsys, m)
+		if err != nil {
+			return nil, err
+		}
+		var idx chunkIndex
+		if err := json.Unmarshal(data, &idx); err != nil {
+			return nil, fmt.Errorf("parse chunk index %s: %w", path.Base(m), err)
+		}
+		for _, c := range idx.Chunks {
+			seen[filepath.Base(chunkPath("", c.Digest))] = struct{}{}
+		}
+	}
+	out := make([]string, 0, len(seen))
+	for f := range seen {
+		out = append(out, f)
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// gcChunks deletes chunks no remaining snapshot under snapsRoot
+// references. Run after a snapshot is removed so the shared store doesn't
+// outlive its users. The staging dirs of saves and pulls still in progress
+// (.<name>.tmp) count as users, and the store lock keeps GC from running
+// while a writer holds chunks it hasn't indexed yet.
+func gcChunks(snapsRoot string) error {
+	storeDir := filepath.Join(snapsRoot, ChunkStoreDir)
+	if !dirExists(storeDir) {
+		return nil
+	}
+	unlock, err := lockChunkStore(snapsRoot, true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	live := make(map[string]struct{})
+	entries, err := os.ReadDir(snapsRoot)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if !e.IsDir() || e.Name() == ChunkStoreDir {
+			continue
+		}
+		files, err := ChunkFiles(filepath.Join(snapsRoot, e.Name()))
+		if err != nil {
+			return fmt.Errorf("scan %s: %w", e.Name(), err)
+		}
+		for _, f := range files {
+			live[f] = struct{}{}
+		}
+	}
+	chunks, err := os.ReadDir(storeDir)
+	if err != nil {
+		return err
+	}
+	for _, c := range chunks {
+		if _, ok := live[c.Name()]; ok {
+			continue
+		}
+		if err := os.Remove(filepath.Join(storeDir, c.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// verifyChunks checks that every chunk a chunked volume references exists
+// in the store and decompresses to its recorded digest and size. Chunks
+// live outside the snapshot directory, so Descriptor.Digests can't cover
+// them.
+func verifyChunks(snapshotDir, volName string) []string {
+	p := filepath.Join(snapshotDir, subdirVolumes, volName+extChunked)
+	if !fileExists(p) {
+		return nil
+	}
+	rel := subdirVolumes + "/" + volName + extChunked
+	idx, err := readChunkIndex(p)
+	if err != nil {
+		return []string{fmt.Sprintf("%s: %v", rel, err)}
+	}
+	storeDir := chunkStoreFor(snapshotDir)
+	var problems []string
+	for _, c := range idx.Chunks {
+		got, n, err := chunkDigest(chunkPath(storeDir, c.Digest))
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			problems = append(problems, fmt.Sprintf("%s: chunk %s missing from %s",
+				rel, shortDigest(c.Digest), storeDir))
+		case err != nil:
+			problems = append(problems, fmt.Sprintf("%s: chunk %s: %v", rel, shortDigest(c.Digest), err))
+		case got != c.Digest || n != c.Size:
+			problems = append(problems, fmt.Sprintf("%s: chunk %s corrupt", rel, shortDigest(c.Digest)))
+		}
+	}
+	return problems
+}
+
+// chunkDigest decompresses a stored chunk and returns the digest and
+// size of its contents.
+func chunkDigest(p string) (string, int64, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+	zr, err := zstd.NewReader(f)
+	if err != nil {
+		return "", 0, err
+	}
+	defer zr.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, zr)
+	if err != nil {
+		return "", 0, err
+	}
+	return digestPrefix + hex.EncodeToString(h.Sum(nil)), n, nil
+}
+
+// chunkReader streams the concatenation of a chunked volume's chunks,
+// decompressing each from the store in turn.
+type chunkReader struct {
+	storeDir string
+	chunks   []chunkRef
+	cur      *zstdFile
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for {
+		if r.cur == nil {
+			if len(r.chunks) == 0 {
+				return 0, io.EOF
+			}
+			c := r.chunks[0]
+			r.chunks = r.chunks[1:]
+			f, err := os.Open(chunkPath(r.storeDir, c.Digest))
+			if err != nil {
+				return 0, fmt.Errorf("open chunk %s: %w", shortDigest(c.Digest), err)
+			}
+			zr, err := zstd.NewReader(f)
+			if err != nil {
+				f.Close()
+				return 0, fmt.Errorf("open chunk %s: %w", shortDigest(c.Digest), err)
+			}
+			r.cur = &zstdFile{Decoder: zr, f: f}
+		}
+		n, err := r.cur.Read(p)
+		if err == io.EOF {
+			r.cur.Close()
+			r.cur = nil
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+func (r *chunkReader) Close() error {
+	if r.cur != nil {
+		return r.cur.Close()
+	}
+	return nil
+}
+
+// zstdFile closes both the decoder and its underlying file.
+type zstdFile struct {
+	*zstd.Decoder
+	f *os.File
+}
+
+func (z *zstdFile) Close() error {
+	z.Decoder.Close()
+	return z.f.Close()
+}
+
+// gearTable drives the rolling hash in writeChunks. It's generated from a
+// fixed seed so chunk boundaries — and therefore dedup — are stable across
+// smelt builds.
+var gearTable = func() [256]uint64 {
+	var t [256]uint64
+	x := uint64(0x736d656c74) // "smelt"
+	for i := range t {
+		// splitmix64
+		x += 0x9e3779b97f4a7c15
+		z := x
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		t[i] = z ^ (z >> 31)
+	}
+	return t
+}()
+
+func fileExists(p string) bool {
+	info, err := os.Stat(p)
+	return err == nil && info.Mode().IsRegular()
+}
+
+// Repack rewrites an existing snapshot's volume archives in place as
+// zstd tars, or as chunks in the shared store when chunked is set, then
+// refreshes the descriptor's digests. Use it to shrink snapshots saved
+// before compression existed, or to move a snapshot into (or out of) the
+// chunk store. The snapshot is verified first so a corrupt archive is
+// never re-digested into looking healthy.
+func Repack(projectDir, nameOrPath string, chunked bool) error {
+	projectDir, err := filepath.Abs(projectDir)
+	if err != nil {
+		return fmt.Errorf("resolve project dir: %w", err)
+	}
+	snapDir, err := resolveSnapshotDir(projectDir, nameOrPath)
+	if err != nil {
+		return err
+	}
+	desc, err := VerifyDir(snapDir)
+	if err != nil {
+		return err
+	}
+
+	want, storeDir := extZstd, ""
+	if chunked {
+		want, storeDir = extChunked, chunkStoreFor(snapDir)
+	}
+	volsDir := filepath.Join(snapDir, subdirVolumes)
+	for _, v := range desc.Volumes {
+		current := ""
+		for _, ext := range []string{extChunked, extZstd, extTar} {
+			if fileExists(filepath.Join(volsDir, v+ext)) {
+				current = ext
+				break
+			}
+		}
+		if current == "" || current == want {
+			continue
+		}
+		fmt.Printf("  %s: %s → %s\n", v, current, want)
+		r, err := openVolumeArchive(volsDir, v)
+		if err != nil {
+			return err
+		}
+		err = writeVolumeArchive(r, volsDir, v, storeDir)
+		r.Close()
+		if err != nil {
+			return fmt.Errorf("repack %s: %w", v, err)
+		}
+		if err := os.Remove(filepath.Join(volsDir, v+current)); err != nil {
+			return err
+		}
+	}
+
+	digests, err := computeDigests(snapDir)
+	if err != nil {
+		return err
+	}
+	desc.Digests = digests
+	if err := writeDescriptor(snapDir, desc); err != nil {
+		return err
+	}
+	return gcChunks(filepath.Dir(snapDir))
+}
@@ -0,0 +1,162 @@
+package snapshot
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func randomBytes(t *testing.T, seed int64, n int) []byte {
+	t.Helper()
+	data := make([]byte, n)
+	rand.New(rand.NewSource(seed)).Read(data)
+	return data
+}
+
+func readVolume(t *testing.T, volsDir, volName string) []byte {
+	t.Helper()
+	r, err := openVolumeArchive(volsDir, volName)
+	if err != nil {
+		t.Fatalf("openVolumeArchive: %v", err)
+	}
+	defer r.Close()
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("read volume: %v", err)
+	}
+	return got
+}
+
+func TestVolumeArchiveRoundTrip(t *testing.T) {
+	data := randomBytes(t, 1, 6<<20)
+
+	t.Run("zstd", func(t *testing.T) {
+		volsDir := t.TempDir()
+		if err := writeVolumeArchive(bytes.NewReader(data), volsDir, "v", ""); err != nil {
+			t.Fatal(err)
+		}
+		if !fileExists(filepath.Join(volsDir, "v"+extZstd)) {
+			t.Fatalf("expected v%s", extZstd)
+		}
+		if got := readVolume(t, volsDir, "v"); !bytes.Equal(got, data) {
+			t.Fatal("zstd round trip mismatch")
+		}
+	})
+
+	t.Run("chunked", func(t *testing.T) {
+		snapDir := filepath.Join(t.TempDir(), "snap")
+		volsDir := filepath.Join(snapDir, subdirVolumes)
+		if err := os.MkdirAll(volsDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := writeVolumeArchive(bytes.NewReader(data), volsDir, "v", chunkStoreFor(snapDir)); err != nil {
+			t.Fatal(err)
+		}
+		if got := readVolume(t, volsDir, "v"); !bytes.Equal(got, data) {
+			t.Fatal("chunked round trip mismatch")
+		}
+		if problems := verifyChunks(snapDir, "v"); len(problems) != 0 {
+			t.Fatalf("verifyChunks: %v", problems)
+		}
+	})
+
+	t.Run("plain tar", func(t *testing.T) {
+		volsDir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(volsDir, "v"+extTar), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if got := readVolume(t, volsDir, "v"); !bytes.Equal(got, data) {
+			t.Fatal("plain tar read mismatch")
+		}
+	})
+}
+
+func TestChunkDedupAndGC(t *testing.T) {
+	root := t.TempDir()
+	store := filepath.Join(root, ChunkStoreDir)
+
+	// Two "snapshots" whose volumes differ only by a small insertion near
+	// the start. Content-defined boundaries should resync after it, so
+	// the second save adds only a couple of chunks.
+	base := randomBytes(t, 2, 8<<20)
+	edited := append(append(append([]byte{}, base[:1000]...), []byte("inserted")...), base[1000:]...)
+
+	for name, data := range map[string][]byte{"a": base, "b": edited} {
+		volsDir := filepath.Join(root, name, subdirVolumes)
+		if err := os.MkdirAll(volsDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := writeVolumeArchive(bytes.NewReader(data), volsDir, "v", store); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	a, err := ChunkFiles(filepath.Join(root, "a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, err := os.ReadDir(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added := len(stored) - len(a); added > 2 {
+		t.Errorf("expected at most 2 new chunks for a small edit, got %d (of %d)", added, len(a))
+	}
+
+	if err := os.RemoveAll(filepath.Join(root, "b")); err != nil {
+		t.Fatal(err)
+	}
+	if err := gcChunks(root); err != nil {
+		t.Fatalf("gcChunks: %v", err)
+	}
+	stored, err = os.ReadDir(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != len(a) {
+		t.Errorf("expected %d chunks after gc, got %d", len(a), len(stored))
+	}
+	if problems := verifyChunks(filepath.Join(root, "a"), "v"); len(problems) != 0 {
+		t.Fatalf("surviving snapshot lost chunks: %v", problems)
+	}
+}
+
+func TestGCKeepsInProgressChunks(t *testing.T) {
+	root := t.TempDir()
+	store := filepath.Join(root, ChunkStoreDir)
+
+	// A save still in progress: its volume is indexed in the staging dir
+	// but the snapshot hasn't been renamed into place.
+	volsDir := filepath.Join(root, ".pending.tmp", subdirVolumes)
+	if err := os.MkdirAll(volsDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeVolumeArchive(bytes.NewReader(randomBytes(t, 3, 2<<20)), volsDir, "v", store); err != nil {
+		t.Fatal(err)
+	}
+
+	// A writer holding the store lock keeps GC waiting until it's done.
+	unlock, err := lockChunkStore(root, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- gcChunks(root) }()
+	select {
+	case err := <-done:
+		t.Fatalf("gc ran while the store was locked (err %v)", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	unlock()
+	if err := <-done; err != nil {
+		t.Fatalf("gcChunks: %v", err)
+	}
+
+	if problems := verifyChunks(filepath.Join(root, ".pending.tmp"), "v"); len(problems) != 0 {
+		t.Fatalf("gc removed chunks of an in-progress save: %v", problems)
+	}
+}
@@ -0,0 +1,196 @@
+package snapshot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// CaptureOpts describes a running stack to snapshot that isn't the
+// `make up` project — in practice a pkg/stack test stack, whose project
+// name, keys and chain endpoint all live outside the project layout Save
+// assumes. Capture is always a live save: chain state comes from
+// anvil_dumpState, so the blockchain keeps running throughout.
+type CaptureOpts struct {
+	// Dir is the snapshot directory to create. Its parent is created if
+	// missing; the snapshot name recorded in the descriptor is its base.
+	Dir string
+	// Force replaces an existing snapshot at Dir.
+	Force bool
+	// Chunked stores volume archives in the .chunks/ store beside Dir
+	// rather than as one zstd tar per volume (see SaveOpts.Chunked).
+	Chunked bool
+
+	// ProjectName is the compose project the volumes belong to.
+	ProjectName string
+	// Volumes lists compose volume names (without project prefix) to
+	// archive.
+	Volumes []string
+	// KeysDir and ProofsDir are copied into keys/ and proofs/.
+	KeysDir   string
+	ProofsDir string
+	// Manifest is written verbatim as the snapshot's smelt.yml; it's what
+	// a later load resolves topology from.
+	Manifest []byte
+	// DeployedAddressesPath is the deployed-addresses.json the chain was
+	// booted with.
+	DeployedAddressesPath string
+	// RPCURL is anvil's host-side JSON-RPC endpoint.
+	RPCURL string
+	// Images is recorded in the descriptor for drift checks on load.
+	Images map[string]ImageInfo
+
+	// Freeze, if set, is called right before the chain state is dumped
+	// and must stop every service that writes to Volumes. The returned
+	// resume func is called once the volumes are archived, or on any
+	// failure in between.
+	Freeze func(ctx context.Context) (resume func(), err error)
+}
+
+// Capture writes a snapshot of a running stack to opts.Dir. The result
+// has the same layout and descriptor as Save's, so it loads anywhere a
+// saved snapshot does — `smelt snapshot load`, stack.WithSnapshot, or
+// as an embedded snapshot once copied under snapshots/.
+func Capture(ctx context.Context, opts CaptureOpts) (*Descriptor, error) {
+	if opts.Dir == "" {
+		return nil, errors.New("snapshot dir is required")
+	}
+	finalDir, err := filepath.Abs(opts.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("resolve snapshot dir: %w", err)
+	}
+	name := filepath.Base(finalDir)
+	if err := validateName(name); err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(finalDir); err == nil && !opts.Force {
+		return nil, fmt.Errorf("snapshot already exists at %s", finalDir)
+	}
+
+	parent := filepath.Dir(finalDir)
+	stagingDir := filepath.Join(parent, "."+name+".tmp")
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		return nil, fmt.Errorf("create snapshots dir: %w", err)
+	}
+	if err := os.RemoveAll(stagingDir); err != nil {
+		return nil, fmt.Errorf("clear staging dir: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Join(stagingDir, subdirBlockchain), 0755); err != nil {
+		return nil, fmt.Errorf("create staging dir: %w", err)
+	}
+	success := false
+	defer func() {
+		if !success {
+			_ = os.RemoveAll(stagingDir)
+		}
+	}()
+
+	resume := func() {}
+	if opts.Freeze != nil {
+		r, err := opts.Freeze(ctx)
+		if err != nil {
+			return nil, err
+		}
+		resume = r
+	}
+	resumed := false
+	defer func() {
+		if !resumed {
+			resume()
+		}
+	}()
+
+	bcDir := filepath.Join(stagingDir, subdirBlockchain)
+	if err := dumpAnvilState(ctx, opts.RPCURL, filepath.Join(bcDir, "anvil-state.json")); err != nil {
+		return nil, err
+	}
+	if err := copyFile(opts.DeployedAddressesPath, filepath.Join(bcDir, "deployed-addresses.json")); err != nil {
+		return nil, fmt.Errorf("copy deployed-addresses.json: %w", err)
+	}
+
+	keyFiles, err := copyDir(opts.KeysDir, filepath.Join(stagingDir, subdirKeys))
+	if err != nil {
+		return nil, fmt.Errorf("archive keys: %w", err)
+	}
+	proofFiles, err := copyDir(opts.ProofsDir, filepath.Join(stagingDir, subdirProofs))
+	if err != nil {
+		return nil, fmt.Errorf("archive proofs: %w", err)
+	}
+
+	volsDst := filepath.Join(stagingDir, subdirVolumes)
+	if err := os.MkdirAll(volsDst, 0755); err != nil {
+		return nil, err
+	}
+	chunkStore := ""
+	if opts.Chunked {
+		chunkStore = filepath.Join(parent, ChunkStoreDir)
+	}
+	for _, v := range opts.Volumes {
+		if err := archiveVolume(ctx, opts.ProjectName, v, volsDst, chunkStore); err != nil {
+			return nil, err
+		}
+	}
+	resumed = true
+	resume()
+
+	if err := os.WriteFile(filepath.Join(stagingDir, manifestCopy), opts.Manifest, 0644); err != nil {
+		return nil, fmt.Errorf("write %s: %w", manifestCopy, err)
+	}
+
+	desc := &Descriptor{
+		Name:      name,
+		CreatedAt: time.Now().UTC(),
+		Volumes:   opts.Volumes,
+		Keys:      keyFiles,
+		Proofs:    proofFiles,
+		Images:    opts.Images,
+	}
+	if err := commitSnapshot(stagingDir, finalDir, desc); err != nil {
+		return nil, err
+	}
+	success = true
+	return desc, nil
+}
+
+// commitSnapshot digests a fully staged snapshot, writes its descriptor
+// and renames it into place. Any existing snapshot at finalDir is removed
+// only AFTER staging is complete, so a failure anywhere earlier leaves
+// the previous snapshot intact; callers check for overwrite permission
+// before staging. A replaced snapshot's pin carries over to its
+// replacement.
+func commitSnapshot(stagingDir, finalDir string, desc *Descriptor) error {
+	// Hash last, once every file is in place, so the digests describe
+	// exactly what lands in the final directory.
+	digests, err := computeDigests(stagingDir)
+	if err != nil {
+		return err
+	}
+	desc.Digests = digests
+	if old, err := readDescriptor(finalDir); err == nil {
+		desc.Pinned = old.Pinned
+	}
+	if err := writeDescriptor(stagingDir, desc); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(finalDir); err != nil {
+		return fmt.Errorf("remove old snapshot: %w", err)
+	}
+	if err := os.Rename(stagingDir, finalDir); err != nil {
+		return fmt.Errorf("commit snapshot: %w", err)
+	}
+	return nil
+}
+
+// ImageInfoFor returns the image identity of a local image reference,
+// resolving its digest best-effort: a reference that can't be inspected
+// is recorded by tag only.
+func ImageInfoFor(ctx context.Context, ref string) ImageInfo {
+	info := ImageInfo{Tag: ref}
+	if digest, err := inspectImageDigest(ctx, ref); err == nil {
+		info.Digest = digest
+	}
+	return info
+}
@@ -34,6 +34,16 @@ type Descriptor struct {
 	// disagrees) and digest drift at the same tag (someone re-pulled a
 	// moving tag between save and load).
 	Images map[string]ImageInfo `json:"images,omitempty"`
+	// Digests maps every file in the snapshot (slash-separated path
+	// relative to the snapshot root, e.g. "volumes/piri-0-data.tar") to
+	// its "sha256:<hex>" content digest at save time. The descriptor
+	// itself is excluded. Empty for snapshots saved before integrity
+	// checking existed; Verify falls back to structural checks for those.
+	Digests map[string]string `json:"digests,omitempty"`
+	// Pinned protects the snapshot from `smelt snapshot prune`. Set with
+	// `smelt snapshot pin`; carried over when a save replaces the
+	// snapshot. Not covered by Digests, so toggling it needs no rehash.
+	Pinned bool `json:"pinned,omitempty"`
 }
 
 // ImageInfo is the per-service image identity captured in a snapshot.
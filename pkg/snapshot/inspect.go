@@ -0,0 +1,446 @@
+package snapshot
+
+import (
+	"archive/tar"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/storacha/go-ucanto/principal/ed25519/verifier"
+
+	"github.com/storacha/smelt/pkg/manifest"
+)
+
+// Inspection is everything `smelt snapshot inspect` reports about a
+// snapshot, read from disk without touching docker.
+type Inspection struct {
+	Dir        string
+	Descriptor *Descriptor
+	// Nodes is the piri topology resolved from the snapshot's smelt.yml.
+	Nodes []manifest.ResolvedPiriNode
+	// Piri pairs each node with the DID derived from its key.
+	Piri    []PiriIdentity
+	Volumes []VolumeInfo
+	// ChainID and Contracts come from blockchain/deployed-addresses.json.
+	ChainID   int64
+	Contracts map[string]string
+}
+
+// PiriIdentity is a piri node's DID and whether the snapshot holds its
+// piri → upload registration proof.
+type PiriIdentity struct {
+	Name       string
+	DID        string
+	Registered bool
+}
+
+// VolumeInfo describes one volume archive.
+type VolumeInfo struct {
+	Name string
+	// Format is "chunked", "zstd" or "tar".
+	Format string
+	// StoredBytes is what the archive occupies on disk. For chunked
+	// archives it counts every referenced chunk, including ones shared
+	// with other snapshots.
+	StoredBytes int64
+	// Files and DataBytes summarise the tar contents: regular files and
+	// the sum of their sizes.
+	Files     int
+	DataBytes int64
+}
+
+// Inspect summarises a snapshot: topology, images, volumes, contracts
+// and piri identities.
+func Inspect(projectDir, nameOrPath string) (*Inspection, error) {
+	snapDir, err := resolveSnapshotDir(projectDir, nameOrPath)
+	if err != nil {
+		return nil, err
+	}
+	return InspectDir(snapDir)
+}
+
+// InspectDir is Inspect for an already-resolved snapshot directory.
+func InspectDir(snapshotDir string) (*Inspection, error) {
+	in, err := inspectMetadata(snapshotDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range in.Descriptor.Volumes {
+		info, err := inspectVolume(snapshotDir, v)
+		if err != nil {
+			return nil, err
+		}
+		in.Volumes = append(in.Volumes, info)
+	}
+	return in, nil
+}
+
+// inspectMetadata fills in everything but Volumes, which needs every
+// archive decompressed.
+func inspectMetadata(snapshotDir string) (*Inspection, error) {
+	desc, err := readDescriptor(snapshotDir)
+	if err != nil {
+		return nil, err
+	}
+	m, err := manifest.Parse(filepath.Join(snapshotDir, manifestCopy))
+	if err != nil {
+		return nil, err
+	}
+	nodes, err := m.Resolve()
+	if err != nil {
+		return nil, err
+	}
+	in := &Inspection{Dir: snapshotDir, Descriptor: desc, Nodes: nodes}
+
+	for _, n := range nodes {
+		id := PiriIdentity{
+			Name:       n.Name,
+			Registered: fileExists(filepath.Join(snapshotDir, subdirProofs, n.Name+"-proof.txt")),
+		}
+		if did, err := didFromPublicKey(filepath.Join(snapshotDir, subdirKeys, n.Name+".pub")); err == nil {
+			id.DID = did
+		}
+		in.Piri = append(in.Piri, id)
+	}
+
+	data, err := os.ReadFile(filepath.Join(snapshotDir, subdirBlockchain, "deployed-addresses.json"))
+	if err != nil {
+		return nil, fmt.Errorf("read deployed-addresses.json: %w", err)
+	}
+	var addrs struct {
+		ChainID   int64             `json:"chainId"`
+		Contracts map[string]string `json:"contracts"`
+	}
+	if err := json.Unmarshal(data, &addrs); err != nil {
+		return nil, fmt.Errorf("parse deployed-addresses.json: %w", err)
+	}
+	in.ChainID, in.Contracts = addrs.ChainID, addrs.Contracts
+	return in, nil
+}
+
+func inspectVolume(snapshotDir, volName string) (VolumeInfo, error) {
+	info := VolumeInfo{Name: volName}
+	volsDir := filepath.Join(snapshotDir, subdirVolumes)
+	switch {
+	case fileExists(filepath.Join(volsDir, volName+extChunked)):
+		info.Format = "chunked"
+		idx, err := readChunkIndex(filepath.Join(volsDir, volName+extChunked))
+		if err != nil {
+			return info, err
+		}
+		store := chunkStoreFor(snapshotDir)
+		for _, c := range idx.Chunks {
+			if st, err := os.Stat(chunkPath(store, c.Digest)); err == nil {
+				info.StoredBytes += st.Size()
+			}
+		}
+	case fileExists(filepath.Join(volsDir, volName+extZstd)):
+		info.Format = "zstd"
+		info.StoredBytes = fileSize(filepath.Join(volsDir, volName+extZstd))
+	default:
+		info.Format = "tar"
+		info.StoredBytes = fileSize(filepath.Join(volsDir, volName+extTar))
+	}
+
+	entries, err := volumeEntries(snapshotDir, volName)
+	if err != nil {
+		return info, err
+	}
+	for _, e := range entries {
+		if e.Type == tar.TypeReg {
+			info.Files++
+			info.DataBytes += e.Size
+		}
+	}
+	return info, nil
+}
+
+// volumeEntry is one tar member, reduced to what decides whether two
+// volumes hold the same thing.
+type volumeEntry struct {
+	Type   byte
+	Size   int64
+	Mode   int64
+	Link   string
+	Digest string
+}
+
+// volumeEntries reads a volume archive and returns its members by
+// cleaned path, hashing the content of regular files.
+func volumeEntries(snapshotDir, volName string) (map[string]volumeEntry, error) {
+	r, err := openVolumeArchive(filepath.Join(snapshotDir, subdirVolumes), volName)
+	if err != nil {
+		return nil, fmt.Errorf("open volume %s: %w", volName, err)
+	}
+	defer r.Close()
+
+	out := make(map[string]volumeEntry)
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return out, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read volume %s: %w", volName, err)
+		}
+		name := path.Clean("/" + hdr.Name)[1:]
+		if name == "" {
+			continue
+		}
+		e := volumeEntry{Type: hdr.Typeflag, Size: hdr.Size, Mode: hdr.Mode, Link: hdr.Linkname}
+		if hdr.Typeflag == tar.TypeReg {
+			h := sha256.New()
+			if _, err := io.Copy(h, tr); err != nil {
+				return nil, fmt.Errorf("read volume %s: %w", volName, err)
+			}
+			e.Digest = hex.EncodeToString(h.Sum(nil))
+		}
+		out[name] = e
+	}
+}
+
+// SnapshotDiff is the result of comparing two snapshots. Every slice
+// holds human-readable lines; an empty SnapshotDiff means the snapshots
+// are equivalent.
+type SnapshotDiff struct {
+	Topology  []string
+	Images    []string
+	Contracts []string
+	Volumes   []VolumeDiff
+}
+
+// VolumeDiff lists how one volume differs between snapshots A and B.
+// OnlyIn is "A" or "B" when the volume exists in just one of them, in
+// which case the path lists are empty.
+type VolumeDiff struct {
+	Name    string
+	OnlyIn  string
+	Added   []string
+	Removed []string
+	Changed []string
+}
+
+// Empty reports whether the diff found no differences.
+func (d *SnapshotDiff) Empty() bool {
+	return len(d.Topology) == 0 && len(d.Images) == 0 && len(d.Contracts) == 0 && len(d.Volumes) == 0
+}
+
+// Diff compares two snapshots' topology, images, deployed contracts and
+// volume contents. Volumes whose archives have identical recorded
+// digests are skipped without decompressing.
+func Diff(projectDir, a, b string) (*SnapshotDiff, error) {
+	dirA, err := resolveSnapshotDir(projectDir, a)
+	if err != nil {
+		return nil, err
+	}
+	dirB, err := resolveSnapshotDir(projectDir, b)
+	if err != nil {
+		return nil, err
+	}
+	inA, err := inspectMetadata(dirA)
+	if err != nil {
+		return nil, err
+	}
+	inB, err := inspectMetadata(dirB)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &SnapshotDiff{
+		Topology:  diffTopology(inA.Nodes, inB.Nodes),
+		Images:    diffImages(inA.Descriptor.Images, inB.Descriptor.Images),
+		Contracts: diffStringMaps(inA.Contracts, inB.Contracts),
+	}
+	// Same node name, different key: the piri is a different provider
+	// on chain even though the topology lines match.
+	didsB := make(map[string]string)
+	for _, p := range inB.Piri {
+		didsB[p.Name] = p.DID
+	}
+	for _, p := range inA.Piri {
+		if other, ok := didsB[p.Name]; ok && other != p.DID {
+			d.Topology = append(d.Topology, fmt.Sprintf("%s: DID %s → %s", p.Name, p.DID, other))
+		}
+	}
+
+	vols := make(map[string]int)
+	for _, v := range inA.Descriptor.Volumes {
+		vols[v] |= 1
+	}
+	for _, v := range inB.Descriptor.Volumes {
+		vols[v] |= 2
+	}
+	for _, v := range sortedKeys(vols) {
+		switch vols[v] {
+		case 1:
+			d.Volumes = append(d.Volumes, VolumeDiff{Name: v, OnlyIn: "A"})
+			continue
+		case 2:
+			d.Volumes = append(d.Volumes, VolumeDiff{Name: v, OnlyIn: "B"})
+			continue
+		}
+		if sameArchive(inA.Descriptor, inB.Descriptor, v) {
+			continue
+		}
+		ea, err := volumeEntries(dirA, v)
+		if err != nil {
+			return nil, err
+		}
+		eb, err := volumeEntries(dirB, v)
+		if err != nil {
+			return nil, err
+		}
+		if vd := diffEntries(v, ea, eb); vd != nil {
+			d.Volumes = append(d.Volumes, *vd)
+		}
+	}
+	return d, nil
+}
+
+// sameArchive reports whether both descriptors record the same digest
+// for the volume's archive file in the same format.
+func sameArchive(a, b *Descriptor, volName string) bool {
+	for _, ext := range []string{extChunked, extZstd, extTar} {
+		key := path.Join(subdirVolumes, volName+ext)
+		da, db := a.Digests[key], b.Digests[key]
+		if da != "" || db != "" {
+			return da == db
+		}
+	}
+	return false
+}
+
+func diffEntries(volName string, a, b map[string]volumeEntry) *VolumeDiff {
+	vd := &VolumeDiff{Name: volName}
+	for name, ea := range a {
+		eb, ok := b[name]
+		switch {
+		case !ok:
+			vd.Removed = append(vd.Removed, name)
+		case ea != eb:
+			vd.Changed = append(vd.Changed, name)
+		}
+	}
+	for name := range b {
+		if _, ok := a[name]; !ok {
+			vd.Added = append(vd.Added, name)
+		}
+	}
+	if len(vd.Added)+len(vd.Removed)+len(vd.Changed) == 0 {
+		return nil
+	}
+	sort.Strings(vd.Added)
+	sort.Strings(vd.Removed)
+	sort.Strings(vd.Changed)
+	return vd
+}
+
+func diffTopology(a, b []manifest.ResolvedPiriNode) []string {
+	var out []string
+	if len(a) != len(b) {
+		out = append(out, fmt.Sprintf("piri nodes: %d → %d", len(a), len(b)))
+	}
+	byName := make(map[string]manifest.ResolvedPiriNode, len(b))
+	for _, n := range b {
+		byName[n.Name] = n
+	}
+	for _, na := range a {
+		nb, ok := byName[na.Name]
+		if !ok {
+			out = append(out, fmt.Sprintf("%s: removed", na.Name))
+			continue
+		}
+		delete(byName, na.Name)
+		if na.Storage != nb.Storage {
+			out = append(out, fmt.Sprintf("%s: storage %s/%s → %s/%s",
+				na.Name, na.Storage.DB, na.Storage.Blob, nb.Storage.DB, nb.Storage.Blob))
+		}
+		if na.Image != nb.Image {
+			out = append(out, fmt.Sprintf("%s: image %q → %q", na.Name, na.Image, nb.Image))
+		}
+	}
+	for _, name := range sortedKeys(byName) {
+		out = append(out, fmt.Sprintf("%s: added", name))
+	}
+	return out
+}
+
+func diffStringMaps(a, b map[string]string) []string {
+	keys := make(map[string]struct{})
+	for k := range a {
+		keys[k] = struct{}{}
+	}
+	for k := range b {
+		keys[k] = struct{}{}
+	}
+	var out []string
+	for _, k := range sortedKeys(keys) {
+		va, vb := a[k], b[k]
+		if va == vb {
+			continue
+		}
+		if va == "" {
+			va = "(none)"
+		}
+		if vb == "" {
+			vb = "(none)"
+		}
+		out = append(out, fmt.Sprintf("%s: %s → %s", k, va, vb))
+	}
+	return out
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	out := make([]string, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// didFromPublicKey reads a PEM-encoded Ed25519 public key (the keys/*.pub
+// files smelt generates) and returns its did:key.
+func didFromPublicKey(p string) (string, error) {
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return "", err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || !strings.Contains(block.Type, "PUBLIC KEY") {
+		return "", fmt.Errorf("%s: no PUBLIC KEY block", filepath.Base(p))
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", filepath.Base(p), err)
+	}
+	key, ok := pub.(ed25519.PublicKey)
+	if !ok {
+		return "", fmt.Errorf("%s: not an Ed25519 public key", filepath.Base(p))
+	}
+	v, err := verifier.FromRaw(key)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", filepath.Base(p), err)
+	}
+	return v.DID().String(), nil
+}
+
+func fileSize(p string) int64 {
+	st, err := os.Stat(p)
+	if err != nil {
+		return 0
+	}
+	return st.Size()
+}
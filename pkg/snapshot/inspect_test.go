@@ -0,0 +1,86 @@
+package snapshot
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeVolumeTar replaces a test snapshot's piri-0-data archive with a
+// tar of the given files and refreshes the recorded digests.
+func writeVolumeTar(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, name := range sortedKeys(files) {
+		data := []byte(files[name])
+		if err := tw.WriteHeader(&tar.Header{Name: "./" + name, Mode: 0644, Size: int64(len(data)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "volumes", "piri-0-data.tar"), buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	desc, err := readDescriptor(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if desc.Digests, err = computeDigests(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeDescriptor(dir, desc); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInspectAndDiff(t *testing.T) {
+	a := writeTestSnapshot(t, true)
+	b := writeTestSnapshot(t, true)
+	writeVolumeTar(t, a, map[string]string{"db.sqlite": "one", "keep": "same", "old": "gone"})
+	writeVolumeTar(t, b, map[string]string{"db.sqlite": "two", "keep": "same", "new": "here"})
+
+	in, err := InspectDir(a)
+	if err != nil {
+		t.Fatalf("InspectDir: %v", err)
+	}
+	if len(in.Nodes) != 1 || in.Nodes[0].Name != "piri-0" {
+		t.Errorf("unexpected topology: %+v", in.Nodes)
+	}
+	if !in.Piri[0].Registered {
+		t.Error("piri-0 has a proof; expected Registered")
+	}
+	if len(in.Volumes) != 1 || in.Volumes[0].Files != 3 || in.Volumes[0].Format != "tar" {
+		t.Errorf("unexpected volume info: %+v", in.Volumes)
+	}
+
+	d, err := Diff("", a, b)
+	if err != nil {
+		t.Fatalf("Diff: %v", err)
+	}
+	want := []VolumeDiff{{
+		Name:    "piri-0-data",
+		Added:   []string{"new"},
+		Removed: []string{"old"},
+		Changed: []string{"db.sqlite"},
+	}}
+	if !reflect.DeepEqual(d.Volumes, want) {
+		t.Errorf("volume diff: got %+v, want %+v", d.Volumes, want)
+	}
+
+	same, err := Diff("", a, a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !same.Empty() {
+		t.Errorf("snapshot differs from itself: %+v", same)
+	}
+}
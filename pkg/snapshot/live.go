@@ -0,0 +1,186 @@
+package snapshot
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/storacha/smelt/internal/dockerapi"
+)
+
+// BlockchainService is the compose service running anvil. Its state is
+// captured through evm_snapshot/anvil_dumpState rather than by stopping it.
+const BlockchainService = "blockchain"
+
+// volumeWriters returns the compose services that mount any of vols —
+// the containers that must be frozen while those volumes are archived so
+// the tars capture a consistent point in time. The blockchain service is
+// never included: it has to keep answering RPC for the state dump, and
+// its own state travels via anvil_dumpState rather than a volume.
+func volumeWriters(ctx context.Context, projectDir string, vols []string) ([]string, error) {
+	doc, err := readComposeConfig(ctx, projectDir)
+	if err != nil {
+		return nil, err
+	}
+
+	want := make(map[string]bool, len(vols))
+	for _, v := range vols {
+		want[v] = true
+	}
+	var out []string
+	for name, svc := range doc.Services {
+		if name == BlockchainService {
+			continue
+		}
+		for _, m := range svc.Volumes {
+			if m.Type == "volume" && want[m.Source] {
+				out = append(out, name)
+				break
+			}
+		}
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// pauseServices freezes the given compose services with `docker compose
+// pause`. Paused containers keep their open files and in-memory state;
+// unpauseServices resumes them exactly where they stopped.
+func pauseServices(ctx context.Context, projectDir string, services []string) error {
+	return composeServices(ctx, projectDir, "pause", services)
+}
+
+// unpauseServices reverses pauseServices.
+func unpauseServices(ctx context.Context, projectDir string, services []string) error {
+	return composeServices(ctx, projectDir, "unpause", services)
+}
+
+func composeServices(ctx context.Context, projectDir, verb string, services []string) error {
+	if len(services) == 0 {
+		return nil
+	}
+	cmd := dockerapi.Compose(ctx, projectDir, append([]string{verb}, services...)...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("compose %s: %w", verb, err)
+	}
+	return nil
+}
+
+// blockchainRPCURL resolves the host-side URL of the blockchain's RPC
+// port via `docker compose port`, so it works whatever
+// SMELT_BLOCKCHAIN_PORT maps it to.
+func blockchainRPCURL(ctx context.Context, projectDir string) (string, error) {
+	cmd := dockerapi.Compose(ctx, projectDir, "port", BlockchainService, "8545")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("compose port %s: %w (%s)", BlockchainService, err, stderr.String())
+	}
+	addr := strings.TrimSpace(stdout.String())
+	if addr == "" {
+		return "", fmt.Errorf("%s has no published RPC port", BlockchainService)
+	}
+	// Compose reports wildcard binds as 0.0.0.0:PORT; dial loopback.
+	addr = strings.Replace(addr, "0.0.0.0:", "127.0.0.1:", 1)
+	return "http://" + addr, nil
+}
+
+// dumpAnvilState captures the running chain's state via anvil_dumpState
+// and writes it to dst in the same JSON form the blockchain container's
+// SIGTERM trap produces, so Load can't tell the two apart.
+func dumpAnvilState(ctx context.Context, rpcURL, dst string) error {
+	raw, err := AnvilRPC(ctx, rpcURL, "anvil_dumpState")
+	if err != nil {
+		return err
+	}
+	var result string
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return fmt.Errorf("anvil_dumpState: decode result: %w", err)
+	}
+	state, err := decodeAnvilDump(result)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(dst, state, 0644)
+}
+
+// AnvilRPC makes a single JSON-RPC call against an anvil endpoint and
+// returns the raw result. Shared by the live save path here and
+// pkg/stack's evm_snapshot / evm_revert checkpoints.
+func AnvilRPC(ctx context.Context, rpcURL, method string, params ...any) (json.RawMessage, error) {
+	if params == nil {
+		params = []any{}
+	}
+	body, err := json.Marshal(map[string]any{
+		"jsonrpc": "2.0",
+		"id":      1,
+		"method":  method,
+		"params":  params,
+	})
+	if err != nil {
+		return nil, err
+	}
+	reqCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodPost, rpcURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", method, err)
+	}
+	defer resp.Body.Close()
+
+	var rpc struct {
+		Result json.RawMessage `json:"result"`
+		Error  *struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&rpc); err != nil {
+		return nil, fmt.Errorf("%s: decode response (status %d): %w", method, resp.StatusCode, err)
+	}
+	if rpc.Error != nil {
+		return nil, fmt.Errorf("%s: rpc error %d: %s", method, rpc.Error.Code, rpc.Error.Message)
+	}
+	return rpc.Result, nil
+}
+
+// decodeAnvilDump turns anvil_dumpState's result — a 0x-prefixed hex
+// string, gzip-compressed on current anvil releases and raw JSON on
+// older ones — into the plain JSON that `anvil --load-state` reads.
+func decodeAnvilDump(result string) ([]byte, error) {
+	raw, err := hex.DecodeString(strings.TrimPrefix(result, "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("anvil_dumpState: decode hex: %w", err)
+	}
+	if len(raw) >= 2 && raw[0] == 0x1f && raw[1] == 0x8b {
+		zr, err := gzip.NewReader(bytes.NewReader(raw))
+		if err != nil {
+			return nil, fmt.Errorf("anvil_dumpState: gunzip: %w", err)
+		}
+		defer zr.Close()
+		if raw, err = io.ReadAll(zr); err != nil {
+			return nil, fmt.Errorf("anvil_dumpState: gunzip: %w", err)
+		}
+	}
+	if !json.Valid(raw) {
+		return nil, fmt.Errorf("anvil_dumpState: result is not JSON state")
+	}
+	return raw, nil
+}
@@ -0,0 +1,49 @@
+package snapshot
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/hex"
+	"testing"
+)
+
+func TestDecodeAnvilDump(t *testing.T) {
+	state := []byte(`{"block":{"number":"0x29"},"accounts":{}}`)
+
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	if _, err := zw.Write(state); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		result  string
+		wantErr bool
+	}{
+		{name: "gzip", result: "0x" + hex.EncodeToString(gz.Bytes())},
+		{name: "raw json", result: "0x" + hex.EncodeToString(state)},
+		{name: "not hex", result: "0xzz", wantErr: true},
+		{name: "not json", result: "0x" + hex.EncodeToString([]byte("nope")), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeAnvilDump(tt.result)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("decodeAnvilDump: %v", err)
+			}
+			if !bytes.Equal(got, state) {
+				t.Errorf("got %s, want %s", got, state)
+			}
+		})
+	}
+}
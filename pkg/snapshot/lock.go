@@ -0,0 +1,32 @@
+package snapshot
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// chunkLockFile sits next to the chunk store it guards. Keeping it out of
+// the store means gcChunks never sees it as a chunk.
+const chunkLockFile = ".chunks.lock"
+
+// lockChunkStore takes an advisory lock on the chunk store under
+// snapsRoot and returns the function that releases it. Writers adding
+// chunks hold it shared until the index referencing them is on disk, and
+// gcChunks holds it exclusively, so a prune in another process can't
+// delete a chunk a save has just written or deduplicated against before
+// the save records it.
+func lockChunkStore(snapsRoot string, exclusive bool) (unlock func(), err error) {
+	if err := os.MkdirAll(snapsRoot, 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(filepath.Join(snapsRoot, chunkLockFile), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("open chunk store lock: %w", err)
+	}
+	if err := flock(f, exclusive); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("lock chunk store: %w", err)
+	}
+	return func() { f.Close() }, nil
+}
@@ -0,0 +1,11 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd)
+
+package snapshot
+
+import "os"
+
+// flock is a no-op where flock(2) isn't available: chunk GC then relies
+// on not running alongside a save.
+func flock(f *os.File, exclusive bool) error {
+	return nil
+}
@@ -0,0 +1,259 @@
+package snapshot
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/storacha/smelt/pkg/manifest"
+)
+
+// MatrixFile is the default build list for BuildMatrix, relative to the
+// project root. It sits beside the snapshots it produces.
+const MatrixFile = "snapshots/matrix.yml"
+
+// Matrix is the declarative list of snapshots `smelt snapshot
+// build-matrix` produces: one per storage-backend combination and node
+// count that tests want to boot warm.
+type Matrix struct {
+	Version   int           `yaml:"version"`
+	Snapshots []MatrixEntry `yaml:"snapshots"`
+}
+
+// MatrixEntry is one snapshot in a Matrix: Nodes piri nodes, all on the
+// same storage backends.
+type MatrixEntry struct {
+	// Name defaults to "<nodes>-piri-<blob>-<db>", e.g.
+	// "3-piri-filesystem-sqlite".
+	Name  string `yaml:"name,omitempty"`
+	Nodes int    `yaml:"nodes"`
+	DB    string `yaml:"db"`
+	Blob  string `yaml:"blob"`
+}
+
+// MatrixSnapshotName is the name BuildMatrix gives a snapshot of nodes
+// piri nodes on the given backends, unless the entry names it. Tests
+// use it to find the embedded snapshot for their topology.
+func MatrixSnapshotName(nodes int, storage manifest.StorageSpec) string {
+	return fmt.Sprintf("%d-piri-%s-%s", nodes, storage.Blob, storage.DB)
+}
+
+// Manifest returns the smelt.yml topology the entry boots.
+func (e MatrixEntry) Manifest() *manifest.Manifest {
+	return &manifest.Manifest{
+		Version: 1,
+		Piri: manifest.PiriSpec{
+			Count:    e.Nodes,
+			Defaults: manifest.PiriDefaults{Storage: manifest.StorageSpec{DB: e.DB, Blob: e.Blob}},
+		},
+	}
+}
+
+// ParseMatrix reads a matrix file, filling in default names and
+// rejecting entries whose topology doesn't resolve.
+func ParseMatrix(data []byte) (*Matrix, error) {
+	var m Matrix
+	if err := yaml.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("parse matrix: %w", err)
+	}
+	if len(m.Snapshots) == 0 {
+		return nil, fmt.Errorf("matrix lists no snapshots")
+	}
+	seen := make(map[string]bool)
+	for i := range m.Snapshots {
+		e := &m.Snapshots[i]
+		if e.Nodes < 1 {
+			return nil, fmt.Errorf("matrix entry %d: nodes must be at least 1", i)
+		}
+		nodes, err := e.Manifest().Resolve()
+		if err != nil {
+			return nil, fmt.Errorf("matrix entry %d: %w", i, err)
+		}
+		if e.Name == "" {
+			e.Name = MatrixSnapshotName(e.Nodes, nodes[0].Storage)
+		}
+		if err := validateName(e.Name); err != nil {
+			return nil, fmt.Errorf("matrix entry %d: %w", i, err)
+		}
+		if seen[e.Name] {
+			return nil, fmt.Errorf("matrix lists %q twice", e.Name)
+		}
+		seen[e.Name] = true
+	}
+	return &m, nil
+}
+
+// BuildMatrixOpts drives BuildMatrix.
+type BuildMatrixOpts struct {
+	ProjectDir string
+	Entries    []MatrixEntry
+	// OutputDir receives each finished snapshot, plus its chunks when
+	// Chunked is set. Defaults to the project's snapshots/, which is
+	// embedded in the Go module.
+	OutputDir string
+	// Force rebuilds entries whose snapshot already exists in OutputDir;
+	// otherwise they're skipped, so an interrupted build resumes.
+	Force bool
+	// Chunked saves volumes as chunks shared between the entries.
+	Chunked bool
+	// HealthTimeout bounds each cold boot. Defaults to 10 minutes.
+	HealthTimeout time.Duration
+}
+
+// BuildMatrix cold-boots the project once per entry and saves the result.
+// Each boot starts from a wiped project (`make clean`) with the entry's
+// topology as the session manifest, and goes through `make init` and
+// `make up` exactly as a developer's would, so the snapshots match what
+// `make up SNAPSHOT=...` and pkg/stack expect. The project is wiped again
+// when the build finishes. The stack must be down to start.
+func BuildMatrix(ctx context.Context, opts BuildMatrixOpts) error {
+	projectDir, err := filepath.Abs(opts.ProjectDir)
+	if err != nil {
+		return fmt.Errorf("resolve project dir: %w", err)
+	}
+	outputDir := opts.OutputDir
+	if outputDir == "" {
+		outputDir = filepath.Join(projectDir, "snapshots")
+	}
+	if outputDir, err = filepath.Abs(outputDir); err != nil {
+		return fmt.Errorf("resolve output dir: %w", err)
+	}
+	timeout := opts.HealthTimeout
+	if timeout == 0 {
+		timeout = 10 * time.Minute
+	}
+	if err := requireStackDown(ctx, projectDir); err != nil {
+		return err
+	}
+
+	var built int
+	for i, e := range opts.Entries {
+		dst := filepath.Join(outputDir, e.Name)
+		if dirExists(dst) && !opts.Force {
+			fmt.Printf("[%d/%d] %s: exists, skipping (use --force to rebuild)\n", i+1, len(opts.Entries), e.Name)
+			continue
+		}
+		if dirExists(filepath.Join(projectDir, projSnapshotsDir, e.Name)) {
+			return fmt.Errorf("%s: a snapshot of that name already exists in %s; remove or rename it first",
+				e.Name, projSnapshotsDir)
+		}
+		fmt.Printf("[%d/%d] %s: %d piri node(s), db=%s blob=%s\n", i+1, len(opts.Entries), e.Name, e.Nodes, e.DB, e.Blob)
+		if err := buildMatrixEntry(ctx, projectDir, e, opts.Chunked, timeout); err != nil {
+			return fmt.Errorf("%s: %w", e.Name, err)
+		}
+		if err := exportSnapshot(projectDir, e.Name, dst); err != nil {
+			return fmt.Errorf("%s: %w", e.Name, err)
+		}
+		built++
+	}
+	if built > 0 {
+		if err := runMake(ctx, projectDir, "clean"); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("\nBuilt %d snapshot(s) into %s\n", built, outputDir)
+	return nil
+}
+
+func buildMatrixEntry(ctx context.Context, projectDir string, e MatrixEntry, chunked bool, timeout time.Duration) error {
+	if err := runMake(ctx, projectDir, "clean"); err != nil {
+		return err
+	}
+	data, err := yaml.Marshal(e.Manifest())
+	if err != nil {
+		return fmt.Errorf("marshal manifest: %w", err)
+	}
+	session := filepath.Join(projectDir, manifest.SessionManifestPath)
+	if err := os.MkdirAll(filepath.Dir(session), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(session, data, 0644); err != nil {
+		return fmt.Errorf("write session manifest: %w", err)
+	}
+	// init generates keys and proofs for any node the previous entry
+	// didn't have; up seeds the baseline chain state and starts compose.
+	for _, target := range []string{"init", "up"} {
+		if err := runMake(ctx, projectDir, target); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("Waiting up to %s for every service to become healthy...\n", timeout)
+	if err := waitStackHealthy(ctx, projectDir, timeout); err != nil {
+		return fmt.Errorf("%w\n  The stack is still up for inspection (`make logs`)", err)
+	}
+	return Save(ctx, SaveOpts{
+		ProjectDir: projectDir,
+		Name:       e.Name,
+		Chunked:    chunked,
+	})
+}
+
+// exportSnapshot moves a saved snapshot out of generated/snapshots/ to
+// dst, copying its chunks into dst's sibling chunk store.
+func exportSnapshot(projectDir, name, dst string) error {
+	src := filepath.Join(projectDir, projSnapshotsDir, name)
+	chunks, err := ChunkFiles(src)
+	if err != nil {
+		return err
+	}
+	// Hold the destination store until dst's chunk indexes land, so a GC
+	// there can't drop the chunks copied ahead of them.
+	unlock, err := lockChunkStore(filepath.Dir(dst), false)
+	if err != nil {
+		return err
+	}
+	err = copySnapshot(src, dst, chunks)
+	// Released before Remove, whose GC may be of this same store.
+	unlock()
+	if err != nil {
+		return err
+	}
+	return Remove(projectDir, name)
+}
+
+// copySnapshot copies the snapshot at src, and the chunks it references,
+// to dst.
+func copySnapshot(src, dst string, chunks []string) error {
+	if len(chunks) > 0 {
+		srcStore, dstStore := chunkStoreFor(src), chunkStoreFor(dst)
+		if err := os.MkdirAll(dstStore, 0755); err != nil {
+			return err
+		}
+		for _, c := range chunks {
+			if fileExists(filepath.Join(dstStore, c)) {
+				continue
+			}
+			if err := copyFile(filepath.Join(srcStore, c), filepath.Join(dstStore, c)); err != nil {
+				return fmt.Errorf("copy chunk %s: %w", c, err)
+			}
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(dst); err != nil {
+		return fmt.Errorf("remove old %s: %w", dst, err)
+	}
+	if _, err := copyDir(src, dst); err != nil {
+		return fmt.Errorf("export to %s: %w", dst, err)
+	}
+	return nil
+}
+
+// runMake runs a Makefile target in projectDir, answering its
+// confirmation prompts.
+func runMake(ctx context.Context, projectDir, target string) error {
+	cmd := exec.CommandContext(ctx, "make", target, "YES=1")
+	cmd.Dir = projectDir
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("make %s: %w", target, err)
+	}
+	return nil
+}
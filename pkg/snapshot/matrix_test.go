@@ -0,0 +1,72 @@
+package snapshot
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestParseMatrix(t *testing.T) {
+	m, err := ParseMatrix([]byte(`
+version: 1
+snapshots:
+  - {nodes: 1, db: postgres, blob: s3}
+  - {nodes: 3, db: sqlite, blob: filesystem}
+  - {name: custom, nodes: 2, db: sqlite, blob: s3}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range m.Snapshots {
+		names = append(names, e.Name)
+	}
+	want := []string{"1-piri-s3-postgres", "3-piri-filesystem-sqlite", "custom"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("names = %v, want %v", names, want)
+	}
+
+	nodes, err := m.Snapshots[0].Manifest().Resolve()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 1 || nodes[0].Storage.DB != "postgres" || nodes[0].Storage.Blob != "s3" {
+		t.Errorf("resolved %+v", nodes)
+	}
+
+	bad := map[string]string{
+		"empty":     `version: 1`,
+		"no nodes":  `snapshots: [{db: sqlite, blob: filesystem}]`,
+		"bad db":    `snapshots: [{nodes: 1, db: mysql, blob: filesystem}]`,
+		"too many":  `snapshots: [{nodes: 10, db: sqlite, blob: filesystem}]`,
+		"duplicate": `snapshots: [{nodes: 1, db: sqlite, blob: s3}, {nodes: 1, db: sqlite, blob: s3}]`,
+		"bad name":  `snapshots: [{name: "../x", nodes: 1, db: sqlite, blob: s3}]`,
+	}
+	for name, doc := range bad {
+		if _, err := ParseMatrix([]byte(doc)); err == nil {
+			t.Errorf("%s: want error", name)
+		}
+	}
+}
+
+// The committed matrix must parse and include the snapshot that's
+// already embedded.
+func TestProjectMatrix(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("..", "..", MatrixFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := ParseMatrix(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range m.Snapshots {
+		names = append(names, e.Name)
+	}
+	if !slices.Contains(names, "3-piri-filesystem-sqlite") {
+		t.Errorf("matrix %v lacks the embedded 3-piri-filesystem-sqlite", names)
+	}
+}
@@ -0,0 +1,306 @@
+package snapshot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/compose-spec/compose-go/v2/cli"
+	"github.com/storacha/smelt/pkg/generate"
+	"github.com/storacha/smelt/pkg/manifest"
+)
+
+// ImagePolicy decides what a snapshot load does when the images the
+// snapshot was saved against differ from what compose would run now.
+type ImagePolicy string
+
+const (
+	// ImagePolicyWarn reports drift and loads anyway. The default.
+	ImagePolicyWarn ImagePolicy = "warn"
+	// ImagePolicyFail refuses to load a drifted snapshot.
+	ImagePolicyFail ImagePolicy = "fail"
+	// ImagePolicyPin runs the exact images recorded in the snapshot,
+	// whatever .env or the caller's image overrides say, by setting the
+	// compose image variables to the recorded digests.
+	ImagePolicyPin ImagePolicy = "pin"
+)
+
+// ParseImagePolicy validates a policy name; empty means ImagePolicyWarn.
+func ParseImagePolicy(s string) (ImagePolicy, error) {
+	switch p := ImagePolicy(s); p {
+	case "":
+		return ImagePolicyWarn, nil
+	case ImagePolicyWarn, ImagePolicyFail, ImagePolicyPin:
+		return p, nil
+	}
+	return "", fmt.Errorf("invalid image policy %q (must be %q, %q or %q)",
+		s, ImagePolicyWarn, ImagePolicyFail, ImagePolicyPin)
+}
+
+// ImageDriftError is returned under ImagePolicyFail when a snapshot's
+// images differ from the current ones. Drift holds one line per service,
+// in the same form as the load warning.
+type ImageDriftError struct {
+	Drift []string
+}
+
+func (e *ImageDriftError) Error() string {
+	return fmt.Sprintf("images differ from snapshot (image policy %q):\n  %s",
+		ImagePolicyFail, strings.Join(e.Drift, "\n  "))
+}
+
+// CheckImages compares saved against current and returns the drift
+// lines. Only services the snapshot recorded are compared: a service the
+// current config adds (or a topology the caller hasn't applied yet) is
+// not drift. Under ImagePolicyFail any drift is an *ImageDriftError.
+func CheckImages(policy ImagePolicy, saved, current map[string]ImageInfo) ([]string, error) {
+	relevant := make(map[string]ImageInfo, len(saved))
+	for name := range saved {
+		relevant[name] = current[name]
+	}
+	drift := diffImages(saved, relevant)
+	if len(drift) > 0 && policy == ImagePolicyFail {
+		return drift, &ImageDriftError{Drift: drift}
+	}
+	return drift, nil
+}
+
+// imageEnvVars maps compose services to the variable their image:
+// reference reads (`${PIRI_IMAGE:-…}` etc.). Services missing here use a
+// fixed image in their compose file and can't be pinned through env.
+var imageEnvVars = map[string]string{
+	"blockchain":      "BLOCKCHAIN_IMAGE",
+	"delegator":       "DELEGATOR_IMAGE",
+	"guppy":           "GUPPY_IMAGE",
+	"indexer":         "INDEXER_IMAGE",
+	"ipni":            "IPNI_IMAGE",
+	"ipni-init":       "IPNI_IMAGE",
+	"signing-service": "SIGNER_IMAGE",
+	"upload":          "UPLOAD_IMAGE",
+}
+
+// imageEnvVar returns the env var that sets a service's image. Every
+// piri-N node without a per-node image in smelt.yml reads PIRI_IMAGE.
+func imageEnvVar(service string) (string, bool) {
+	if v, ok := imageEnvVars[service]; ok {
+		return v, true
+	}
+	if strings.HasPrefix(service, "piri-") && service != "piri-postgres" && service != "piri-minio" {
+		return "PIRI_IMAGE", true
+	}
+	return "", false
+}
+
+// PinnedImageEnv returns compose env vars that make each service run the
+// image recorded in saved: its digest reference where known, else its
+// tag. unpinned lists services whose image can't be set through env —
+// fixed images in compose, or services sharing a variable (e.g. several
+// piri nodes) that were saved with different images.
+func PinnedImageEnv(saved map[string]ImageInfo) (env map[string]string, unpinned []string) {
+	env = make(map[string]string)
+	conflict := make(map[string]bool)
+	users := make(map[string][]string)
+	for _, svc := range sortedKeys(saved) {
+		info := saved[svc]
+		key, ok := imageEnvVar(svc)
+		if !ok {
+			unpinned = append(unpinned, svc)
+			continue
+		}
+		ref := info.Digest
+		if ref == "" {
+			ref = info.Tag
+		}
+		if prev, ok := env[key]; ok && prev != ref {
+			conflict[key] = true
+		}
+		env[key] = ref
+		users[key] = append(users[key], svc)
+	}
+	for key := range conflict {
+		delete(env, key)
+		unpinned = append(unpinned, users[key]...)
+	}
+	sort.Strings(unpinned)
+	return env, unpinned
+}
+
+// ComposeImages resolves the image each service would run for the given
+// compose files, with env layered over the process environment and dir's
+// .env. Used by pkg/stack, whose compose project lives in a temp dir and
+// takes its image overrides through env rather than .env. The files are
+// loaded in-process rather than through `docker compose config`, and
+// digests come from the Engine API, so no compose CLI is needed.
+func ComposeImages(ctx context.Context, dir string, files []string, env map[string]string) (map[string]ImageInfo, error) {
+	pairs := make([]string, 0, len(env))
+	for k, v := range env {
+		pairs = append(pairs, k+"="+v)
+	}
+	return loadImages(ctx, files,
+		cli.WithWorkingDirectory(dir),
+		cli.WithOsEnv,
+		cli.WithEnv(pairs),
+		cli.WithEnvFiles(),
+		cli.WithDotEnv,
+	)
+}
+
+// snapshotImages resolves the images the project would run once the
+// snapshot in snapDir is loaded, without loading it: the piri services
+// come from the snapshot's smelt.yml rather than generated/compose/piri.yml,
+// and pins sit between the process environment and .env the way the
+// pinned env file does for `make up`. Load runs it before touching the
+// work tree so a drift failure leaves nothing half-restored.
+func snapshotImages(ctx context.Context, projectDir, snapDir string, pins map[string]string) (map[string]ImageInfo, error) {
+	m, err := manifest.Parse(filepath.Join(snapDir, manifestCopy))
+	if err != nil {
+		return nil, fmt.Errorf("parse snapshot manifest: %w", err)
+	}
+	nodes, err := m.Resolve()
+	if err != nil {
+		return nil, fmt.Errorf("resolve snapshot manifest: %w", err)
+	}
+	piriYAML, err := generate.GeneratePiriCompose(nodes)
+	if err != nil {
+		return nil, fmt.Errorf("generate piri compose: %w", err)
+	}
+	f, err := os.CreateTemp("", "smelt-piri-*.yml")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+	_, err = f.Write(piriYAML)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("write piri compose: %w", err)
+	}
+
+	return loadImages(ctx, []string{filepath.Join(projectDir, "compose.yml")},
+		cli.WithWorkingDirectory(projectDir),
+		cli.WithOsEnv,
+		func(o *cli.ProjectOptions) error {
+			for k, v := range pins {
+				if _, ok := o.Environment[k]; !ok {
+					o.Environment[k] = v
+				}
+			}
+			return nil
+		},
+		cli.WithEnvFiles(),
+		cli.WithDotEnv,
+		cli.WithResourceLoader(includeOverride{
+			dir:  projectDir,
+			from: piriComposeInclude,
+			to:   f.Name(),
+		}),
+	)
+}
+
+// piriComposeInclude is where compose.yml includes the generated piri
+// services from.
+const piriComposeInclude = "generated/compose/piri.yml"
+
+// includeOverride is a compose-go resource loader that swaps one of the
+// project's includes for another file.
+type includeOverride struct {
+	dir, from, to string
+}
+
+func (l includeOverride) Accept(path string) bool {
+	return path == l.from || path == filepath.Join(l.dir, l.from)
+}
+
+func (l includeOverride) Load(_ context.Context, _ string) (string, error) {
+	return l.to, nil
+}
+
+func (l includeOverride) Dir(_ string) string {
+	return filepath.Dir(l.from)
+}
+
+// loadImages loads a compose project in-process and resolves each
+// service's image.
+func loadImages(ctx context.Context, files []string, fns ...cli.ProjectOptionsFn) (map[string]ImageInfo, error) {
+	opts, err := cli.NewProjectOptions(files, append(fns, cli.WithName("smelt-images"))...)
+	if err != nil {
+		return nil, fmt.Errorf("compose options: %w", err)
+	}
+	project, err := opts.LoadProject(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("load compose project: %w", err)
+	}
+	out := make(map[string]ImageInfo, len(project.Services))
+	for name, svc := range project.Services {
+		if svc.Image == "" {
+			continue
+		}
+		out[name] = ImageInfoFor(ctx, svc.Image)
+	}
+	return out, nil
+}
+
+// pinnedEnvFile returns the scratch env file a pinned load writes.
+// `make up` passes it to compose after .env while it exists, and
+// readComposeConfig does the same, so the pins apply to everything that
+// resolves the project's images until the session ends (`make clean`).
+func pinnedEnvFile(projectDir string) string {
+	return filepath.Join(projectDir, projScratchDir, "images.env")
+}
+
+// writePinnedEnv installs env as the session's pinned images, or removes
+// any previous pins when env is empty.
+func writePinnedEnv(projectDir string, env map[string]string) error {
+	p := pinnedEnvFile(projectDir)
+	if len(env) == 0 {
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("remove pinned images: %w", err)
+		}
+		return nil
+	}
+	var buf bytes.Buffer
+	buf.WriteString("# Written by `smelt snapshot load --image-policy pin`; removed by `make clean`.\n")
+	for _, k := range sortedKeys(env) {
+		fmt.Fprintf(&buf, "%s=%s\n", k, env[k])
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(p, buf.Bytes(), 0644)
+}
+
+// composeEnvFileArgs returns the --env-file flags that layer the pinned
+// images over .env, or nothing when no pins are installed. Passing any
+// --env-file disables compose's implicit .env, so it's listed first.
+func composeEnvFileArgs(projectDir string) []string {
+	pins := pinnedEnvFile(projectDir)
+	if !fileExists(pins) {
+		return nil
+	}
+	var args []string
+	if dotenv := filepath.Join(projectDir, ".env"); fileExists(dotenv) {
+		args = append(args, "--env-file", dotenv)
+	}
+	return append(args, "--env-file", pins)
+}
+
+func runComposeConfig(cmd *exec.Cmd) (*composeConfig, error) {
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("docker compose config: %w (%s)", err, stderr.String())
+	}
+	var doc composeConfig
+	if err := json.Unmarshal(stdout.Bytes(), &doc); err != nil {
+		return nil, fmt.Errorf("parse compose config: %w", err)
+	}
+	return &doc, nil
+}
@@ -0,0 +1,216 @@
+package snapshot
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestPinnedImageEnv(t *testing.T) {
+	saved := map[string]ImageInfo{
+		"upload":    {Tag: "ghcr.io/storacha/sprue:main", Digest: "ghcr.io/storacha/sprue@sha256:aa"},
+		"ipni":      {Tag: "ghcr.io/storacha/storetheindex:main", Digest: "ghcr.io/storacha/storetheindex@sha256:bb"},
+		"ipni-init": {Tag: "ghcr.io/storacha/storetheindex:main", Digest: "ghcr.io/storacha/storetheindex@sha256:bb"},
+		"guppy":     {Tag: "guppy:local"},
+		"piri-0":    {Tag: "ghcr.io/storacha/piri:main", Digest: "ghcr.io/storacha/piri@sha256:cc"},
+		"piri-1":    {Tag: "ghcr.io/storacha/piri:dev", Digest: "ghcr.io/storacha/piri@sha256:dd"},
+		"minio":     {Tag: "minio/minio:latest", Digest: "minio/minio@sha256:ee"},
+	}
+	env, unpinned := PinnedImageEnv(saved)
+
+	wantEnv := map[string]string{
+		"UPLOAD_IMAGE": "ghcr.io/storacha/sprue@sha256:aa",
+		"IPNI_IMAGE":   "ghcr.io/storacha/storetheindex@sha256:bb",
+		"GUPPY_IMAGE":  "guppy:local",
+	}
+	if !reflect.DeepEqual(env, wantEnv) {
+		t.Errorf("env: got %v, want %v", env, wantEnv)
+	}
+	// minio has a fixed image; the two piri nodes disagree on the one
+	// PIRI_IMAGE variable they share.
+	wantUnpinned := []string{"minio", "piri-0", "piri-1"}
+	if !reflect.DeepEqual(unpinned, wantUnpinned) {
+		t.Errorf("unpinned: got %v, want %v", unpinned, wantUnpinned)
+	}
+}
+
+func TestCheckImages(t *testing.T) {
+	saved := map[string]ImageInfo{
+		"upload": {Tag: "sprue:main", Digest: "sprue@sha256:aaaa"},
+	}
+	current := map[string]ImageInfo{
+		"upload": {Tag: "sprue:main", Digest: "sprue@sha256:bbbb"},
+		// Present only now: not drift.
+		"piri-3": {Tag: "piri:main"},
+	}
+
+	drift, err := CheckImages(ImagePolicyWarn, saved, current)
+	if err != nil || len(drift) != 1 {
+		t.Fatalf("warn: got drift %v, err %v", drift, err)
+	}
+
+	_, err = CheckImages(ImagePolicyFail, saved, current)
+	var de *ImageDriftError
+	if !errors.As(err, &de) || len(de.Drift) != 1 {
+		t.Fatalf("fail: expected *ImageDriftError with one line, got %v", err)
+	}
+
+	if drift, err := CheckImages(ImagePolicyFail, saved, saved); err != nil || len(drift) != 0 {
+		t.Errorf("identical images: got drift %v, err %v", drift, err)
+	}
+}
+
+func TestParseImagePolicy(t *testing.T) {
+	if p, err := ParseImagePolicy(""); err != nil || p != ImagePolicyWarn {
+		t.Errorf("empty: got %q, %v", p, err)
+	}
+	if p, err := ParseImagePolicy("pin"); err != nil || p != ImagePolicyPin {
+		t.Errorf("pin: got %q, %v", p, err)
+	}
+	if _, err := ParseImagePolicy("strict"); err == nil {
+		t.Error("expected error for unknown policy")
+	}
+}
+
+func TestImageOverrideVar(t *testing.T) {
+	for key, want := range map[string]string{
+		"upload":       "UPLOAD_IMAGE",
+		"piri":         "PIRI_IMAGE",
+		"piri-2":       "PIRI_IMAGE",
+		"ipni-init":    "IPNI_IMAGE",
+		"GUPPY_IMAGE":  "GUPPY_IMAGE",
+		"CUSTOM_IMAGE": "CUSTOM_IMAGE",
+	} {
+		if got, err := imageOverrideVar(key); err != nil || got != want {
+			t.Errorf("%s: got %q, %v; want %q", key, got, err, want)
+		}
+	}
+	for _, key := range []string{"minio", "piri-postgres", "nope"} {
+		if _, err := imageOverrideVar(key); err == nil {
+			t.Errorf("%s: expected error", key)
+		}
+	}
+}
+
+func TestComposeImages(t *testing.T) {
+	dir := t.TempDir()
+	compose := `services:
+  upload:
+    image: ${UPLOAD_IMAGE:-ghcr.io/storacha/sprue:main}
+  piri-0:
+    image: ${PIRI_IMAGE:-ghcr.io/storacha/piri:main}
+  guppy:
+    image: ${GUPPY_IMAGE:-ghcr.io/storacha/guppy:main}
+  built:
+    build: .
+  proxy:
+    image: ubuntu/squid:latest
+    profiles: ["proxy"]
+`
+	if err := os.WriteFile(filepath.Join(dir, "compose.yml"), []byte(compose), 0644); err != nil {
+		t.Fatal(err)
+	}
+	dotenv := "PIRI_IMAGE=piri:dotenv\nGUPPY_IMAGE=guppy:dotenv\n"
+	if err := os.WriteFile(filepath.Join(dir, ".env"), []byte(dotenv), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ComposeImages(t.Context(), dir, []string{filepath.Join(dir, "compose.yml")},
+		map[string]string{"GUPPY_IMAGE": "guppy:env"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tags := make(map[string]string, len(got))
+	for svc, info := range got {
+		tags[svc] = info.Tag
+	}
+	// env beats .env, which beats the compose default. The build-only
+	// service has no image to record and the proxy's profile is inactive.
+	want := map[string]string{
+		"upload": "ghcr.io/storacha/sprue:main",
+		"piri-0": "piri:dotenv",
+		"guppy":  "guppy:env",
+	}
+	if !reflect.DeepEqual(tags, want) {
+		t.Errorf("images: got %v, want %v", tags, want)
+	}
+}
+
+func TestSnapshotImages(t *testing.T) {
+	projectDir := t.TempDir()
+	compose := `include:
+  - path: generated/compose/piri.yml
+services:
+  guppy:
+    image: ${GUPPY_IMAGE:-ghcr.io/storacha/guppy:main}
+  upload:
+    image: ${UPLOAD_IMAGE:-ghcr.io/storacha/sprue:main}
+  blockchain: {image: stub}
+  indexer: {image: stub}
+  signing-service: {image: stub}
+  delegator: {image: stub}
+  dynamodb-local: {image: stub}
+networks:
+  storacha-network:
+`
+	// The work tree's piri.yml is from another topology; the snapshot's
+	// smelt.yml must win without the file being rewritten.
+	current := "services:\n  piri-9:\n    image: piri:worktree\n"
+	piriPath := filepath.Join(projectDir, "generated", "compose", "piri.yml")
+	if err := os.MkdirAll(filepath.Dir(piriPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for path, data := range map[string]string{
+		filepath.Join(projectDir, "compose.yml"): compose,
+		filepath.Join(projectDir, ".env"):        "PIRI_IMAGE=piri:dotenv\nUPLOAD_IMAGE=sprue:dotenv\n",
+		piriPath:                                 current,
+	} {
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	snapDir := t.TempDir()
+	smelt := `version: 1
+piri:
+  nodes:
+    - storage: {db: sqlite, blob: filesystem}
+    - image: piri:custom
+      storage: {db: sqlite, blob: filesystem}
+`
+	if err := os.WriteFile(filepath.Join(snapDir, manifestCopy), []byte(smelt), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GUPPY_IMAGE", "guppy:env")
+
+	got, err := snapshotImages(t.Context(), projectDir, snapDir,
+		map[string]string{"PIRI_IMAGE": "piri:pinned", "GUPPY_IMAGE": "guppy:pinned"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tags := make(map[string]string, len(got))
+	for svc, info := range got {
+		if info.Tag != "stub" {
+			tags[svc] = info.Tag
+		}
+	}
+	// The process env beats pins, which beat .env.
+	want := map[string]string{
+		"piri-0": "piri:pinned",
+		"piri-1": "piri:custom",
+		"guppy":  "guppy:env",
+		"upload": "sprue:dotenv",
+	}
+	if !reflect.DeepEqual(tags, want) {
+		t.Errorf("images: got %v, want %v", tags, want)
+	}
+
+	data, err := os.ReadFile(piriPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != current {
+		t.Errorf("work tree piri.yml was rewritten:\n%s", data)
+	}
+}
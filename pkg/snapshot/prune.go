@@ -0,0 +1,201 @@
+package snapshot
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// PruneOpts selects snapshots under generated/snapshots/ to delete. At
+// least one rule must be set. Pinned snapshots, and ones whose
+// descriptor can't be read, are never selected.
+type PruneOpts struct {
+	ProjectDir string
+	// KeepLast keeps the N most recently created snapshots whatever the
+	// other rules say. Zero keeps none by count.
+	KeepLast int
+	// OlderThan selects snapshots created longer ago than this. Combined
+	// with KeepLast it only applies beyond the kept ones; on its own
+	// KeepLast selects everything beyond the newest N.
+	OlderThan time.Duration
+	// MaxTotalSize, if positive, removes further snapshots, oldest first,
+	// until generated/snapshots/ (chunk store included) fits.
+	MaxTotalSize int64
+	// DryRun plans without deleting anything.
+	DryRun bool
+}
+
+// PruneCandidate is one snapshot a prune removes.
+type PruneCandidate struct {
+	Info
+	// Reason names the rule that selected it.
+	Reason string
+	// FreedBytes is what removing it reclaims: its directory plus any
+	// chunks no remaining snapshot shares.
+	FreedBytes int64
+}
+
+// PruneResult reports a prune, or what a dry run would do.
+type PruneResult struct {
+	Removed []PruneCandidate
+	// TotalBytes and RemainingBytes measure generated/snapshots/ before
+	// and after.
+	TotalBytes     int64
+	RemainingBytes int64
+	// OverBudget is set when MaxTotalSize still isn't met because every
+	// remaining snapshot is pinned or kept.
+	OverBudget bool
+}
+
+// Prune applies the retention rules in opts, removes the selected
+// snapshots (unless DryRun) and then collects the chunks they alone
+// referenced.
+func Prune(opts PruneOpts) (*PruneResult, error) {
+	if opts.KeepLast < 0 || opts.OlderThan < 0 || opts.MaxTotalSize < 0 {
+		return nil, errors.New("prune limits must not be negative")
+	}
+	if opts.KeepLast == 0 && opts.OlderThan == 0 && opts.MaxTotalSize == 0 {
+		return nil, errors.New("prune needs at least one of keep-last, older-than or max-total-size")
+	}
+	infos, err := List(opts.ProjectDir)
+	if err != nil {
+		return nil, err
+	}
+	root := filepath.Join(opts.ProjectDir, projSnapshotsDir)
+	snaps := make([]pruneSnapshot, 0, len(infos))
+	for _, info := range infos {
+		// A directory whose descriptor didn't parse has no files to
+		// scan; it's protected below on its missing CreatedAt.
+		chunks, _ := ChunkFiles(filepath.Join(root, info.Name))
+		snaps = append(snaps, pruneSnapshot{Info: info, chunks: chunks})
+	}
+	chunkSizes, err := storeChunkSizes(filepath.Join(root, ChunkStoreDir))
+	if err != nil {
+		return nil, err
+	}
+
+	res := planPrune(snaps, chunkSizes, opts, time.Now())
+	if opts.DryRun || len(res.Removed) == 0 {
+		return res, nil
+	}
+	for _, c := range res.Removed {
+		if err := os.RemoveAll(filepath.Join(root, c.Name)); err != nil {
+			return nil, fmt.Errorf("remove %s: %w", c.Name, err)
+		}
+	}
+	if err := gcChunks(root); err != nil {
+		return nil, fmt.Errorf("collect unreferenced chunks: %w", err)
+	}
+	return res, nil
+}
+
+// SetPinned marks a snapshot under generated/snapshots/ as protected from
+// (or again subject to) Prune.
+func SetPinned(projectDir, name string, pinned bool) error {
+	if err := validateName(name); err != nil {
+		return err
+	}
+	dir := filepath.Join(projectDir, projSnapshotsDir, name)
+	desc, err := readDescriptor(dir)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("snapshot %q not found", name)
+		}
+		return err
+	}
+	desc.Pinned = pinned
+	return writeDescriptor(dir, desc)
+}
+
+type pruneSnapshot struct {
+	Info
+	chunks []string
+}
+
+// planPrune decides what Prune removes. snaps is newest first, as List
+// returns it; chunkSizes holds the size of every file in the chunk store.
+func planPrune(snaps []pruneSnapshot, chunkSizes map[string]int64, opts PruneOpts, now time.Time) *PruneResult {
+	res := &PruneResult{}
+	refs := make(map[string]int)
+	for _, s := range snaps {
+		res.TotalBytes += s.SizeBytes
+		for _, c := range s.chunks {
+			refs[c]++
+		}
+	}
+	for _, size := range chunkSizes {
+		res.TotalBytes += size
+	}
+	res.RemainingBytes = res.TotalBytes
+
+	remove := func(s pruneSnapshot, reason string) {
+		freed := s.SizeBytes
+		for _, c := range s.chunks {
+			if refs[c]--; refs[c] == 0 {
+				freed += chunkSizes[c]
+			}
+		}
+		res.RemainingBytes -= freed
+		res.Removed = append(res.Removed, PruneCandidate{Info: s.Info, Reason: reason, FreedBytes: freed})
+	}
+
+	// eligible lists, newest first, the snapshots no rule keeps.
+	var eligible []pruneSnapshot
+	for i, s := range snaps {
+		if s.Pinned || s.CreatedAt.IsZero() || i < opts.KeepLast {
+			continue
+		}
+		eligible = append(eligible, s)
+	}
+
+	removed := make(map[string]bool)
+	if opts.KeepLast > 0 || opts.OlderThan > 0 {
+		for _, s := range eligible {
+			var reason string
+			switch {
+			case opts.OlderThan > 0 && now.Sub(s.CreatedAt) > opts.OlderThan:
+				reason = fmt.Sprintf("older than %s", opts.OlderThan)
+			case opts.OlderThan == 0:
+				reason = fmt.Sprintf("beyond the last %d", opts.KeepLast)
+			default:
+				continue
+			}
+			remove(s, reason)
+			removed[s.Name] = true
+		}
+	}
+
+	if opts.MaxTotalSize > 0 {
+		for i := len(eligible) - 1; i >= 0 && res.RemainingBytes > opts.MaxTotalSize; i-- {
+			if s := eligible[i]; !removed[s.Name] {
+				remove(s, "over size budget")
+			}
+		}
+		res.OverBudget = res.RemainingBytes > opts.MaxTotalSize
+	}
+	return res
+}
+
+// storeChunkSizes returns the size of every chunk file in the store, or
+// an empty map when no chunked snapshot was ever saved.
+func storeChunkSizes(storeDir string) (map[string]int64, error) {
+	out := make(map[string]int64)
+	entries, err := os.ReadDir(storeDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return out, nil
+		}
+		return nil, err
+	}
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil {
+			return nil, err
+		}
+		out[e.Name()] = info.Size()
+	}
+	return out, nil
+}
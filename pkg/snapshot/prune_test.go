@@ -0,0 +1,98 @@
+package snapshot
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPlanPrune(t *testing.T) {
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	snap := func(name string, age time.Duration, size int64, chunks ...string) pruneSnapshot {
+		return pruneSnapshot{Info: Info{Name: name, CreatedAt: now.Add(-age), SizeBytes: size}, chunks: chunks}
+	}
+	// Newest first, as List returns them.
+	snaps := []pruneSnapshot{
+		snap("e", 1*day, 100),
+		snap("d", 3*day, 100, "c1", "c2"),
+		snap("c", 8*day, 100, "c2"),
+		snap("b", 10*day, 100),
+		snap("a", 30*day, 100),
+	}
+	snaps[3].Pinned = true
+	chunks := map[string]int64{"c1": 50, "c2": 50}
+
+	names := func(res *PruneResult) []string {
+		var out []string
+		for _, c := range res.Removed {
+			out = append(out, c.Name)
+		}
+		return out
+	}
+
+	tests := []struct {
+		name string
+		opts PruneOpts
+		want []string
+	}{
+		{"keep last", PruneOpts{KeepLast: 2}, []string{"c", "a"}},
+		{"older than", PruneOpts{OlderThan: 7 * day}, []string{"c", "a"}},
+		{"keep last with age", PruneOpts{KeepLast: 3, OlderThan: 7 * day}, []string{"a"}},
+		{"size budget", PruneOpts{MaxTotalSize: 450}, []string{"a", "c"}},
+		{"keep last and size", PruneOpts{KeepLast: 4, MaxTotalSize: 100}, []string{"a"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := planPrune(snaps, chunks, tt.opts, now)
+			if got := names(res); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("removed %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	res := planPrune(snaps, chunks, PruneOpts{MaxTotalSize: 450}, now)
+	if res.TotalBytes != 600 || res.RemainingBytes != 400 || res.OverBudget {
+		t.Errorf("sizes: total=%d remaining=%d over=%v", res.TotalBytes, res.RemainingBytes, res.OverBudget)
+	}
+	// c shares c2 with d, so removing it frees only its own directory.
+	if c := res.Removed[1]; c.FreedBytes != 100 {
+		t.Errorf("c freed %d, want 100", c.FreedBytes)
+	}
+	if res := planPrune(snaps, chunks, PruneOpts{KeepLast: 4, MaxTotalSize: 100}, now); !res.OverBudget {
+		t.Error("expected OverBudget when kept snapshots exceed the budget")
+	}
+}
+
+func TestSetPinned(t *testing.T) {
+	project := t.TempDir()
+	dir := filepath.Join(project, projSnapshotsDir, "base")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeDescriptor(dir, &Descriptor{Name: "base", CreatedAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetPinned(project, "base", true); err != nil {
+		t.Fatal(err)
+	}
+	infos, err := List(project)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 1 || !infos[0].Pinned {
+		t.Fatalf("expected pinned snapshot, got %+v", infos)
+	}
+	res, err := Prune(PruneOpts{ProjectDir: project, OlderThan: time.Nanosecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Removed) != 0 || !dirExists(dir) {
+		t.Errorf("pinned snapshot pruned: %+v", res.Removed)
+	}
+	if err := SetPinned(project, "missing", true); err == nil {
+		t.Error("expected error for missing snapshot")
+	}
+}
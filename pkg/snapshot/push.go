@@ -0,0 +1,373 @@
+package snapshot
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// PushOpts drives Push.
+type PushOpts struct {
+	ProjectDir string
+	// NameOrPath is the local snapshot, as for LoadOpts.
+	NameOrPath string
+	Remote     Remote
+	// As names the snapshot in the remote. Defaults to the local
+	// directory's name.
+	As string
+}
+
+// TransferStats counts what a push or pull moved and what it skipped
+// because the other side already had the content.
+type TransferStats struct {
+	Transferred      int
+	TransferredBytes int64
+	Skipped          int
+}
+
+// Push uploads a snapshot to a remote. The snapshot is verified first,
+// then each file is stored as a blob named by its recorded digest, and
+// each chunk of a chunked volume by its chunk digest — content the
+// remote already holds is skipped. The descriptor is written to the
+// index last, so a pull never sees a snapshot whose blobs aren't all
+// there yet.
+func Push(ctx context.Context, opts PushOpts) (*TransferStats, error) {
+	projectDir, err := filepath.Abs(opts.ProjectDir)
+	if err != nil {
+		return nil, fmt.Errorf("resolve project dir: %w", err)
+	}
+	snapDir, err := resolveSnapshotDir(projectDir, opts.NameOrPath)
+	if err != nil {
+		return nil, err
+	}
+	name := opts.As
+	if name == "" {
+		name = filepath.Base(snapDir)
+	}
+	if err := validateName(name); err != nil {
+		return nil, err
+	}
+	desc, err := VerifyDir(snapDir)
+	if err != nil {
+		return nil, err
+	}
+	if len(desc.Digests) == 0 {
+		return nil, fmt.Errorf("snapshot %s predates content digests; run `smelt snapshot repack` on it first", filepath.Base(snapDir))
+	}
+
+	stats := &TransferStats{}
+	for _, rel := range sortedKeys(desc.Digests) {
+		key, err := remoteBlobKey(desc.Digests[rel])
+		if err != nil {
+			return nil, fmt.Errorf("push %s: %w", rel, err)
+		}
+		if err := pushFile(ctx, opts.Remote, key, filepath.Join(snapDir, filepath.FromSlash(rel)), stats); err != nil {
+			return nil, fmt.Errorf("push %s: %w", rel, err)
+		}
+	}
+	chunks, err := ChunkFiles(snapDir)
+	if err != nil {
+		return nil, err
+	}
+	storeDir := chunkStoreFor(snapDir)
+	for _, c := range chunks {
+		key := path.Join(remoteChunksDir, c)
+		if err := pushFile(ctx, opts.Remote, key, filepath.Join(storeDir, c), stats); err != nil {
+			return nil, fmt.Errorf("push chunk %s: %w", c, err)
+		}
+	}
+
+	// The pin protects a local copy from prune; it isn't the team's call.
+	desc.Name = name
+	desc.Pinned = false
+	data, err := json.MarshalIndent(desc, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("marshal descriptor: %w", err)
+	}
+	if err := opts.Remote.Put(ctx, remoteIndexKey(name), bytes.NewReader(data), int64(len(data))); err != nil {
+		return nil, fmt.Errorf("publish %s: %w", name, err)
+	}
+	return stats, nil
+}
+
+func pushFile(ctx context.Context, remote Remote, key, src string, stats *TransferStats) error {
+	ok, err := remote.Has(ctx, key)
+	if err != nil {
+		return err
+	}
+	if ok {
+		stats.Skipped++
+		return nil
+	}
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if err := remote.Put(ctx, key, f, info.Size()); err != nil {
+		return err
+	}
+	stats.Transferred++
+	stats.TransferredBytes += info.Size()
+	return nil
+}
+
+// PullOpts drives Pull.
+type PullOpts struct {
+	ProjectDir string
+	// Name is the snapshot in the remote's index.
+	Name   string
+	Remote Remote
+	// As names the local copy under generated/snapshots/. Defaults to
+	// Name.
+	As string
+	// Force replaces an existing local snapshot of the same name.
+	Force bool
+}
+
+// Pull downloads a snapshot from a remote into generated/snapshots/.
+// Every blob and chunk is checked against its digest as it's written,
+// chunks the local store already holds are not downloaded again, and the
+// result is verified as a whole before it replaces anything.
+func Pull(ctx context.Context, opts PullOpts) (*TransferStats, error) {
+	if err := validateName(opts.Name); err != nil {
+		return nil, err
+	}
+	name := opts.As
+	if name == "" {
+		name = opts.Name
+	}
+	if err := validateName(name); err != nil {
+		return nil, err
+	}
+	projectDir, err := filepath.Abs(opts.ProjectDir)
+	if err != nil {
+		return nil, fmt.Errorf("resolve project dir: %w", err)
+	}
+	root := filepath.Join(projectDir, projSnapshotsDir)
+	finalDir := filepath.Join(root, name)
+	if _, err := os.Stat(finalDir); err == nil && !opts.Force {
+		return nil, fmt.Errorf("snapshot %q already exists (use --force to overwrite)", name)
+	}
+
+	desc, err := fetchRemoteDescriptor(ctx, opts.Remote, opts.Name)
+	if err != nil {
+		return nil, err
+	}
+	desc.Name = name
+	if err := checkPulledDigests(desc); err != nil {
+		return nil, err
+	}
+
+	stagingDir := filepath.Join(root, "."+name+".tmp")
+	if err := os.RemoveAll(stagingDir); err != nil {
+		return nil, fmt.Errorf("clear staging dir: %w", err)
+	}
+	defer os.RemoveAll(stagingDir)
+
+	stats := &TransferStats{}
+	for _, rel := range sortedKeys(desc.Digests) {
+		dst := filepath.Join(stagingDir, filepath.FromSlash(rel))
+		if err := pullBlob(ctx, opts.Remote, desc.Digests[rel], dst, stats); err != nil {
+			return nil, fmt.Errorf("pull %s: %w", rel, err)
+		}
+	}
+	chunks, err := ChunkFiles(stagingDir)
+	if err != nil {
+		return nil, err
+	}
+	storeDir := filepath.Join(root, ChunkStoreDir)
+	// Hold off a concurrent prune's GC until the snapshot is committed:
+	// it would see the chunks being downloaded as unreferenced.
+	unlock, err := lockChunkStore(root, false)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	for _, c := range chunks {
+		if fileExists(filepath.Join(storeDir, c)) {
+			stats.Skipped++
+			continue
+		}
+		if err := pullChunk(ctx, opts.Remote, storeDir, c, stats); err != nil {
+			return nil, fmt.Errorf("pull chunk %s: %w", c, err)
+		}
+	}
+
+	if err := writeDescriptor(stagingDir, desc); err != nil {
+		return nil, err
+	}
+	if _, err := VerifyDir(stagingDir); err != nil {
+		return nil, err
+	}
+	if err := os.RemoveAll(finalDir); err != nil {
+		return nil, fmt.Errorf("remove old snapshot: %w", err)
+	}
+	if err := os.Rename(stagingDir, finalDir); err != nil {
+		return nil, fmt.Errorf("commit snapshot: %w", err)
+	}
+	return stats, nil
+}
+
+// checkPulledDigests rejects a remote descriptor whose Digests would
+// write outside the snapshot or name a blob by anything but a sha256
+// digest. The descriptor is untrusted until every file it lists has been
+// verified, so this runs before any of them are fetched.
+func checkPulledDigests(desc *Descriptor) error {
+	for rel, digest := range desc.Digests {
+		if !filepath.IsLocal(filepath.FromSlash(rel)) {
+			return fmt.Errorf("snapshot %s: file path %q escapes the snapshot", desc.Name, rel)
+		}
+		if !digestPattern.MatchString(digest) {
+			return fmt.Errorf("snapshot %s: invalid digest %q for %s", desc.Name, digest, rel)
+		}
+	}
+	return nil
+}
+
+func pullBlob(ctx context.Context, remote Remote, digest, dst string, stats *TransferStats) error {
+	key, err := remoteBlobKey(digest)
+	if err != nil {
+		return err
+	}
+	rc, err := remote.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(f, h), rc)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if got := digestPrefix + hex.EncodeToString(h.Sum(nil)); got != digest {
+		return fmt.Errorf("digest mismatch (want %s, got %s)", shortDigest(digest), shortDigest(got))
+	}
+	stats.Transferred++
+	stats.TransferredBytes += n
+	return nil
+}
+
+// pullChunk downloads a chunk into the store through a temp file and
+// checks it decompresses to the digest its name records before renaming
+// it into place. The store is shared and later pulls skip chunks already
+// in it, so an interrupted or corrupt download must never land there.
+func pullChunk(ctx context.Context, remote Remote, storeDir, name string, stats *TransferStats) error {
+	digest := digestPrefix + strings.TrimSuffix(name, ".zst")
+	if !digestPattern.MatchString(digest) {
+		return fmt.Errorf("invalid chunk name %q", name)
+	}
+	rc, err := remote.Get(ctx, path.Join(remoteChunksDir, name))
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	if err := os.MkdirAll(storeDir, 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(storeDir, "."+name+".*")
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(tmp, rc)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		var got string
+		if got, _, err = chunkDigest(tmp.Name()); err == nil && got != digest {
+			err = fmt.Errorf("digest mismatch (want %s, got %s)", shortDigest(digest), shortDigest(got))
+		}
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), filepath.Join(storeDir, name))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	stats.Transferred++
+	stats.TransferredBytes += n
+	return nil
+}
+
+func fetchRemoteDescriptor(ctx context.Context, remote Remote, name string) (*Descriptor, error) {
+	rc, err := remote.Get(ctx, remoteIndexKey(name))
+	if err != nil {
+		if errors.Is(err, ErrRemoteNotFound) {
+			return nil, fmt.Errorf("snapshot %q not found in remote", name)
+		}
+		return nil, err
+	}
+	defer rc.Close()
+	var desc Descriptor
+	if err := json.NewDecoder(rc).Decode(&desc); err != nil {
+		return nil, fmt.Errorf("parse remote descriptor %s: %w", name, err)
+	}
+	if len(desc.Digests) == 0 {
+		return nil, fmt.Errorf("remote descriptor %s has no digests", name)
+	}
+	return &desc, nil
+}
+
+// RemoteInfo summarises one snapshot in a remote's index.
+type RemoteInfo struct {
+	Name      string
+	CreatedAt time.Time
+	Volumes   []string
+	Images    map[string]ImageInfo
+}
+
+// ListRemote returns the snapshots in a remote's index, newest first.
+func ListRemote(ctx context.Context, remote Remote) ([]RemoteInfo, error) {
+	keys, err := remote.List(ctx, remoteIndexDir+"/")
+	if err != nil {
+		return nil, err
+	}
+	var out []RemoteInfo
+	for _, key := range keys {
+		name, ok := strings.CutSuffix(path.Base(key), ".json")
+		if !ok || path.Dir(key) != remoteIndexDir {
+			continue
+		}
+		desc, err := fetchRemoteDescriptor(ctx, remote, name)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, RemoteInfo{
+			Name:      name,
+			CreatedAt: desc.CreatedAt,
+			Volumes:   desc.Volumes,
+			Images:    desc.Images,
+		})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].CreatedAt.After(out[j].CreatedAt)
+	})
+	return out, nil
+}
@@ -0,0 +1,224 @@
+package snapshot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPushPull(t *testing.T) {
+	ctx := context.Background()
+	src := writeTestSnapshot(t, true)
+	remote, err := OpenRemote("file://" + filepath.ToSlash(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := Push(ctx, PushOpts{ProjectDir: t.TempDir(), NameOrPath: src, Remote: remote, As: "base"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Transferred != 6 || stats.Skipped != 0 {
+		t.Errorf("first push: %+v", stats)
+	}
+	// Same content under another name uploads nothing but the index.
+	stats, err = Push(ctx, PushOpts{ProjectDir: t.TempDir(), NameOrPath: src, Remote: remote, As: "base-copy"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Transferred != 0 || stats.Skipped != 6 {
+		t.Errorf("second push: %+v", stats)
+	}
+
+	list, err := ListRemote(ctx, remote)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 {
+		t.Fatalf("remote index: %+v", list)
+	}
+
+	project := t.TempDir()
+	if _, err := Pull(ctx, PullOpts{ProjectDir: project, Name: "base", Remote: remote}); err != nil {
+		t.Fatal(err)
+	}
+	pulled := filepath.Join(project, projSnapshotsDir, "base")
+	desc, err := VerifyDir(pulled)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := readDescriptor(src)
+	if desc.Name != "base" || !reflect.DeepEqual(desc.Digests, want.Digests) {
+		t.Errorf("pulled descriptor: %+v", desc)
+	}
+	if _, err := Pull(ctx, PullOpts{ProjectDir: project, Name: "base", Remote: remote}); err == nil {
+		t.Error("expected error pulling over an existing snapshot without Force")
+	}
+	if _, err := Pull(ctx, PullOpts{ProjectDir: project, Name: "missing", Remote: remote}); err == nil ||
+		!strings.Contains(err.Error(), "not found") {
+		t.Errorf("missing snapshot: %v", err)
+	}
+}
+
+func TestPullRejectsCorruptBlob(t *testing.T) {
+	ctx := context.Background()
+	src := writeTestSnapshot(t, true)
+	root := t.TempDir()
+	remote, err := OpenRemote("file://" + filepath.ToSlash(root))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Push(ctx, PushOpts{ProjectDir: t.TempDir(), NameOrPath: src, Remote: remote, As: "base"}); err != nil {
+		t.Fatal(err)
+	}
+	desc, _ := readDescriptor(src)
+	key, err := remoteBlobKey(desc.Digests["keys/piri-0.pem"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	blob := filepath.Join(root, filepath.FromSlash(key))
+	if err := os.WriteFile(blob, []byte("tampered"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	project := t.TempDir()
+	_, err = Pull(ctx, PullOpts{ProjectDir: project, Name: "base", Remote: remote})
+	if err == nil || !strings.Contains(err.Error(), "digest mismatch") {
+		t.Fatalf("expected digest mismatch, got %v", err)
+	}
+	if dirExists(filepath.Join(project, projSnapshotsDir, "base")) {
+		t.Error("corrupt pull left a snapshot behind")
+	}
+}
+
+func TestPullRejectsUnsafeDescriptor(t *testing.T) {
+	ctx := context.Background()
+	src := writeTestSnapshot(t, true)
+	remote, err := OpenRemote("file://" + filepath.ToSlash(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Push(ctx, PushOpts{ProjectDir: t.TempDir(), NameOrPath: src, Remote: remote, As: "base"}); err != nil {
+		t.Fatal(err)
+	}
+	good, _ := readDescriptor(src)
+	digest := good.Digests["keys/piri-0.pem"]
+
+	tests := []struct {
+		name      string
+		rel, dgst string
+		want      string
+	}{
+		{name: "parent path", rel: "../../escaped", dgst: digest, want: "escapes the snapshot"},
+		{name: "absolute path", rel: "/tmp/escaped", dgst: digest, want: "escapes the snapshot"},
+		{name: "traversing digest", rel: "keys/piri-0.pem", dgst: "sha256:../../../escaped", want: "invalid digest"},
+		{name: "short digest", rel: "keys/piri-0.pem", dgst: "sha256:abcd", want: "invalid digest"},
+		{name: "other algorithm", rel: "keys/piri-0.pem", dgst: "md5:" + strings.Repeat("0", 64), want: "invalid digest"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			desc, _ := readDescriptor(src)
+			desc.Digests[tt.rel] = tt.dgst
+			data, err := json.Marshal(desc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := remote.Put(ctx, remoteIndexKey("evil"), bytes.NewReader(data), int64(len(data))); err != nil {
+				t.Fatal(err)
+			}
+
+			project := t.TempDir()
+			_, err = Pull(ctx, PullOpts{ProjectDir: project, Name: "evil", Remote: remote})
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("expected %q error, got %v", tt.want, err)
+			}
+			if fileExists(filepath.Join(project, "escaped")) || fileExists(filepath.Join(filepath.Dir(project), "escaped")) {
+				t.Error("pull wrote outside the snapshot")
+			}
+		})
+	}
+}
+
+func TestPullRejectsCorruptChunk(t *testing.T) {
+	ctx := context.Background()
+	// The test snapshot with its volume re-saved as chunks.
+	src := writeTestSnapshot(t, true)
+	volsDir := filepath.Join(src, subdirVolumes)
+	if err := os.Remove(filepath.Join(volsDir, "piri-0-data"+extTar)); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeVolumeArchive(bytes.NewReader(randomBytes(t, 4, 2<<20)), volsDir, "piri-0-data", chunkStoreFor(src)); err != nil {
+		t.Fatal(err)
+	}
+	desc, _ := readDescriptor(src)
+	digests, err := computeDigests(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	desc.Digests = digests
+	if err := writeDescriptor(src, desc); err != nil {
+		t.Fatal(err)
+	}
+
+	root := t.TempDir()
+	remote, err := OpenRemote("file://" + filepath.ToSlash(root))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Push(ctx, PushOpts{ProjectDir: t.TempDir(), NameOrPath: src, Remote: remote, As: "base"}); err != nil {
+		t.Fatal(err)
+	}
+	chunks, err := ChunkFiles(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Swap one chunk for another's bytes: still valid zstd, wrong digest.
+	if len(chunks) < 2 {
+		t.Fatalf("expected several chunks, got %d", len(chunks))
+	}
+	remoteChunk := filepath.Join(root, remoteChunksDir, chunks[0])
+	good, err := os.ReadFile(remoteChunk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := os.ReadFile(filepath.Join(root, remoteChunksDir, chunks[1]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(remoteChunk, other, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	project := t.TempDir()
+	_, err = Pull(ctx, PullOpts{ProjectDir: project, Name: "base", Remote: remote})
+	if err == nil || !strings.Contains(err.Error(), "digest mismatch") {
+		t.Fatalf("expected digest mismatch, got %v", err)
+	}
+	store := filepath.Join(project, projSnapshotsDir, ChunkStoreDir)
+	entries, err := os.ReadDir(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if e.Name() == chunks[0] || strings.HasPrefix(e.Name(), ".") {
+			t.Errorf("corrupt pull left %s in the chunk store", e.Name())
+		}
+	}
+
+	// Once the remote is repaired, the next pull fetches the chunk again
+	// rather than trusting a bad local copy.
+	if err := os.WriteFile(remoteChunk, good, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Pull(ctx, PullOpts{ProjectDir: project, Name: "base", Remote: remote}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyDir(filepath.Join(project, projSnapshotsDir, "base")); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,220 @@
+package snapshot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/storacha/smelt/internal/dockerapi"
+)
+
+// RebaseOpts drives Rebase.
+type RebaseOpts struct {
+	ProjectDir string
+	// NameOrPath is the snapshot to rebase, as for LoadOpts.
+	NameOrPath string
+	// Images maps image keys to new references. A key is a compose
+	// service ("upload"), "piri" for every piri node, or the env
+	// variable itself ("UPLOAD_IMAGE").
+	Images map[string]string
+	// As names the rebased snapshot under generated/snapshots/. Defaults
+	// to the source's name, replacing it when the source lives there.
+	As string
+	// HealthTimeout bounds the wait for every service to come up healthy
+	// against the old state. Defaults to 5 minutes.
+	HealthTimeout time.Duration
+}
+
+// Rebase moves a snapshot onto new images: it loads the snapshot with
+// every other image pinned to its recorded digest, boots the stack with
+// the replacement images, waits for every service to come up healthy —
+// which is when services have finished migrating the old state — and
+// saves the result. Services that fail to come up are reported and the
+// stack is left running for inspection.
+func Rebase(ctx context.Context, opts RebaseOpts) error {
+	if len(opts.Images) == 0 {
+		return errors.New("rebase needs at least one image override")
+	}
+	projectDir, err := filepath.Abs(opts.ProjectDir)
+	if err != nil {
+		return fmt.Errorf("resolve project dir: %w", err)
+	}
+	overrides := make(map[string]string, len(opts.Images))
+	for key, ref := range opts.Images {
+		envVar, err := imageOverrideVar(key)
+		if err != nil {
+			return err
+		}
+		if ref == "" {
+			return fmt.Errorf("image override %q has no reference", key)
+		}
+		overrides[envVar] = ref
+	}
+
+	snapDir, err := resolveSnapshotDir(projectDir, opts.NameOrPath)
+	if err != nil {
+		return err
+	}
+	target := opts.As
+	if target == "" {
+		target = filepath.Base(snapDir)
+	}
+	if err := validateName(target); err != nil {
+		return err
+	}
+	timeout := opts.HealthTimeout
+	if timeout == 0 {
+		timeout = 5 * time.Minute
+	}
+
+	if err := Load(ctx, LoadOpts{
+		ProjectDir:  projectDir,
+		NameOrPath:  snapDir,
+		ImagePolicy: ImagePolicyPin,
+	}); err != nil {
+		return err
+	}
+
+	// Layer the replacements over the pins Load just wrote. Reading the
+	// pins back through env keeps one source of truth for the variables.
+	desc, err := readDescriptor(snapDir)
+	if err != nil {
+		return err
+	}
+	env, _ := PinnedImageEnv(desc.Images)
+	for k, v := range overrides {
+		env[k] = v
+	}
+	if err := writePinnedEnv(projectDir, env); err != nil {
+		return err
+	}
+	fmt.Printf("\nRebasing onto:\n")
+	for _, k := range sortedKeys(overrides) {
+		fmt.Printf("  %s=%s\n", k, overrides[k])
+	}
+
+	fmt.Printf("Starting stack against the snapshot's state...\n")
+	if err := composeUp(ctx, projectDir); err != nil {
+		return err
+	}
+	fmt.Printf("Waiting up to %s for every service to become healthy...\n", timeout)
+	if err := waitStackHealthy(ctx, projectDir, timeout); err != nil {
+		return fmt.Errorf("%w\n  The stack is still up for inspection (`make logs`); the snapshot was not re-saved", err)
+	}
+
+	if err := Save(ctx, SaveOpts{
+		ProjectDir: projectDir,
+		Name:       target,
+		Force:      true,
+	}); err != nil {
+		return err
+	}
+
+	// Services that kept their image ran it by digest reference, which
+	// Save records as the tag. Restore the original tags so later loads
+	// compare against `.env`'s references rather than report tag drift.
+	savedDir := filepath.Join(projectDir, projSnapshotsDir, target)
+	rebased, err := readDescriptor(savedDir)
+	if err != nil {
+		return err
+	}
+	for svc, info := range rebased.Images {
+		if old, ok := desc.Images[svc]; ok && old.Digest != "" && old.Digest == info.Digest {
+			info.Tag = old.Tag
+			rebased.Images[svc] = info
+		}
+	}
+	return writeDescriptor(savedDir, rebased)
+}
+
+// imageOverrideVar maps a rebase image key to the compose env variable
+// that sets it.
+func imageOverrideVar(key string) (string, error) {
+	if strings.HasSuffix(key, "_IMAGE") {
+		return key, nil
+	}
+	if key == "piri" {
+		return "PIRI_IMAGE", nil
+	}
+	if v, ok := imageEnvVar(key); ok {
+		return v, nil
+	}
+	known := []string{"piri"}
+	for svc := range imageEnvVars {
+		known = append(known, svc)
+	}
+	sort.Strings(known)
+	return "", fmt.Errorf("no image variable for %q (known: %s, or a *_IMAGE variable)",
+		key, strings.Join(known, ", "))
+}
+
+// composeUp starts the project with any pinned images applied, the way
+// `make up` does.
+func composeUp(ctx context.Context, projectDir string) error {
+	args := append(composeEnvFileArgs(projectDir), "up", "-d", "--remove-orphans")
+	cmd := dockerapi.Compose(ctx, projectDir, args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("compose up: %w", err)
+	}
+	return nil
+}
+
+// UnhealthyError lists the services that hadn't come up when the wait
+// gave up.
+type UnhealthyError struct {
+	Waited   time.Duration
+	Services []string
+}
+
+func (e *UnhealthyError) Error() string {
+	return fmt.Sprintf("services not healthy after %s:\n  %s", e.Waited, strings.Join(e.Services, "\n  "))
+}
+
+// waitStackHealthy polls `docker compose ps` until every service is
+// running and healthy (or a one-shot that exited 0) — the same bar
+// requireStackUp sets for a save. A service that exits non-zero fails
+// the wait immediately rather than running out the clock; an unhealthy
+// one is given until the deadline, since healthchecks can recover.
+func waitStackHealthy(ctx context.Context, projectDir string, timeout time.Duration) error {
+	start := time.Now()
+	deadline := start.Add(timeout)
+	for {
+		services, err := stackStatus(ctx, projectDir)
+		if err != nil {
+			return err
+		}
+		var pending, failed []string
+		for _, s := range services {
+			switch {
+			case s.State == "running" && (s.Health == "" || s.Health == "healthy"):
+			case s.State == "exited" && s.ExitCode == 0:
+			case s.State == "exited":
+				failed = append(failed, fmt.Sprintf("%s (state=%s, health=%s, exit=%d)",
+					s.Name, s.State, s.Health, s.ExitCode))
+			default:
+				pending = append(pending, fmt.Sprintf("%s (state=%s, health=%s)", s.Name, s.State, s.Health))
+			}
+		}
+		if len(failed) > 0 {
+			return &UnhealthyError{Waited: time.Since(start).Round(time.Second), Services: append(failed, pending...)}
+		}
+		if len(pending) == 0 && len(services) > 0 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return &UnhealthyError{Waited: timeout, Services: pending}
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(2 * time.Second):
+		}
+	}
+}
@@ -0,0 +1,268 @@
+package snapshot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// ErrRemoteNotFound is returned by Remote.Get for a key the remote
+// doesn't hold.
+var ErrRemoteNotFound = errors.New("not found in remote")
+
+// Remote is a shared object store that snapshots are pushed to and pulled
+// from. Keys are slash-separated and relative to the remote's root.
+// Objects are immutable once written: every key but a snapshot's index
+// entry is content-addressed.
+type Remote interface {
+	// Has reports whether key exists.
+	Has(ctx context.Context, key string) (bool, error)
+	// Get opens key for reading, or returns ErrRemoteNotFound.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Put stores size bytes from r under key, replacing any existing
+	// object.
+	Put(ctx context.Context, key string, r io.Reader, size int64) error
+	// List returns every key under prefix, sorted.
+	List(ctx context.Context, prefix string) ([]string, error)
+}
+
+// OpenRemote opens a remote by URL:
+//
+//   - s3://bucket/prefix — an S3 bucket. Credentials, region and endpoint
+//     come from the standard AWS variables (AWS_ACCESS_KEY_ID,
+//     AWS_SECRET_ACCESS_KEY, AWS_REGION, AWS_ENDPOINT_URL) or
+//     ~/.aws/credentials. Point AWS_ENDPOINT_URL at the stack's MinIO
+//     (http://localhost:15070, minioadmin/minioadmin) to try it locally.
+//   - file:///path — a directory, e.g. on a shared mount.
+func OpenRemote(rawURL string) (Remote, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("parse remote %q: %w", rawURL, err)
+	}
+	switch u.Scheme {
+	case "s3":
+		return openS3Remote(u)
+	case "file":
+		if u.Path == "" {
+			return nil, fmt.Errorf("remote %q has no path", rawURL)
+		}
+		return &dirRemote{root: filepath.FromSlash(u.Path)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported remote %q (want s3://bucket/prefix or file:///path)", rawURL)
+	}
+}
+
+// dirRemote is a Remote rooted at a local directory.
+type dirRemote struct {
+	root string
+}
+
+func (r *dirRemote) path(key string) string {
+	return filepath.Join(r.root, filepath.FromSlash(key))
+}
+
+func (r *dirRemote) Has(_ context.Context, key string) (bool, error) {
+	_, err := os.Stat(r.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (r *dirRemote) Get(_ context.Context, key string) (io.ReadCloser, error) {
+	f, err := os.Open(r.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%s: %w", key, ErrRemoteNotFound)
+	}
+	return f, err
+}
+
+// Put writes through a temp file so a reader never sees a partial object.
+func (r *dirRemote) Put(_ context.Context, key string, src io.Reader, _ int64) error {
+	dst := r.path(key)
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(tmp, src); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), dst)
+}
+
+func (r *dirRemote) List(_ context.Context, prefix string) ([]string, error) {
+	var keys []string
+	err := filepath.WalkDir(r.root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) && p == r.root {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".") {
+			return nil
+		}
+		rel, err := filepath.Rel(r.root, p)
+		if err != nil {
+			return err
+		}
+		if key := filepath.ToSlash(rel); strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	sort.Strings(keys)
+	return keys, err
+}
+
+// s3Remote is a Remote in an S3 bucket, under an optional key prefix.
+type s3Remote struct {
+	client *minio.Client
+	bucket string
+	prefix string
+}
+
+func openS3Remote(u *url.URL) (*s3Remote, error) {
+	if u.Host == "" {
+		return nil, fmt.Errorf("remote %q has no bucket", u.String())
+	}
+	endpoint, secure := "s3.amazonaws.com", true
+	lookup := minio.BucketLookupAuto
+	if raw := firstEnv("AWS_ENDPOINT_URL_S3", "AWS_ENDPOINT_URL"); raw != "" {
+		eu, err := url.Parse(raw)
+		if err != nil || eu.Host == "" {
+			return nil, fmt.Errorf("invalid S3 endpoint %q", raw)
+		}
+		endpoint, secure = eu.Host, eu.Scheme != "http"
+		// Custom endpoints (MinIO, localstack) rarely have wildcard DNS
+		// for virtual-hosted buckets.
+		lookup = minio.BucketLookupPath
+	}
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds: credentials.NewChainCredentials([]credentials.Provider{
+			&credentials.EnvAWS{},
+			&credentials.EnvMinio{},
+			&credentials.FileAWSCredentials{},
+		}),
+		Secure:       secure,
+		Region:       firstEnv("AWS_REGION", "AWS_DEFAULT_REGION"),
+		BucketLookup: lookup,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("s3 client: %w", err)
+	}
+	prefix := strings.Trim(u.Path, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+	return &s3Remote{client: client, bucket: u.Host, prefix: prefix}, nil
+}
+
+func (r *s3Remote) Has(ctx context.Context, key string) (bool, error) {
+	_, err := r.client.StatObject(ctx, r.bucket, r.prefix+key, minio.StatObjectOptions{})
+	if err == nil {
+		return true, nil
+	}
+	if minio.ToErrorResponse(err).Code == minio.NoSuchKey {
+		return false, nil
+	}
+	return false, fmt.Errorf("stat s3://%s/%s%s: %w", r.bucket, r.prefix, key, err)
+}
+
+func (r *s3Remote) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	obj, err := r.client.GetObject(ctx, r.bucket, r.prefix+key, minio.GetObjectOptions{})
+	if err == nil {
+		// GetObject is lazy; Stat surfaces a missing key up front.
+		_, err = obj.Stat()
+	}
+	if err != nil {
+		if obj != nil {
+			obj.Close()
+		}
+		if minio.ToErrorResponse(err).Code == minio.NoSuchKey {
+			return nil, fmt.Errorf("%s: %w", key, ErrRemoteNotFound)
+		}
+		return nil, fmt.Errorf("get s3://%s/%s%s: %w", r.bucket, r.prefix, key, err)
+	}
+	return obj, nil
+}
+
+func (r *s3Remote) Put(ctx context.Context, key string, src io.Reader, size int64) error {
+	_, err := r.client.PutObject(ctx, r.bucket, r.prefix+key, src, size, minio.PutObjectOptions{
+		ContentType: "application/octet-stream",
+	})
+	if err != nil {
+		return fmt.Errorf("put s3://%s/%s%s: %w", r.bucket, r.prefix, key, err)
+	}
+	return nil
+}
+
+func (r *s3Remote) List(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	for obj := range r.client.ListObjects(ctx, r.bucket, minio.ListObjectsOptions{
+		Prefix:    r.prefix + prefix,
+		Recursive: true,
+	}) {
+		if obj.Err != nil {
+			return nil, fmt.Errorf("list s3://%s/%s%s: %w", r.bucket, r.prefix, prefix, obj.Err)
+		}
+		keys = append(keys, strings.TrimPrefix(obj.Key, r.prefix))
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func firstEnv(names ...string) string {
+	for _, n := range names {
+		if v := os.Getenv(n); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// Remote layout. The index entry is the snapshot's descriptor; its
+// Digests name every file's blob, so a snapshot shares blobs with every
+// other snapshot holding identical files.
+const (
+	remoteIndexDir  = "snapshots"
+	remoteBlobsDir  = "blobs/sha256"
+	remoteChunksDir = "chunks"
+)
+
+func remoteIndexKey(name string) string {
+	return path.Join(remoteIndexDir, name+".json")
+}
+
+// digestPattern is the only digest form blobs are stored under. A pulled
+// descriptor's digests come from the remote, so they are checked against
+// it before they name a key.
+var digestPattern = regexp.MustCompile(`^sha256:[0-9a-f]{64}$`)
+
+func remoteBlobKey(digest string) (string, error) {
+	if !digestPattern.MatchString(digest) {
+		return "", fmt.Errorf("invalid digest %q", digest)
+	}
+	return path.Join(remoteBlobsDir, strings.TrimPrefix(digest, digestPrefix)), nil
+}
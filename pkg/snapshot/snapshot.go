@@ -3,7 +3,8 @@
 // dance. A snapshot includes:
 //
 //   - The anvil chain state dumped by the blockchain container on shutdown
-//   - Every docker-compose volume referenced by the resolved manifest
+//   - Every named volume mounted by a service in the resolved compose
+//     config, narrowed by the manifest's snapshot include/exclude rules
 //   - All service identity keys under generated/keys/
 //   - A copy of smelt.yml for provenance
 //
@@ -52,11 +53,25 @@ type SaveOpts struct {
 	ProjectDir string
 	Name       string
 	Force      bool // overwrite an existing snapshot with the same name
+	// Chunked stores volume archives as content-addressed chunks in the
+	// shared generated/snapshots/.chunks/ store instead of one zstd tar
+	// per volume. Snapshots that share most of their volume contents
+	// (e.g. successive checkpoints of the same stack) then only pay for
+	// the chunks that changed.
+	Chunked bool
+	// Live saves without stopping the stack: chain state comes from
+	// anvil's anvil_dumpState RPC instead of the SIGTERM dump, and the
+	// services writing to snapshot volumes are paused (docker compose
+	// pause) only while their volumes are archived. The result is a
+	// crash-consistent checkpoint — as if the host lost power at that
+	// instant — which every service here recovers from on boot.
+	Live bool
 }
 
 // Save captures the current stack state under generated/snapshots/<name>/.
 // The stack is left stopped on success so the user can decide whether to
-// restart it or immediately work from the newly-saved baseline.
+// restart it or immediately work from the newly-saved baseline — unless
+// opts.Live is set, in which case it keeps running throughout.
 func Save(ctx context.Context, opts SaveOpts) error {
 	if err := validateName(opts.Name); err != nil {
 		return err
@@ -74,7 +89,7 @@ func Save(ctx context.Context, opts SaveOpts) error {
 	if err != nil {
 		return err
 	}
-	vols, err := resolveVolumes(m)
+	vols, err := resolveVolumes(ctx, projectDir, m)
 	if err != nil {
 		return err
 	}
@@ -122,35 +137,85 @@ func Save(ctx context.Context, opts SaveOpts) error {
 		return fmt.Errorf("capture images: %w", err)
 	}
 
-	// Clear the scratch dir so we know any files that appear came from THIS
-	// stop, not a prior run. The blockchain container's trap writes atomically
-	// (.tmp + mv) so a crash mid-write can't confuse us either way.
 	scratchDir := filepath.Join(projectDir, projScratchDir)
-	if err := clearDir(scratchDir); err != nil {
-		return fmt.Errorf("clear scratch dir: %w", err)
-	}
-
-	fmt.Printf("Stopping stack (triggers blockchain state dump)...\n")
-	if err := stopStack(ctx, projectDir); err != nil {
+	bcStaging := filepath.Join(stagingDir, subdirBlockchain)
+	if err := os.MkdirAll(bcStaging, 0755); err != nil {
 		return err
 	}
 
-	// Wait briefly for the scratch files to land — compose stop returns once
-	// containers have exited, but the trap's `mv` may trail by a few ms.
-	if err := waitForFile(filepath.Join(scratchDir, "anvil-state.json"), 5*time.Second); err != nil {
-		return fmt.Errorf("blockchain did not produce an anvil-state.json on shutdown: %w", err)
+	// resume unpauses whatever a live save froze. Called explicitly once
+	// volumes are archived, and deferred so an early return never leaves
+	// the stack frozen. Uses a fresh context: if ctx was cancelled, we
+	// still want the containers back.
+	var paused []string
+	resume := func() {
+		if len(paused) == 0 {
+			return
+		}
+		fmt.Printf("Resuming %s...\n", strings.Join(paused, ", "))
+		if err := unpauseServices(context.Background(), projectDir, paused); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: %v; run `docker compose unpause` manually\n", err)
+		}
+		paused = nil
 	}
+	defer resume()
 
-	fmt.Printf("Archiving blockchain state...\n")
-	bcStaging := filepath.Join(stagingDir, subdirBlockchain)
-	if err := os.MkdirAll(bcStaging, 0755); err != nil {
-		return err
-	}
-	for _, f := range []string{"anvil-state.json", "deployed-addresses.json"} {
-		src := filepath.Join(scratchDir, f)
-		dst := filepath.Join(bcStaging, f)
-		if err := copyFile(src, dst); err != nil {
-			return fmt.Errorf("copy %s: %w", f, err)
+	if opts.Live {
+		// Freeze writers first, then dump: anvil keeps mining empty blocks
+		// but nothing can submit transactions, so chain state and volume
+		// contents describe the same moment.
+		writers, err := volumeWriters(ctx, projectDir, vols)
+		if err != nil {
+			return err
+		}
+		rpcURL, err := blockchainRPCURL(ctx, projectDir)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Pausing %s...\n", strings.Join(writers, ", "))
+		if err := pauseServices(ctx, projectDir, writers); err != nil {
+			return err
+		}
+		paused = writers
+
+		fmt.Printf("Dumping blockchain state (anvil_dumpState)...\n")
+		if err := dumpAnvilState(ctx, rpcURL, filepath.Join(bcStaging, "anvil-state.json")); err != nil {
+			return err
+		}
+		// Deployed addresses never change at runtime; the copy the chain
+		// booted from is current.
+		if err := copyFile(
+			filepath.Join(scratchDir, "deployed-addresses.json"),
+			filepath.Join(bcStaging, "deployed-addresses.json"),
+		); err != nil {
+			return fmt.Errorf("copy deployed-addresses.json: %w", err)
+		}
+	} else {
+		// Clear the scratch dir so we know any files that appear came from THIS
+		// stop, not a prior run. The blockchain container's trap writes atomically
+		// (.tmp + mv) so a crash mid-write can't confuse us either way.
+		if err := clearDir(scratchDir); err != nil {
+			return fmt.Errorf("clear scratch dir: %w", err)
+		}
+
+		fmt.Printf("Stopping stack (triggers blockchain state dump)...\n")
+		if err := stopStack(ctx, projectDir); err != nil {
+			return err
+		}
+
+		// Wait briefly for the scratch files to land — compose stop returns once
+		// containers have exited, but the trap's `mv` may trail by a few ms.
+		if err := waitForFile(filepath.Join(scratchDir, "anvil-state.json"), 5*time.Second); err != nil {
+			return fmt.Errorf("blockchain did not produce an anvil-state.json on shutdown: %w", err)
+		}
+
+		fmt.Printf("Archiving blockchain state...\n")
+		for _, f := range []string{"anvil-state.json", "deployed-addresses.json"} {
+			src := filepath.Join(scratchDir, f)
+			dst := filepath.Join(bcStaging, f)
+			if err := copyFile(src, dst); err != nil {
+				return fmt.Errorf("copy %s: %w", f, err)
+			}
 		}
 	}
 
@@ -176,12 +241,17 @@ func Save(ctx context.Context, opts SaveOpts) error {
 		return err
 	}
 	proj := projectName(projectDir)
+	chunkStore := ""
+	if opts.Chunked {
+		chunkStore = filepath.Join(snapsRoot, ChunkStoreDir)
+	}
 	for _, v := range vols {
 		fmt.Printf("  %s\n", v)
-		if err := archiveVolume(ctx, proj, v, volsDst); err != nil {
+		if err := archiveVolume(ctx, proj, v, volsDst, chunkStore); err != nil {
 			return err
 		}
 	}
+	resume()
 
 	fmt.Printf("Copying %s (provenance)...\n", filepath.Base(manifestPath))
 	if err := copyFile(
@@ -191,7 +261,8 @@ func Save(ctx context.Context, opts SaveOpts) error {
 		return err
 	}
 
-	if err := writeDescriptor(stagingDir, &Descriptor{
+	fmt.Printf("Computing digests...\n")
+	if err := commitSnapshot(stagingDir, finalDir, &Descriptor{
 		Name:      opts.Name,
 		CreatedAt: time.Now().UTC(),
 		Volumes:   vols,
@@ -201,22 +272,14 @@ func Save(ctx context.Context, opts SaveOpts) error {
 	}); err != nil {
 		return err
 	}
-
-	// Atomic commit: rename staging → final. On an overwrite we remove the
-	// old final AFTER staging is complete, so a partial failure leaves the
-	// previous snapshot intact.
-	if opts.Force {
-		if err := os.RemoveAll(finalDir); err != nil {
-			return fmt.Errorf("remove old snapshot: %w", err)
-		}
-	}
-	if err := os.Rename(stagingDir, finalDir); err != nil {
-		return fmt.Errorf("commit snapshot: %w", err)
-	}
 	success = true
 
 	fmt.Printf("\nSaved snapshot %q → %s\n", opts.Name, finalDir)
-	fmt.Printf("Stack is stopped. Run `make up` to restart.\n")
+	if opts.Live {
+		fmt.Printf("Stack is still running.\n")
+	} else {
+		fmt.Printf("Stack is stopped. Run `make up` to restart.\n")
+	}
 	return nil
 }
 
@@ -227,6 +290,10 @@ type LoadOpts struct {
 	// generated/snapshots/<name>/) or a path (absolute, or containing "/")
 	// pointing directly at a snapshot directory.
 	NameOrPath string
+	// ImagePolicy handles images that differ from the snapshot's:
+	// warn (default), fail before any volume is restored, or pin the
+	// snapshot's recorded images for the session.
+	ImagePolicy ImagePolicy
 }
 
 // LoadFilesPaths targets the filesystem-restore portion of a snapshot.
@@ -253,6 +320,7 @@ type LoadFilesPaths struct {
 // restore docker volumes separately (via RestoreVolume). Does not touch
 // any docker resources, does not regenerate compose files, does not
 // manage the running stack — those concerns belong to the caller.
+// Nor does it check integrity; call VerifyDir first.
 func LoadFiles(ctx context.Context, snapshotDir string, dst LoadFilesPaths) (*Descriptor, error) {
 	desc, err := readDescriptor(snapshotDir)
 	if err != nil {
@@ -330,11 +398,22 @@ func Load(ctx context.Context, opts LoadOpts) error {
 		return fmt.Errorf("resolve project dir: %w", err)
 	}
 
+	policy, err := ParseImagePolicy(string(opts.ImagePolicy))
+	if err != nil {
+		return err
+	}
 	snapDir, err := resolveSnapshotDir(projectDir, opts.NameOrPath)
 	if err != nil {
 		return err
 	}
 
+	// Verify before anything else: a corrupt snapshot should fail here,
+	// not after minutes of volume restores and a stack that won't boot.
+	fmt.Printf("Verifying snapshot integrity...\n")
+	if _, err := VerifyDir(snapDir); err != nil {
+		return err
+	}
+
 	// Check for running containers BEFORE touching anything — we need to
 	// confirm the stack is down against whatever topology is currently
 	// resolved, not the topology we're about to install.
@@ -343,17 +422,62 @@ func Load(ctx context.Context, opts LoadOpts) error {
 		return err
 	}
 
+	desc, err := readDescriptor(snapDir)
+	if err != nil {
+		return err
+	}
+
+	// Compare images between what the snapshot was taken against and
+	// what the current compose config would run once it's loaded. Covers
+	// two distinct cases:
+	//   - Tag drift: teammate's .env has different image references.
+	//   - Digest drift at same tag: rolling tags like :main were re-pulled
+	//     between save and load, so the bytes differ even though the
+	//     reference looks identical.
+	// This runs before anything is restored, against the snapshot's
+	// topology, so --image-policy fail leaves the work tree untouched.
+	var pins map[string]string
+	var unpinned []string
+	if policy == ImagePolicyPin {
+		pins, unpinned = PinnedImageEnv(desc.Images)
+	}
+	var drift []string
+	if len(desc.Images) > 0 {
+		currentImages, err := snapshotImages(ctx, projectDir, snapDir, pins)
+		if err != nil {
+			if policy == ImagePolicyFail {
+				return fmt.Errorf("resolve current images for drift check: %w", err)
+			}
+			// Non-fatal — if compose config can't resolve now, make up
+			// will fail loudly anyway.
+			fmt.Fprintf(os.Stderr, "warning: could not resolve current images for drift check: %v\n", err)
+		} else {
+			checkAgainst := desc.Images
+			if policy == ImagePolicyPin {
+				// Pinned services run the saved bytes by construction;
+				// only the ones env can't reach are worth a warning.
+				checkAgainst = make(map[string]ImageInfo, len(unpinned))
+				for _, svc := range unpinned {
+					checkAgainst[svc] = desc.Images[svc]
+				}
+			}
+			drift, err = CheckImages(policy, checkAgainst, currentImages)
+			if err != nil {
+				return fmt.Errorf("%w\n  Nothing was loaded; load with --image-policy warn|pin to use it anyway", err)
+			}
+		}
+	}
+
 	// Restore the filesystem portion of the snapshot: session manifest,
 	// blockchain state files, keys, proofs. This matches what the compose
 	// layer expects via its bind-mounts.
 	fmt.Printf("Restoring files (session manifest, blockchain state, keys, proofs)...\n")
-	desc, err := LoadFiles(ctx, snapDir, LoadFilesPaths{
+	if _, err := LoadFiles(ctx, snapDir, LoadFilesPaths{
 		KeysDir:             filepath.Join(projectDir, projKeysDir),
 		ProofsDir:           filepath.Join(projectDir, projProofsDir),
 		ScratchDir:          filepath.Join(projectDir, projScratchDir),
 		SessionManifestPath: filepath.Join(projectDir, manifest.SessionManifestPath),
-	})
-	if err != nil {
+	}); err != nil {
 		return err
 	}
 
@@ -375,28 +499,24 @@ func Load(ctx context.Context, opts LoadOpts) error {
 		return err
 	}
 
-	// Warn if images differ between what the snapshot was taken against and
-	// what the current compose config would pull. Covers two distinct cases:
-	//   - Tag drift: teammate's .env has different image references.
-	//   - Digest drift at same tag: rolling tags like :main were re-pulled
-	//     between save and load, so the bytes differ even though the
-	//     reference looks identical.
-	if len(desc.Images) > 0 {
-		currentImages, err := captureImages(ctx, projectDir)
-		if err != nil {
-			// Non-fatal — snapshot contents already landed; if compose config
-			// can't resolve now, make up will fail loudly anyway.
-			fmt.Fprintf(os.Stderr, "warning: could not resolve current images for drift check: %v\n", err)
-		} else if drift := diffImages(desc.Images, currentImages); len(drift) > 0 {
-			fmt.Fprintln(os.Stderr, "")
-			fmt.Fprintln(os.Stderr, "WARNING: images differ from snapshot:")
-			for _, line := range drift {
-				fmt.Fprintf(os.Stderr, "  %s\n", line)
-			}
-			fmt.Fprintln(os.Stderr, "  The snapshot's state was produced by the 'saved' images;")
-			fmt.Fprintln(os.Stderr, "  behavior may differ if the 'current' images don't match.")
-			fmt.Fprintln(os.Stderr, "")
+	// Pinning replaces (or, for other policies, clears) the session's
+	// pinned images, so `make up` runs what the drift check assumed.
+	if err := writePinnedEnv(projectDir, pins); err != nil {
+		return err
+	}
+	if len(pins) > 0 {
+		fmt.Printf("Pinned %d image variable(s) to the snapshot's digests (%s)\n",
+			len(pins), filepath.Join(projScratchDir, "images.env"))
+	}
+	if len(drift) > 0 {
+		fmt.Fprintln(os.Stderr, "")
+		fmt.Fprintln(os.Stderr, "WARNING: images differ from snapshot:")
+		for _, line := range drift {
+			fmt.Fprintf(os.Stderr, "  %s\n", line)
 		}
+		fmt.Fprintln(os.Stderr, "  The snapshot's state was produced by the 'saved' images;")
+		fmt.Fprintln(os.Stderr, "  behavior may differ if the 'current' images don't match.")
+		fmt.Fprintln(os.Stderr, "")
 	}
 
 	fmt.Printf("Restoring %d volume(s)...\n", len(desc.Volumes))
@@ -420,6 +540,7 @@ type Info struct {
 	CreatedAt time.Time
 	Volumes   []string
 	SizeBytes int64
+	Pinned    bool
 }
 
 // List returns all snapshots under the project.
@@ -448,10 +569,14 @@ func List(projectDir string) ([]Info, error) {
 		}
 		size, _ := dirSize(dir)
 		out = append(out, Info{
-			Name:      desc.Name,
+			// The directory name, not desc.Name: it's what load, rm and
+			// prune resolve, and the two differ once a snapshot is copied
+			// in under another name.
+			Name:      e.Name(),
 			CreatedAt: desc.CreatedAt,
 			Volumes:   desc.Volumes,
 			SizeBytes: size,
+			Pinned:    desc.Pinned,
 		})
 	}
 
@@ -461,7 +586,8 @@ func List(projectDir string) ([]Info, error) {
 	return out, nil
 }
 
-// Remove deletes the named snapshot directory.
+// Remove deletes the named snapshot directory, then drops any chunks in
+// the shared store that no remaining snapshot references.
 func Remove(projectDir, name string) error {
 	if err := validateName(name); err != nil {
 		return err
@@ -473,7 +599,13 @@ func Remove(projectDir, name string) error {
 		}
 		return err
 	}
-	return os.RemoveAll(dir)
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	if err := gcChunks(filepath.Join(projectDir, projSnapshotsDir)); err != nil {
+		return fmt.Errorf("collect unreferenced chunks: %w", err)
+	}
+	return nil
 }
 
 // validateName rejects path-traversal and empty names.
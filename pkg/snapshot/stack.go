@@ -6,10 +6,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"sort"
 	"strings"
+
+	"github.com/moby/moby/client"
+	"github.com/storacha/smelt/internal/dockerapi"
 )
 
 // projectName resolves the docker-compose project name used to namespace
@@ -36,13 +38,12 @@ type composeService struct {
 // stackStatus returns the list of compose-managed services for the project.
 // Empty slice + nil error means the stack is fully down.
 func stackStatus(ctx context.Context, projectDir string) ([]composeService, error) {
-	cmd := exec.CommandContext(ctx, "docker", "compose", "ps", "--all", "--format", "json")
-	cmd.Dir = projectDir
+	cmd := dockerapi.Compose(ctx, projectDir, "ps", "--all", "--format", "json")
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
 	if err := cmd.Run(); err != nil {
-		return nil, fmt.Errorf("docker compose ps: %w (%s)", err, stderr.String())
+		return nil, fmt.Errorf("compose ps: %w (%s)", err, stderr.String())
 	}
 
 	// `docker compose ps --format json` emits NDJSON (one object per line)
@@ -109,27 +110,26 @@ func requireStackUp(ctx context.Context, projectDir string) error {
 
 // requireStackDown fails if any container for this project is still running.
 // Restoring volumes while a container holds an open handle corrupts things.
-// Uses `docker ps` with a project label filter instead of `docker compose ps`,
+// Lists containers by project label instead of running `docker compose ps`,
 // because the latter needs valid compose files — and we may be running right
 // after `make nuke` removed them, or about to overwrite smelt.yml with a
 // different topology.
 func requireStackDown(ctx context.Context, projectDir string) error {
 	proj := projectName(projectDir)
-	cmd := exec.CommandContext(ctx, "docker", "ps",
-		"--filter", fmt.Sprintf("label=com.docker.compose.project=%s", proj),
-		"--format", "{{.Names}}",
-	)
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("docker ps: %w (%s)", err, stderr.String())
+	cli, err := dockerapi.Client(ctx)
+	if err != nil {
+		return err
+	}
+	list, err := cli.ContainerList(ctx, client.ContainerListOptions{
+		Filters: make(client.Filters).Add("label", "com.docker.compose.project="+proj),
+	})
+	if err != nil {
+		return fmt.Errorf("list containers: %w", err)
 	}
-	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
 	var running []string
-	for _, l := range lines {
-		if l != "" {
-			running = append(running, l)
+	for _, c := range list.Items {
+		if len(c.Names) > 0 {
+			running = append(running, strings.TrimPrefix(c.Names[0], "/"))
 		}
 	}
 	if len(running) > 0 {
@@ -143,55 +143,59 @@ func requireStackDown(ctx context.Context, projectDir string) error {
 // in dependency order. The blockchain container's entrypoint trap turns that
 // signal into a `/output/anvil-state.json` dump.
 func stopStack(ctx context.Context, projectDir string) error {
-	cmd := exec.CommandContext(ctx, "docker", "compose", "stop")
-	cmd.Dir = projectDir
+	cmd := dockerapi.Compose(ctx, projectDir, "stop")
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("docker compose stop: %w", err)
+		return fmt.Errorf("compose stop: %w", err)
 	}
 	return nil
 }
 
+// composeConfig is the subset of `docker compose config --format json`
+// the snapshot code reads: per-service images and volume mounts.
+type composeConfig struct {
+	Services map[string]struct {
+		Image   string `json:"image"`
+		Volumes []struct {
+			Type   string `json:"type"`
+			Source string `json:"source"`
+		} `json:"volumes"`
+	} `json:"services"`
+}
+
+// readComposeConfig resolves the project's compose config, including any
+// images pinned by the active snapshot session. Services gated behind an
+// inactive profile are omitted by compose itself.
+func readComposeConfig(ctx context.Context, projectDir string) (*composeConfig, error) {
+	args := append(composeEnvFileArgs(projectDir), "config", "--format", "json")
+	return runComposeConfig(dockerapi.Compose(ctx, projectDir, args...))
+}
+
 // captureImages resolves the compose config and returns per-service image
 // info — both the tag (resolved reference) and the digest (immutable
 // content identifier). The digest closes the "same tag, different bytes"
 // gap that tag-only capture leaves open: a rolling tag like `:main` resolves
 // to different image content depending on when the user last pulled.
 func captureImages(ctx context.Context, projectDir string) (map[string]ImageInfo, error) {
-	cmd := exec.CommandContext(ctx, "docker", "compose", "config", "--format", "json")
-	cmd.Dir = projectDir
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-	if err := cmd.Run(); err != nil {
-		return nil, fmt.Errorf("docker compose config: %w (%s)", err, stderr.String())
-	}
-
-	// Shape: { "services": { "<name>": { "image": "...", ... }, ... }, ... }
-	var doc struct {
-		Services map[string]struct {
-			Image string `json:"image"`
-		} `json:"services"`
-	}
-	if err := json.Unmarshal(stdout.Bytes(), &doc); err != nil {
-		return nil, fmt.Errorf("parse compose config: %w", err)
+	doc, err := readComposeConfig(ctx, projectDir)
+	if err != nil {
+		return nil, err
 	}
+	return imagesFromConfig(ctx, doc), nil
+}
 
+func imagesFromConfig(ctx context.Context, doc *composeConfig) map[string]ImageInfo {
 	out := make(map[string]ImageInfo, len(doc.Services))
 	for name, svc := range doc.Services {
 		if svc.Image == "" {
 			continue
 		}
-		info := ImageInfo{Tag: svc.Image}
 		// Best-effort digest lookup. If the image isn't pulled locally
 		// (unlikely while the stack is healthy) we record the tag only.
-		if digest, err := inspectImageDigest(ctx, svc.Image); err == nil {
-			info.Digest = digest
-		}
-		out[name] = info
+		out[name] = ImageInfoFor(ctx, svc.Image)
 	}
-	return out, nil
+	return out
 }
 
 // inspectImageDigest returns the canonical immutable identifier for a local
@@ -199,15 +203,18 @@ func captureImages(ctx context.Context, projectDir string) (map[string]ImageInfo
 // ("repo@sha256:…"); for locally-built images that have no RepoDigest, the
 // docker image Id ("sha256:…").
 func inspectImageDigest(ctx context.Context, ref string) (string, error) {
-	cmd := exec.CommandContext(ctx, "docker", "image", "inspect", ref,
-		"--format", "{{if .RepoDigests}}{{index .RepoDigests 0}}{{else}}{{.Id}}{{end}}")
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-	if err := cmd.Run(); err != nil {
-		return "", fmt.Errorf("inspect %s: %w (%s)", ref, err, stderr.String())
+	cli, err := dockerapi.Client(ctx)
+	if err != nil {
+		return "", err
+	}
+	img, err := cli.ImageInspect(ctx, ref)
+	if err != nil {
+		return "", fmt.Errorf("inspect %s: %w", ref, err)
+	}
+	if len(img.RepoDigests) > 0 {
+		return img.RepoDigests[0], nil
 	}
-	return strings.TrimSpace(stdout.String()), nil
+	return img.ID, nil
 }
 
 // diffImages returns a sorted slice of human-readable drift descriptions.
@@ -270,12 +277,11 @@ func shortDigest(d string) string {
 // stopped containers still holding mounts. Volumes survive compose down
 // without -v; our volume restore then wipes and repopulates them.
 func removeStoppedContainers(ctx context.Context, projectDir string) error {
-	cmd := exec.CommandContext(ctx, "docker", "compose", "down", "--remove-orphans")
-	cmd.Dir = projectDir
+	cmd := dockerapi.Compose(ctx, projectDir, "down", "--remove-orphans")
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("docker compose down: %w", err)
+		return fmt.Errorf("compose down: %w", err)
 	}
 	return nil
 }
@@ -0,0 +1,208 @@
+package snapshot
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// digestPrefix tags every entry in Descriptor.Digests with its algorithm,
+// matching the "sha256:…" form docker uses for image digests.
+const digestPrefix = "sha256:"
+
+// IntegrityError lists every problem Verify found in a snapshot. Reporting
+// all of them at once (rather than stopping at the first) lets the user
+// tell a single truncated tar apart from a wholesale bad copy.
+type IntegrityError struct {
+	Dir      string
+	Problems []string
+}
+
+func (e *IntegrityError) Error() string {
+	return fmt.Sprintf("snapshot %s failed integrity check:\n  %s",
+		e.Dir, strings.Join(e.Problems, "\n  "))
+}
+
+// Verify resolves a snapshot by name or path (same rules as Load) and
+// checks it with VerifyDir.
+func Verify(projectDir, nameOrPath string) (*Descriptor, error) {
+	projectDir, err := filepath.Abs(projectDir)
+	if err != nil {
+		return nil, fmt.Errorf("resolve project dir: %w", err)
+	}
+	snapDir, err := resolveSnapshotDir(projectDir, nameOrPath)
+	if err != nil {
+		return nil, err
+	}
+	return VerifyDir(snapDir)
+}
+
+// VerifyDir checks a snapshot directory against its descriptor before
+// anything is restored from it. Every file the descriptor references
+// (blockchain state, smelt.yml, keys, proofs) must be present; when the
+// descriptor carries digests, each recorded file must also hash to its
+// saved value. Snapshots saved before digests existed get a structural
+// check instead: every volume tar must read cleanly to its end, which
+// catches truncated copies. Chunked volumes additionally have every
+// referenced chunk checked in the shared store.
+//
+// Returns the parsed descriptor on success, and an *IntegrityError
+// listing every problem found otherwise.
+func VerifyDir(snapshotDir string) (*Descriptor, error) {
+	desc, err := readDescriptor(snapshotDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var problems []string
+	required := make(map[string]bool)
+	for _, rel := range requiredFiles(desc) {
+		required[rel] = true
+		if _, err := os.Stat(filepath.Join(snapshotDir, filepath.FromSlash(rel))); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: missing", rel))
+		}
+	}
+
+	if len(desc.Digests) > 0 {
+		rels := make([]string, 0, len(desc.Digests))
+		for rel := range desc.Digests {
+			rels = append(rels, rel)
+		}
+		sort.Strings(rels)
+		for _, rel := range rels {
+			want := desc.Digests[rel]
+			got, err := fileDigest(filepath.Join(snapshotDir, filepath.FromSlash(rel)))
+			switch {
+			case errors.Is(err, fs.ErrNotExist):
+				// Required files were already reported above.
+				if required[rel] {
+					continue
+				}
+				problems = append(problems, fmt.Sprintf("%s: missing", rel))
+			case err != nil:
+				problems = append(problems, fmt.Sprintf("%s: %v", rel, err))
+			case got != want:
+				problems = append(problems, fmt.Sprintf("%s: digest mismatch (saved %s, found %s)",
+					rel, shortDigest(want), shortDigest(got)))
+			}
+		}
+	} else {
+		for _, v := range desc.Volumes {
+			if err := checkTar(snapshotDir, v); err != nil {
+				if errors.Is(err, fs.ErrNotExist) {
+					// Legacy saves skipped volumes that didn't exist;
+					// RestoreVolume tolerates the gap the same way.
+					continue
+				}
+				problems = append(problems, fmt.Sprintf("%s/%s: %v", subdirVolumes, v, err))
+			}
+		}
+	}
+
+	// Chunks live in the shared store, outside the digest set; check
+	// them regardless of snapshot age.
+	for _, v := range desc.Volumes {
+		problems = append(problems, verifyChunks(snapshotDir, v)...)
+	}
+
+	if len(problems) > 0 {
+		return nil, &IntegrityError{Dir: snapshotDir, Problems: problems}
+	}
+	return desc, nil
+}
+
+// requiredFiles returns the slash-separated paths every snapshot must
+// contain regardless of whether it carries digests.
+func requiredFiles(desc *Descriptor) []string {
+	files := []string{
+		path.Join(subdirBlockchain, "anvil-state.json"),
+		path.Join(subdirBlockchain, "deployed-addresses.json"),
+		manifestCopy,
+	}
+	for _, k := range desc.Keys {
+		files = append(files, path.Join(subdirKeys, filepath.ToSlash(k)))
+	}
+	for _, p := range desc.Proofs {
+		files = append(files, path.Join(subdirProofs, filepath.ToSlash(p)))
+	}
+	return files
+}
+
+// computeDigests hashes every regular file under dir except the
+// descriptor, keyed by slash-separated relative path.
+func computeDigests(dir string) (map[string]string, error) {
+	out := make(map[string]string)
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == DescriptorFile {
+			return nil
+		}
+		sum, err := fileDigest(p)
+		if err != nil {
+			return err
+		}
+		out[rel] = sum
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("compute digests: %w", err)
+	}
+	return out, nil
+}
+
+// fileDigest returns the "sha256:<hex>" digest of a file's contents.
+func fileDigest(p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return digestPrefix + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// checkTar reads a volume's archive end to end without extracting it,
+// decompressing as needed. A truncated archive surfaces as
+// io.ErrUnexpectedEOF from the reader.
+func checkTar(snapshotDir, volName string) error {
+	r, err := openVolumeArchive(filepath.Join(snapshotDir, subdirVolumes), volName)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	tr := tar.NewReader(r)
+	for {
+		_, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("unreadable tar: %w", err)
+		}
+		if _, err := io.Copy(io.Discard, tr); err != nil {
+			return fmt.Errorf("unreadable tar: %w", err)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package snapshot
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeTestSnapshot lays out a minimal snapshot directory with one key,
+// one proof and one volume archive. When withDigests is set the
+// descriptor records digests the way Save does.
+func writeTestSnapshot(t *testing.T, withDigests bool) string {
+	t.Helper()
+	dir := t.TempDir()
+
+	files := map[string][]byte{
+		"blockchain/anvil-state.json":        []byte(`{"block":1}`),
+		"blockchain/deployed-addresses.json": []byte(`{}`),
+		"smelt.yml":                          []byte("piri:\n  count: 1\n"),
+		"keys/piri-0.pem":                    []byte("key"),
+		"proofs/piri-0-proof.txt":            []byte("proof"),
+		"volumes/piri-0-data.tar":            testTar(t),
+	}
+	for rel, data := range files {
+		p := filepath.Join(dir, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	desc := &Descriptor{
+		Name:    "test",
+		Volumes: []string{"piri-0-data"},
+		Keys:    []string{"piri-0.pem"},
+		Proofs:  []string{"piri-0-proof.txt"},
+	}
+	if withDigests {
+		digests, err := computeDigests(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		desc.Digests = digests
+	}
+	if err := writeDescriptor(dir, desc); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func testTar(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	data := bytes.Repeat([]byte("x"), 4096)
+	if err := tw.WriteHeader(&tar.Header{Name: "./db.sqlite", Mode: 0644, Size: int64(len(data))}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func requireProblem(t *testing.T, err error, want string) {
+	t.Helper()
+	var ie *IntegrityError
+	if !errors.As(err, &ie) {
+		t.Fatalf("expected *IntegrityError, got %v", err)
+	}
+	for _, p := range ie.Problems {
+		if strings.Contains(p, want) {
+			return
+		}
+	}
+	t.Fatalf("expected a problem containing %q, got %v", want, ie.Problems)
+}
+
+func TestVerifyDir(t *testing.T) {
+	t.Run("intact", func(t *testing.T) {
+		dir := writeTestSnapshot(t, true)
+		desc, err := VerifyDir(dir)
+		if err != nil {
+			t.Fatalf("VerifyDir: %v", err)
+		}
+		if len(desc.Digests) != 6 {
+			t.Errorf("expected 6 digests, got %d", len(desc.Digests))
+		}
+	})
+
+	t.Run("edited anvil state", func(t *testing.T) {
+		dir := writeTestSnapshot(t, true)
+		p := filepath.Join(dir, "blockchain", "anvil-state.json")
+		if err := os.WriteFile(p, []byte(`{"block":2}`), 0644); err != nil {
+			t.Fatal(err)
+		}
+		_, err := VerifyDir(dir)
+		requireProblem(t, err, "blockchain/anvil-state.json: digest mismatch")
+	})
+
+	t.Run("missing key", func(t *testing.T) {
+		dir := writeTestSnapshot(t, true)
+		if err := os.Remove(filepath.Join(dir, "keys", "piri-0.pem")); err != nil {
+			t.Fatal(err)
+		}
+		_, err := VerifyDir(dir)
+		requireProblem(t, err, "keys/piri-0.pem: missing")
+	})
+
+	t.Run("missing volume", func(t *testing.T) {
+		dir := writeTestSnapshot(t, true)
+		if err := os.Remove(filepath.Join(dir, "volumes", "piri-0-data.tar")); err != nil {
+			t.Fatal(err)
+		}
+		_, err := VerifyDir(dir)
+		requireProblem(t, err, "volumes/piri-0-data.tar: missing")
+	})
+
+	t.Run("truncated tar without digests", func(t *testing.T) {
+		dir := writeTestSnapshot(t, false)
+		p := filepath.Join(dir, "volumes", "piri-0-data.tar")
+		if err := os.Truncate(p, 1024); err != nil {
+			t.Fatal(err)
+		}
+		_, err := VerifyDir(dir)
+		requireProblem(t, err, "volumes/piri-0-data: unreadable tar")
+	})
+}
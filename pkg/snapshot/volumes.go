@@ -2,69 +2,68 @@ package snapshot
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"sort"
 
+	"github.com/moby/moby/api/types/mount"
+	"github.com/moby/moby/client"
+	"github.com/storacha/smelt/internal/dockerapi"
 	"github.com/storacha/smelt/pkg/manifest"
 )
 
-// busyboxImage is the helper used to tar/untar through docker volumes.
-// It's tiny and ubiquitous — any host running smelt already has it pulled
-// (or gets it in seconds on first use).
-const busyboxImage = "busybox:latest"
-
-// resolveVolumes returns the compose-declared volume names (without project
-// prefix) that this manifest produces. Only volumes actually created by the
-// resolved topology are returned — e.g. piri-postgres-data only appears when
-// at least one node is configured with the postgres backend.
-func resolveVolumes(m *manifest.Manifest) ([]string, error) {
-	nodes, err := m.Resolve()
+// resolveVolumes returns the compose volume names (without project
+// prefix) a snapshot of this project captures: every named volume
+// mounted by a service in the resolved compose config, narrowed by the
+// manifest's snapshot include/exclude rules. Deriving the set from
+// compose rather than a fixed list keeps snapshots complete as systems
+// add volumes — and only volumes the resolved topology actually uses
+// (e.g. piri-postgres-data only with a postgres node) are returned.
+func resolveVolumes(ctx context.Context, projectDir string, m *manifest.Manifest) ([]string, error) {
+	doc, err := readComposeConfig(ctx, projectDir)
 	if err != nil {
-		return nil, fmt.Errorf("resolve manifest: %w", err)
-	}
-
-	// Always-present volumes declared by non-piri systems. Keeping the full
-	// set (including guppy client state) matches the "snapshot is the whole
-	// stack delta" framing — a user who logged in and created spaces before
-	// saving will find them after load.
-	vols := []string{
-		"minio-data",    // systems/common — upload's S3 backend
-		"ipni-data",     // systems/indexing/ipni — content discovery
-		"dynamodb-data", // systems/common — delegator allow list, upload registry
-		"guppy-data",    // systems/guppy — client's login/space state
-	}
-
-	// Per-piri data volumes.
-	hasPostgres := false
-	hasS3 := false
-	for _, n := range nodes {
-		vols = append(vols, fmt.Sprintf("%s-data", n.Name))
-		if n.Storage.DB == manifest.DBPostgres {
-			hasPostgres = true
-		}
-		if n.Storage.Blob == manifest.BlobS3 {
-			hasS3 = true
-		}
-	}
-	if hasPostgres {
-		vols = append(vols, "piri-postgres-data")
-	}
-	if hasS3 {
-		vols = append(vols, "piri-minio-data")
+		return nil, err
 	}
+	return selectVolumes(doc, m.Snapshot)
+}
 
+// selectVolumes is resolveVolumes minus the docker call.
+func selectVolumes(doc *composeConfig, spec manifest.SnapshotSpec) ([]string, error) {
+	seen := make(map[string]bool)
+	var vols []string
+	for _, svc := range doc.Services {
+		for _, v := range svc.Volumes {
+			if v.Type != "volume" || v.Source == "" || seen[v.Source] {
+				continue
+			}
+			seen[v.Source] = true
+			ok, err := spec.Selects(v.Source)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				vols = append(vols, v.Source)
+			}
+		}
+	}
+	sort.Strings(vols)
 	return vols, nil
 }
 
-// archiveVolume tars the contents of a docker-named volume into outputDir
-// as `<volname>.tar`. The tar is rooted at the volume contents (`.`) so
-// restore can extract directly into a fresh volume mount.
+// archiveVolume tars the contents of a docker-named volume into outputDir.
+// The tar is rooted at the volume contents (`.`) so restore can extract
+// directly into a fresh volume mount. A busybox helper container streams
+// the tar over the Engine API and smelt compresses it on the host: into
+// `<volname>.tar.zst`, or — when chunkStore is set — into
+// `<volname>.chunks.json` plus any new chunks in the shared store.
 //
-// Runs busybox as root so postgres/minio data (root-owned inside the volume)
-// is readable.
-func archiveVolume(ctx context.Context, projectName, volName, outputDir string) error {
+// The helper runs as root so postgres/minio data (root-owned inside the
+// volume) is readable.
+func archiveVolume(ctx context.Context, projectName, volName, outputDir, chunkStore string) error {
 	fullVol := fmt.Sprintf("%s_%s", projectName, volName)
 
 	outputDirAbs, err := filepath.Abs(outputDir)
@@ -75,39 +74,60 @@ func archiveVolume(ctx context.Context, projectName, volName, outputDir string)
 		return fmt.Errorf("create output dir: %w", err)
 	}
 
-	cmd := exec.CommandContext(ctx, "docker", "run", "--rm",
-		"-u", "0:0",
-		"-v", fmt.Sprintf("%s:/src:ro", fullVol),
-		"-v", fmt.Sprintf("%s:/dst", outputDirAbs),
-		busyboxImage,
-		"tar", "-C", "/src", "-cf", fmt.Sprintf("/dst/%s.tar", volName), ".",
-	)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	if err := cmd.Run(); err != nil {
-		// Volume-not-found is non-fatal — the manifest may list volumes that
-		// this particular session never created (e.g. piri-postgres-data when
-		// the stack was brought up with only sqlite nodes during dev, then
-		// the manifest was edited). Surface the error for other causes.
-		if !volumeExists(ctx, fullVol) {
-			fmt.Fprintf(os.Stderr, "  skip: volume %q does not exist\n", fullVol)
-			return nil
-		}
+	// Volume-not-found is non-fatal — the manifest may list volumes that
+	// this particular session never created (e.g. piri-postgres-data when
+	// the stack was brought up with only sqlite nodes during dev, then
+	// the manifest was edited). Checked up front because once the tar
+	// stream is piped into the compressor, a missing volume would look
+	// like an empty archive.
+	exists, err := dockerapi.VolumeExists(ctx, fullVol)
+	if err != nil {
+		return fmt.Errorf("archive %s: %w", fullVol, err)
+	}
+	if !exists {
+		fmt.Fprintf(os.Stderr, "  skip: volume %q does not exist\n", fullVol)
+		return nil
+	}
+
+	pr, pw := io.Pipe()
+	helperErr := make(chan error, 1)
+	go func() {
+		err := dockerapi.RunHelper(ctx, dockerapi.Helper{
+			Cmd:    []string{"tar", "-C", "/src", "-cf", "-", "."},
+			Mounts: []mount.Mount{volumeMount(fullVol, "/src", true)},
+			Stdout: pw,
+			Stderr: os.Stderr,
+		})
+		pw.CloseWithError(err)
+		helperErr <- err
+	}()
+	writeErr := writeVolumeArchive(pr, outputDirAbs, volName, chunkStore)
+	if writeErr != nil {
+		// Fail the helper's next write so it stops (and its container
+		// is removed) instead of streaming the rest of the volume.
+		pr.CloseWithError(writeErr)
+		<-helperErr
+		return fmt.Errorf("archive %s: %w", fullVol, writeErr)
+	}
+	if err := <-helperErr; err != nil {
 		return fmt.Errorf("archive %s: %w", fullVol, err)
 	}
 	return nil
 }
 
 // RestoreVolume overwrites the contents of a docker-named volume
-// (`<projectName>_<volName>`) from a tar produced by archiveVolume.
-// Always rm-then-create the volume so it carries the compose labels —
-// otherwise `make up` warns "already exists but was not created by
-// Docker Compose" on every restore. Docker doesn't let us add labels to
-// an existing volume; only set them at create.
+// (`<projectName>_<volName>`) from an archive produced by archiveVolume.
+// Plain `.tar`, zstd `.tar.zst` and chunked archives are all accepted;
+// smelt decompresses on the host and streams the tar into a busybox
+// helper. Always rm-then-create the volume so it carries the compose
+// labels — otherwise `make up` warns "already exists but was not created
+// by Docker Compose" on every restore. Docker doesn't let us add labels
+// to an existing volume; only set them at create.
 //
 // Exported for use by pkg/stack, which pre-populates per-test volumes
 // before the testcontainers-go compose.Up(). The compose layer's Load
-// also uses it for the make-up path.
+// also uses it for the make-up path. Talks to the Engine API, so it
+// needs a reachable docker socket but not the docker CLI.
 func RestoreVolume(ctx context.Context, projectName, volName, inputDir string) error {
 	fullVol := fmt.Sprintf("%s_%s", projectName, volName)
 
@@ -115,58 +135,94 @@ func RestoreVolume(ctx context.Context, projectName, volName, inputDir string) e
 	if err != nil {
 		return fmt.Errorf("resolve input dir: %w", err)
 	}
-	tarName := fmt.Sprintf("%s.tar", volName)
-	tarPath := filepath.Join(inputDirAbs, tarName)
-	if _, err := os.Stat(tarPath); err != nil {
+	archive, err := openVolumeArchive(inputDirAbs, volName)
+	if err != nil {
 		// The snapshot didn't include this volume (e.g. saved with sqlite-only
 		// topology, loading into a postgres topology). Skip rather than fail;
 		// the first `make up` will populate an empty volume fresh.
-		if os.IsNotExist(err) {
+		if errors.Is(err, fs.ErrNotExist) {
 			fmt.Fprintf(os.Stderr, "  skip: no archive for %q in snapshot\n", volName)
 			return nil
 		}
-		return fmt.Errorf("stat tar %s: %w", tarPath, err)
+		return fmt.Errorf("open archive for %s: %w", volName, err)
 	}
+	defer archive.Close()
 
-	if volumeExists(ctx, fullVol) {
-		rm := exec.CommandContext(ctx, "docker", "volume", "rm", fullVol)
-		rm.Stderr = os.Stderr
-		if err := rm.Run(); err != nil {
+	cli, err := dockerapi.Client(ctx)
+	if err != nil {
+		return err
+	}
+	exists, err := dockerapi.VolumeExists(ctx, fullVol)
+	if err != nil {
+		return fmt.Errorf("inspect volume %s: %w", fullVol, err)
+	}
+	if exists {
+		if _, err := cli.VolumeRemove(ctx, fullVol, client.VolumeRemoveOptions{}); err != nil {
 			return fmt.Errorf("remove existing volume %s: %w", fullVol, err)
 		}
 	}
-
-	create := exec.CommandContext(ctx, "docker", "volume", "create",
-		"--label", fmt.Sprintf("com.docker.compose.project=%s", projectName),
-		"--label", fmt.Sprintf("com.docker.compose.volume=%s", volName),
-		fullVol,
-	)
-	create.Stderr = os.Stderr
-	if err := create.Run(); err != nil {
+	if _, err := cli.VolumeCreate(ctx, client.VolumeCreateOptions{
+		Name: fullVol,
+		Labels: map[string]string{
+			"com.docker.compose.project": projectName,
+			"com.docker.compose.volume":  volName,
+		},
+	}); err != nil {
 		return fmt.Errorf("create volume %s: %w", fullVol, err)
 	}
 
 	// Freshly-created volume is empty — just extract. No more `find -delete`
 	// dance needed.
-	cmd := exec.CommandContext(ctx, "docker", "run", "--rm",
-		"-u", "0:0",
-		"-v", fmt.Sprintf("%s:/dst", fullVol),
-		"-v", fmt.Sprintf("%s:/src:ro", inputDirAbs),
-		busyboxImage,
-		"tar", "-C", "/dst", "-xf", fmt.Sprintf("/src/%s", tarName),
-	)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	if err := cmd.Run(); err != nil {
+	return extractVolume(ctx, fullVol, archive, false)
+}
+
+// RestoreVolumeInPlace replaces the contents of an existing docker-named
+// volume with an archive produced by archiveVolume, without removing the
+// volume itself. Use it when the volume is still attached to (stopped)
+// containers — docker refuses `volume rm` then, so RestoreVolume's
+// rm-then-create can't run. Containers mounting the volume must be
+// stopped; extracting under a live process corrupts its files.
+func RestoreVolumeInPlace(ctx context.Context, projectName, volName, inputDir string) error {
+	fullVol := fmt.Sprintf("%s_%s", projectName, volName)
+	inputDirAbs, err := filepath.Abs(inputDir)
+	if err != nil {
+		return fmt.Errorf("resolve input dir: %w", err)
+	}
+	archive, err := openVolumeArchive(inputDirAbs, volName)
+	if err != nil {
+		return fmt.Errorf("open archive for %s: %w", volName, err)
+	}
+	defer archive.Close()
+	return extractVolume(ctx, fullVol, archive, true)
+}
+
+// ArchiveVolume tars a docker-named volume (`<projectName>_<volName>`)
+// into outputDir as `<volName>.tar.zst`, readable by RestoreVolume and
+// RestoreVolumeInPlace. Exported for pkg/stack's in-test checkpoints.
+func ArchiveVolume(ctx context.Context, projectName, volName, outputDir string) error {
+	return archiveVolume(ctx, projectName, volName, outputDir, "")
+}
+
+// extractVolume streams a tar into a busybox helper that extracts it at
+// the volume root, optionally wiping existing contents first.
+func extractVolume(ctx context.Context, fullVol string, archive io.Reader, wipe bool) error {
+	script := "tar -C /dst -xf -"
+	if wipe {
+		script = "find /dst -mindepth 1 -maxdepth 1 -exec rm -rf {} + && " + script
+	}
+	err := dockerapi.RunHelper(ctx, dockerapi.Helper{
+		Cmd:    []string{"sh", "-c", script},
+		Mounts: []mount.Mount{volumeMount(fullVol, "/dst", false)},
+		Stdin:  archive,
+		Stdout: os.Stdout,
+		Stderr: os.Stderr,
+	})
+	if err != nil {
 		return fmt.Errorf("restore %s: %w", fullVol, err)
 	}
 	return nil
 }
 
-// volumeExists reports whether a named docker volume exists.
-func volumeExists(ctx context.Context, fullName string) bool {
-	cmd := exec.CommandContext(ctx, "docker", "volume", "inspect", fullName)
-	cmd.Stdout = nil
-	cmd.Stderr = nil
-	return cmd.Run() == nil
+func volumeMount(name, target string, readOnly bool) mount.Mount {
+	return mount.Mount{Type: mount.TypeVolume, Source: name, Target: target, ReadOnly: readOnly}
 }
@@ -0,0 +1,45 @@
+package snapshot
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/storacha/smelt/pkg/manifest"
+)
+
+func TestSelectVolumes(t *testing.T) {
+	// Trimmed `docker compose config --format json` output: bind mounts
+	// and volumes shared between services must not produce entries.
+	raw := `{"services": {
+		"upload":          {"volumes": [{"type": "bind", "source": "/x/keys"}]},
+		"upload-postgres": {"volumes": [{"type": "volume", "source": "upload-postgres-data"}]},
+		"minio":           {"volumes": [{"type": "volume", "source": "minio-data"}]},
+		"ipni-init":       {"volumes": [{"type": "volume", "source": "ipni-data"}]},
+		"ipni":            {"volumes": [{"type": "volume", "source": "ipni-data"}]},
+		"piri-0":          {"volumes": [{"type": "volume", "source": "piri-0-data"}, {"type": "bind", "source": "/x/piri-0.pem"}]},
+		"grafana":         {"volumes": [{"type": "volume", "source": "grafana-data"}]}
+	}}`
+	var doc composeConfig
+	if err := json.Unmarshal([]byte(raw), &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := selectVolumes(&doc, manifest.SnapshotSpec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"grafana-data", "ipni-data", "minio-data", "piri-0-data", "upload-postgres-data"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("all volumes: got %v, want %v", got, want)
+	}
+
+	got, err = selectVolumes(&doc, manifest.SnapshotSpec{Exclude: []string{"grafana-*"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []string{"ipni-data", "minio-data", "piri-0-data", "upload-postgres-data"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("with exclude: got %v, want %v", got, want)
+	}
+}
@@ -1,14 +1,17 @@
 package stack
 
 import (
+	"context"
 	"fmt"
 	"os"
-	"os/exec"
 	"testing"
 	"time"
+
+	"github.com/storacha/smelt/internal/dockerapi"
 )
 
-// BuildImage builds a Docker image from the repo's Dockerfile.
+// BuildImage builds a container image from the repo's Dockerfile with the
+// detected runtime's CLI (`docker build` or `podman build`).
 // Returns the image tag. The image is automatically cleaned up when the test completes.
 //
 // This enables testing local code changes against the full smelt stack:
@@ -26,7 +29,7 @@ func BuildImage(t *testing.T, repoPath string, imageName string) string {
 
 	t.Logf("Building Docker image %s from %s...", tag, repoPath)
 
-	cmd := exec.Command("docker", "build", "-t", tag, ".")
+	cmd := dockerapi.Command(context.Background(), "build", "-t", tag, ".")
 	cmd.Dir = repoPath
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
@@ -38,7 +41,7 @@ func BuildImage(t *testing.T, repoPath string, imageName string) string {
 	// Cleanup image after test
 	t.Cleanup(func() {
 		t.Logf("Cleaning up Docker image %s", tag)
-		_ = exec.Command("docker", "rmi", tag).Run()
+		_ = dockerapi.Command(context.Background(), "rmi", tag).Run()
 	})
 
 	t.Logf("Successfully built image: %s", tag)
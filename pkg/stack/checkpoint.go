@@ -0,0 +1,325 @@
+package stack
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/moby/moby/client"
+	"github.com/testcontainers/testcontainers-go"
+
+	"github.com/storacha/smelt/internal/dockerapi"
+	"github.com/storacha/smelt/pkg/snapshot"
+)
+
+// checkpoint is the record Stack.Checkpoint leaves behind for Rollback.
+type checkpoint struct {
+	// dir holds one <volume>.tar.zst per archived volume.
+	dir string
+	// volumes lists compose volume names (without project prefix).
+	volumes []string
+	// evmID is the anvil snapshot id to evm_revert to. Reverting consumes
+	// the id, so Rollback replaces it with a fresh one each time.
+	evmID string
+	// seq orders checkpoints so Rollback can drop the ones evm_revert
+	// invalidates (every anvil snapshot taken after the target).
+	seq int
+}
+
+// runningService is a non-blockchain service container and the named
+// volumes it mounts.
+type runningService struct {
+	name      string
+	container *testcontainers.DockerContainer
+	volumes   []string
+	startedAt time.Time
+}
+
+// Checkpoint records the stack's current state under name so a later
+// Rollback can return to it without rebooting the stack. Every service
+// except the blockchain is paused while its volumes are archived, and
+// chain state is captured with anvil's evm_snapshot — so the checkpoint
+// is a single consistent instant across chain and services.
+//
+// Typical use is table-driven tests that share one expensive setup:
+//
+//	s := stack.MustNewStack(t)
+//	// ... login, create space ...
+//	if err := s.Checkpoint(ctx, "ready"); err != nil {
+//	    t.Fatal(err)
+//	}
+//	for _, tc := range cases {
+//	    t.Run(tc.name, func(t *testing.T) {
+//	        if err := s.Rollback(ctx, "ready"); err != nil {
+//	            t.Fatal(err)
+//	        }
+//	        // ... exercise tc from the identical post-setup state ...
+//	    })
+//	}
+//
+// Checkpointing again under an existing name replaces it. Not safe for
+// concurrent use; sub-tests sharing a stack must not run in parallel.
+func (s *Stack) Checkpoint(ctx context.Context, name string) error {
+	if name == "" || strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+		return fmt.Errorf("invalid checkpoint name %q", name)
+	}
+	services, err := s.runningServices(ctx)
+	if err != nil {
+		return err
+	}
+	rpcURL, err := s.blockchainRPCURL(ctx)
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Join(s.tempDir, "checkpoints", name)
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("clear checkpoint dir: %w", err)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("create checkpoint dir: %w", err)
+	}
+
+	resume, err := s.pause(ctx, services, fmt.Sprintf("checkpoint %q", name))
+	if err != nil {
+		return err
+	}
+	defer resume()
+
+	evmID, err := evmSnapshot(ctx, rpcURL)
+	if err != nil {
+		return err
+	}
+
+	vols := mountedVolumes(services)
+	for _, v := range vols {
+		if err := snapshot.ArchiveVolume(ctx, s.projectName, v, dir); err != nil {
+			return fmt.Errorf("checkpoint %q: %w", name, err)
+		}
+	}
+
+	if s.checkpoints == nil {
+		s.checkpoints = make(map[string]*checkpoint)
+	}
+	s.checkpointSeq++
+	s.checkpoints[name] = &checkpoint{dir: dir, volumes: vols, evmID: evmID, seq: s.checkpointSeq}
+	s.t.Logf("smeltery: checkpoint %q (%d volume(s), evm snapshot %s)", name, len(vols), evmID)
+	return nil
+}
+
+// Rollback returns the stack to the state recorded by Checkpoint(name).
+// Every running service except the blockchain is stopped, its volumes
+// are restored from the checkpoint, the chain is reverted with
+// evm_revert, and the services are restarted in their original start
+// order, each waited on until healthy before the next starts.
+//
+// The same checkpoint can be rolled back to any number of times. Like
+// evm_revert itself, rolling back discards checkpoints taken after the
+// target. In-memory state of services without volumes (e.g. caches) is
+// reset by the restart rather than restored.
+func (s *Stack) Rollback(ctx context.Context, name string) error {
+	cp, ok := s.checkpoints[name]
+	if !ok {
+		return fmt.Errorf("no checkpoint named %q", name)
+	}
+	services, err := s.runningServices(ctx)
+	if err != nil {
+		return err
+	}
+	rpcURL, err := s.blockchainRPCURL(ctx)
+	if err != nil {
+		return err
+	}
+
+	stopTimeout := 30 * time.Second
+	for i := len(services) - 1; i >= 0; i-- {
+		if err := services[i].container.Stop(ctx, &stopTimeout); err != nil {
+			return fmt.Errorf("stop %s: %w", services[i].name, err)
+		}
+	}
+
+	for _, v := range cp.volumes {
+		if err := snapshot.RestoreVolumeInPlace(ctx, s.projectName, v, cp.dir); err != nil {
+			return fmt.Errorf("rollback %q: %w", name, err)
+		}
+	}
+
+	raw, err := snapshot.AnvilRPC(ctx, rpcURL, "evm_revert", cp.evmID)
+	if err != nil {
+		return err
+	}
+	var reverted bool
+	if err := json.Unmarshal(raw, &reverted); err != nil || !reverted {
+		return fmt.Errorf("evm_revert %s: anvil refused (result %s)", cp.evmID, raw)
+	}
+	if cp.evmID, err = evmSnapshot(ctx, rpcURL); err != nil {
+		return err
+	}
+	for other, c := range s.checkpoints {
+		if c.seq > cp.seq {
+			delete(s.checkpoints, other)
+			_ = os.RemoveAll(c.dir)
+		}
+	}
+
+	for _, svc := range services {
+		if err := svc.container.Start(ctx); err != nil {
+			return fmt.Errorf("start %s: %w", svc.name, err)
+		}
+		if err := waitHealthy(ctx, svc, 3*time.Minute); err != nil {
+			return err
+		}
+	}
+	s.t.Logf("smeltery: rolled back to checkpoint %q", name)
+	return nil
+}
+
+// runningServices returns every running service container other than
+// the blockchain, in the order they were started. Compose starts
+// services in dependency order, so replaying that order on restart
+// satisfies depends_on without parsing it. One-shot init containers
+// that have already exited are skipped.
+func (s *Stack) runningServices(ctx context.Context) ([]runningService, error) {
+	var out []runningService
+	for _, name := range s.compose.Services() {
+		if name == snapshot.BlockchainService {
+			continue
+		}
+		c, err := s.compose.ServiceContainer(ctx, name)
+		if err != nil {
+			// Services gated behind an inactive profile have no container.
+			continue
+		}
+		info, err := c.Inspect(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("inspect %s: %w", name, err)
+		}
+		if info.State == nil || !info.State.Running {
+			continue
+		}
+		startedAt, _ := time.Parse(time.RFC3339Nano, info.State.StartedAt)
+		svc := runningService{name: name, container: c, startedAt: startedAt}
+		prefix := s.projectName + "_"
+		for _, m := range info.Mounts {
+			if string(m.Type) == "volume" && strings.HasPrefix(m.Name, prefix) {
+				svc.volumes = append(svc.volumes, strings.TrimPrefix(m.Name, prefix))
+			}
+		}
+		out = append(out, svc)
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].startedAt.Before(out[j].startedAt) })
+	return out, nil
+}
+
+// blockchainRPCURL returns the host-side URL of anvil's RPC port.
+func (s *Stack) blockchainRPCURL(ctx context.Context) (string, error) {
+	c, err := s.compose.ServiceContainer(ctx, snapshot.BlockchainService)
+	if err != nil {
+		return "", fmt.Errorf("get %s container: %w", snapshot.BlockchainService, err)
+	}
+	host, err := c.Host(ctx)
+	if err != nil {
+		return "", fmt.Errorf("get %s host: %w", snapshot.BlockchainService, err)
+	}
+	port, err := c.MappedPort(ctx, "8545/tcp")
+	if err != nil {
+		return "", fmt.Errorf("get %s port: %w", snapshot.BlockchainService, err)
+	}
+	return fmt.Sprintf("http://%s:%s", host, port.Port()), nil
+}
+
+// evmSnapshot takes an anvil snapshot and returns its id.
+func evmSnapshot(ctx context.Context, rpcURL string) (string, error) {
+	raw, err := snapshot.AnvilRPC(ctx, rpcURL, "evm_snapshot")
+	if err != nil {
+		return "", err
+	}
+	var id string
+	if err := json.Unmarshal(raw, &id); err != nil {
+		return "", fmt.Errorf("evm_snapshot: decode result: %w", err)
+	}
+	return id, nil
+}
+
+// waitHealthy polls a restarted container until its healthcheck passes.
+// Containers without a healthcheck count as ready once running.
+func waitHealthy(ctx context.Context, svc runningService, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	last := "unknown"
+	for {
+		state, err := svc.container.State(ctx)
+		if err != nil {
+			return fmt.Errorf("state of %s: %w", svc.name, err)
+		}
+		if state.Running && state.Health == nil {
+			return nil
+		}
+		if state.Health != nil {
+			if string(state.Health.Status) == "healthy" {
+				return nil
+			}
+			last = string(state.Health.Status)
+		} else {
+			last = string(state.Status)
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%s not healthy after %s (last status: %s)", svc.name, timeout, last)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+}
+
+// mountedVolumes returns the sorted, de-duplicated volume names the
+// services mount.
+func mountedVolumes(services []runningService) []string {
+	seen := make(map[string]struct{})
+	for _, svc := range services {
+		for _, v := range svc.volumes {
+			seen[v] = struct{}{}
+		}
+	}
+	out := make([]string, 0, len(seen))
+	for v := range seen {
+		out = append(out, v)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// pause freezes the services' containers and returns the func that
+// unpauses them. The unpause uses a fresh context so a cancelled ctx
+// doesn't leave the stack frozen for the rest of the test; what names the
+// operation in the log if it fails anyway. Containers paused before a
+// failure are unpaused again.
+func (s *Stack) pause(ctx context.Context, services []runningService, what string) (func(), error) {
+	cli, err := dockerapi.Client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var paused []string
+	unpause := func() {
+		for _, id := range paused {
+			if _, err := cli.ContainerUnpause(context.Background(), id, client.ContainerUnpauseOptions{}); err != nil {
+				s.t.Logf("smeltery: unpause after %s failed: %v", what, err)
+			}
+		}
+	}
+	for _, svc := range services {
+		id := svc.container.GetContainerID()
+		if _, err := cli.ContainerPause(ctx, id, client.ContainerPauseOptions{}); err != nil {
+			unpause()
+			return nil, fmt.Errorf("pause %s: %w", svc.name, err)
+		}
+		paused = append(paused, id)
+	}
+	return unpause, nil
+}
@@ -1,12 +1,16 @@
 package stack
 
 import (
-	"bufio"
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
-	"os/exec"
 	"strings"
 	"testing"
+
+	"github.com/moby/moby/api/pkg/stdcopy"
+	"github.com/moby/moby/client"
+	"github.com/storacha/smelt/internal/dockerapi"
 )
 
 // stackProjectPrefix is the compose project-name prefix every pkg/stack
@@ -20,30 +24,60 @@ const stackProjectPrefix = "smeltery-"
 // into the test output (and thus into CI job output) even after subsequent
 // teardown and Ryuk reaping remove the containers themselves.
 //
-// Uses the docker CLI (rather than the testcontainers API) so we don't need
-// to enumerate service names, and so it works even when the compose stack
-// failed mid-Up with only some services running.
+// Lists containers by compose project label through the Engine API (rather
+// than the testcontainers compose API) so we don't need to enumerate
+// service names, and so it works even when the compose stack failed
+// mid-Up with only some services running.
 func dumpProjectLogs(t *testing.T, projectName string) {
 	t.Helper()
-	filter := "label=com.docker.compose.project=" + projectName
-	out, err := exec.Command("docker", "ps", "-a",
-		"--filter", filter,
-		"--format", "{{.Names}}").Output()
+	ctx := context.Background()
+	cli, err := dockerapi.Client(ctx)
+	if err != nil {
+		t.Logf("smeltery: listing containers for project %s failed: %v", projectName, err)
+		return
+	}
+	list, err := cli.ContainerList(ctx, client.ContainerListOptions{
+		All:     true,
+		Filters: make(client.Filters).Add("label", "com.docker.compose.project="+projectName),
+	})
 	if err != nil {
 		t.Logf("smeltery: listing containers for project %s failed: %v", projectName, err)
 		return
 	}
-	names := splitLines(string(out))
-	if len(names) == 0 {
+	if len(list.Items) == 0 {
 		t.Logf("smeltery: no containers found for project %s", projectName)
 		return
 	}
-	for _, name := range names {
-		logs, _ := exec.Command("docker", "logs", "--tail", "200", name).CombinedOutput()
-		t.Logf("=== container logs: %s ===\n%s", name, logs)
+	for _, c := range list.Items {
+		name := c.ID
+		if len(c.Names) > 0 {
+			name = strings.TrimPrefix(c.Names[0], "/")
+		}
+		t.Logf("=== container logs: %s ===\n%s", name, containerLogs(ctx, cli, c.ID))
 	}
 }
 
+// containerLogs returns the last 200 lines of a container's combined
+// output, or the error that prevented reading them.
+func containerLogs(ctx context.Context, cli *client.Client, id string) string {
+	rc, err := cli.ContainerLogs(ctx, id, client.ContainerLogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Tail:       "200",
+	})
+	if err != nil {
+		return err.Error()
+	}
+	defer rc.Close()
+	var buf bytes.Buffer
+	// Containers without a TTY multiplex stdout and stderr; interleave
+	// them the way `docker logs` prints them.
+	if _, err := stdcopy.StdCopy(&buf, &buf, rc); err != nil {
+		fmt.Fprintf(&buf, "\n(reading logs: %v)", err)
+	}
+	return buf.String()
+}
+
 // CleanupLeaked removes containers and volumes left behind by prior
 // pkg/stack test runs that didn't tear down cleanly (SIGKILL, panic,
 // `keepOnFailure` without manual cleanup, oom-killed test binary, etc.).
@@ -81,33 +115,68 @@ type listRemover struct {
 
 var leakedContainers = listRemover{
 	list: func(ctx context.Context, namePrefix string) ([]string, error) {
-		out, err := exec.CommandContext(ctx, "docker", "ps", "-a",
-			"--filter", "name="+namePrefix,
-			"--format", "{{.ID}}").Output()
+		cli, err := dockerapi.Client(ctx)
 		if err != nil {
 			return nil, err
 		}
-		return splitLines(string(out)), nil
+		list, err := cli.ContainerList(ctx, client.ContainerListOptions{
+			All:     true,
+			Filters: make(client.Filters).Add("name", namePrefix),
+		})
+		if err != nil {
+			return nil, err
+		}
+		ids := make([]string, 0, len(list.Items))
+		for _, c := range list.Items {
+			ids = append(ids, c.ID)
+		}
+		return ids, nil
 	},
 	remove: func(ctx context.Context, ids []string) error {
-		args := append([]string{"rm", "-f"}, ids...)
-		return exec.CommandContext(ctx, "docker", args...).Run()
+		cli, err := dockerapi.Client(ctx)
+		if err != nil {
+			return err
+		}
+		var errs []error
+		for _, id := range ids {
+			if _, err := cli.ContainerRemove(ctx, id, client.ContainerRemoveOptions{Force: true}); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		return errors.Join(errs...)
 	},
 }
 
 var leakedVolumes = listRemover{
 	list: func(ctx context.Context, namePrefix string) ([]string, error) {
-		out, err := exec.CommandContext(ctx, "docker", "volume", "ls",
-			"--filter", "name="+namePrefix,
-			"--format", "{{.Name}}").Output()
+		cli, err := dockerapi.Client(ctx)
 		if err != nil {
 			return nil, err
 		}
-		return splitLines(string(out)), nil
+		list, err := cli.VolumeList(ctx, client.VolumeListOptions{
+			Filters: make(client.Filters).Add("name", namePrefix),
+		})
+		if err != nil {
+			return nil, err
+		}
+		names := make([]string, 0, len(list.Items))
+		for _, v := range list.Items {
+			names = append(names, v.Name)
+		}
+		return names, nil
 	},
 	remove: func(ctx context.Context, names []string) error {
-		args := append([]string{"volume", "rm", "-f"}, names...)
-		return exec.CommandContext(ctx, "docker", args...).Run()
+		cli, err := dockerapi.Client(ctx)
+		if err != nil {
+			return err
+		}
+		var errs []error
+		for _, name := range names {
+			if _, err := cli.VolumeRemove(ctx, name, client.VolumeRemoveOptions{Force: true}); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		return errors.Join(errs...)
 	},
 }
 
@@ -121,14 +190,3 @@ func removeByPrefix(ctx context.Context, r listRemover, prefix string) error {
 	}
 	return r.remove(ctx, ids)
 }
-
-func splitLines(s string) []string {
-	var out []string
-	sc := bufio.NewScanner(strings.NewReader(s))
-	for sc.Scan() {
-		if line := strings.TrimSpace(sc.Text()); line != "" {
-			out = append(out, line)
-		}
-	}
-	return out
-}
@@ -0,0 +1,237 @@
+package stack
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/moby/moby/client"
+
+	"github.com/storacha/smelt/internal/dockerapi"
+)
+
+// CopyTo copies hostPath — a file or a directory tree — into a service
+// container so that it ends up at containerPath, creating missing parent
+// directories. It's the API equivalent of `docker cp hostPath
+// <container>:containerPath` and doesn't need any tools in the container.
+func (s *Stack) CopyTo(ctx context.Context, service, hostPath, containerPath string) error {
+	if !path.IsAbs(containerPath) {
+		return fmt.Errorf("container path %q must be absolute", containerPath)
+	}
+	id, err := s.containerID(ctx, service)
+	if err != nil {
+		return err
+	}
+	cli, err := dockerapi.Client(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Archive entries are named by their full path under /, so the engine
+	// creates containerPath's parents as it extracts.
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(writeTar(pw, hostPath, strings.TrimPrefix(path.Clean(containerPath), "/")))
+	}()
+	defer pr.Close()
+	if _, err := cli.CopyToContainer(ctx, id, client.CopyToContainerOptions{
+		DestinationPath: "/",
+		Content:         pr,
+	}); err != nil {
+		return fmt.Errorf("copy %s to %s:%s: %w", hostPath, service, containerPath, err)
+	}
+	return nil
+}
+
+// CopyFrom copies containerPath — a file or a directory tree — out of a
+// service container to hostPath, replacing whatever is there.
+func (s *Stack) CopyFrom(ctx context.Context, service, containerPath, hostPath string) error {
+	id, err := s.containerID(ctx, service)
+	if err != nil {
+		return err
+	}
+	cli, err := dockerapi.Client(ctx)
+	if err != nil {
+		return err
+	}
+	res, err := cli.CopyFromContainer(ctx, id, client.CopyFromContainerOptions{SourcePath: containerPath})
+	if err != nil {
+		return fmt.Errorf("copy %s:%s: %w", service, containerPath, err)
+	}
+	defer res.Content.Close()
+
+	if err := os.RemoveAll(hostPath); err != nil {
+		return err
+	}
+	if err := extractTar(res.Content, hostPath); err != nil {
+		return fmt.Errorf("copy %s:%s to %s: %w", service, containerPath, hostPath, err)
+	}
+	return nil
+}
+
+func (s *Stack) containerID(ctx context.Context, service string) (string, error) {
+	container, err := s.compose.ServiceContainer(ctx, service)
+	if err != nil {
+		return "", fmt.Errorf("get container for %s: %w", service, err)
+	}
+	return container.GetContainerID(), nil
+}
+
+// writeTar archives the tree at src with its root entry named name.
+func writeTar(w io.Writer, src, name string) error {
+	tw := tar.NewWriter(w)
+	err := filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		var link string
+		if info.Mode()&fs.ModeSymlink != 0 {
+			if link, err = os.Readlink(p); err != nil {
+				return err
+			}
+		}
+		hdr, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		hdr.Name = path.Join(name, filepath.ToSlash(rel))
+		if d.IsDir() {
+			hdr.Name += "/"
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// extractTar unpacks an archive whose entries share one root — what the
+// engine returns for a copied path — so that root lands at dst. Entries
+// that would escape dst are rejected. Everything below the root entry is
+// written through an [os.Root] on dst, so a symlink in the archive can't
+// be used to write outside it either: the link is created as-is, but a
+// later entry resolving through it to outside dst fails.
+func extractTar(r io.Reader, dst string) error {
+	var root *os.Root
+	defer func() {
+		if root != nil {
+			root.Close()
+		}
+	}()
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		name := path.Clean(hdr.Name)
+		if path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+			return fmt.Errorf("archive entry %q escapes the destination", hdr.Name)
+		}
+		_, rel, _ := strings.Cut(name, "/")
+		mode := fs.FileMode(hdr.Mode).Perm()
+		if rel == "" {
+			// The root entry is dst itself: a directory for a copied
+			// tree, or the whole copy when it's a single file.
+			if err := extractRootEntry(tr, hdr, dst, mode); err != nil {
+				return err
+			}
+			continue
+		}
+		if root == nil {
+			if err := os.MkdirAll(dst, 0755); err != nil {
+				return err
+			}
+			if root, err = os.OpenRoot(dst); err != nil {
+				return err
+			}
+		}
+		target := filepath.FromSlash(rel)
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := root.MkdirAll(target, mode|0700); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := root.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			f, err := root.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(f, tr)
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if err := root.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			if err := root.Symlink(hdr.Linkname, target); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// extractRootEntry writes an archive's root entry at dst.
+func extractRootEntry(r io.Reader, hdr *tar.Header, dst string, mode fs.FileMode) error {
+	switch hdr.Typeflag {
+	case tar.TypeDir:
+		return os.MkdirAll(dst, mode|0700)
+	case tar.TypeReg:
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return err
+		}
+		f, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(f, r)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		return err
+	case tar.TypeSymlink:
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return err
+		}
+		return os.Symlink(hdr.Linkname, dst)
+	}
+	return nil
+}
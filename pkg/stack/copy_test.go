@@ -0,0 +1,107 @@
+package stack
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTarRoundTrip(t *testing.T) {
+	src := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(src, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "a.txt"), []byte("alpha"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "sub", "b.bin"), []byte{0, 1, 2}, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("a.txt", filepath.Join(src, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	// The engine names entries by the base of the copied path, which is
+	// what CopyFrom's extraction strips.
+	var buf bytes.Buffer
+	if err := writeTar(&buf, src, "data"); err != nil {
+		t.Fatal(err)
+	}
+	dst := filepath.Join(t.TempDir(), "out")
+	if err := extractTar(&buf, dst); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string]string{"a.txt": "alpha", "sub/b.bin": "\x00\x01\x02", "link": "alpha"} {
+		got, err := os.ReadFile(filepath.Join(dst, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+	if info, err := os.Stat(filepath.Join(dst, "sub", "b.bin")); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("sub/b.bin mode: %v, %v", info, err)
+	}
+
+	// A single file lands at dst itself.
+	buf.Reset()
+	if err := writeTar(&buf, filepath.Join(src, "a.txt"), "a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(t.TempDir(), "copy.txt")
+	if err := extractTar(&buf, file); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := os.ReadFile(file); err != nil || string(got) != "alpha" {
+		t.Errorf("single file: %q, %v", got, err)
+	}
+}
+
+func TestExtractTarRejectsEscapes(t *testing.T) {
+	for _, name := range []string{"../evil", "/etc/evil", "root/../../evil"} {
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		if err := tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644}); err != nil {
+			t.Fatal(err)
+		}
+		tw.Close()
+		if err := extractTar(&buf, t.TempDir()); err == nil {
+			t.Errorf("%s: want error", name)
+		}
+	}
+}
+
+func TestExtractTarRejectsSymlinkEscapes(t *testing.T) {
+	outside := t.TempDir()
+	for name, linkname := range map[string]string{"absolute": outside, "relative": "../../" + filepath.Base(outside)} {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			tw := tar.NewWriter(&buf)
+			for _, hdr := range []*tar.Header{
+				{Name: "root/", Typeflag: tar.TypeDir, Mode: 0755},
+				{Name: "root/link", Typeflag: tar.TypeSymlink, Linkname: linkname},
+				{Name: "root/link/evil", Typeflag: tar.TypeReg, Mode: 0644, Size: 4},
+			} {
+				if err := tw.WriteHeader(hdr); err != nil {
+					t.Fatal(err)
+				}
+				if hdr.Size > 0 {
+					tw.Write([]byte("evil"))
+				}
+			}
+			tw.Close()
+
+			dst := filepath.Join(t.TempDir(), "out")
+			if err := extractTar(&buf, dst); err == nil {
+				t.Error("want error writing through an escaping symlink")
+			}
+			if _, err := os.Stat(filepath.Join(outside, "evil")); err == nil {
+				t.Error("archive wrote outside the destination")
+			}
+		})
+	}
+}
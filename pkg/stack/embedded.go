@@ -1,13 +1,23 @@
 package stack
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
 	"sort"
+	"strings"
+	"time"
 
 	"github.com/storacha/smelt"
+	"github.com/storacha/smelt/pkg/manifest"
+	"github.com/storacha/smelt/pkg/snapshot"
 )
 
 // embeddedSnapshotsRoot is the path within smelt.EmbeddedFiles under
@@ -15,9 +25,15 @@ import (
 // root (snapshots/<name>/...).
 const embeddedSnapshotsRoot = "snapshots"
 
+// SnapshotCacheEnv overrides where extracted embedded snapshots are
+// cached. Defaults to smelt/snapshots under the user cache dir
+// (~/.cache on Linux). Point CI caches here to skip extraction across
+// jobs.
+const SnapshotCacheEnv = "SMELT_SNAPSHOT_CACHE"
+
 // ListEmbeddedSnapshots returns the names of snapshots bundled with
 // this smelt module. Each name is usable as the argument to
-// WithEmbeddedSnapshot.
+// WithEmbeddedSnapshot. EmbeddedSnapshots describes them in full.
 //
 // External consumers (packages that import smelt) should call this
 // rather than hunting for snapshot paths on disk — paths into the
@@ -32,7 +48,9 @@ func ListEmbeddedSnapshots() ([]string, error) {
 	}
 	var names []string
 	for _, e := range entries {
-		if e.IsDir() {
+		// Skip the shared chunk store (and any other dot-dirs); only
+		// real snapshot directories are loadable by name.
+		if e.IsDir() && !strings.HasPrefix(e.Name(), ".") {
 			names = append(names, e.Name())
 		}
 	}
@@ -40,46 +58,233 @@ func ListEmbeddedSnapshots() ([]string, error) {
 	return names, nil
 }
 
-// extractEmbeddedSnapshot materializes the named snapshot from the
-// embedded FS into a sibling dir under parent and returns its absolute
-// path. The result is suitable as the `path` argument to the normal
-// snapshot-load flow — by re-using an on-disk path here we avoid
-// forking the load logic for embedded vs. external snapshots.
-func extractEmbeddedSnapshot(name, parent string) (string, error) {
-	srcRoot := embeddedSnapshotsRoot + "/" + name
-	if _, err := fs.Stat(smelt.EmbeddedFiles, srcRoot); err != nil {
-		available, _ := ListEmbeddedSnapshots()
-		return "", fmt.Errorf("embedded snapshot %q not found (available: %v)", name, available)
+// EmbeddedSnapshot describes a snapshot bundled with this smelt module,
+// read from its descriptor and smelt.yml without extracting anything.
+type EmbeddedSnapshot struct {
+	// Name is the argument to WithEmbeddedSnapshot.
+	Name      string
+	CreatedAt time.Time
+	// Nodes is the piri topology the snapshot was saved with; a stack
+	// booted from it runs exactly these nodes.
+	Nodes   []manifest.ResolvedPiriNode
+	Volumes []string
+	Images  map[string]snapshot.ImageInfo
+	// Size is the bytes the snapshot occupies once extracted, including
+	// the chunks its chunked volumes reference.
+	Size int64
+	// Digest ("sha256:<hex>") identifies the snapshot's content. It keys
+	// the shared extraction cache, so a module upgrade that changes a
+	// snapshot never reuses a stale copy.
+	Digest string
+
+	chunks []string
+}
+
+// EmbeddedSnapshots returns every snapshot bundled with this smelt
+// module, sorted by name.
+func EmbeddedSnapshots() ([]EmbeddedSnapshot, error) {
+	names, err := ListEmbeddedSnapshots()
+	if err != nil {
+		return nil, err
 	}
+	out := make([]EmbeddedSnapshot, 0, len(names))
+	for _, name := range names {
+		s, err := embeddedSnapshot(name)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *s)
+	}
+	return out, nil
+}
 
-	dstRoot := filepath.Join(parent, "embedded-snapshot-"+name)
-	if err := os.MkdirAll(dstRoot, 0755); err != nil {
-		return "", err
+func embeddedSnapshot(name string) (*EmbeddedSnapshot, error) {
+	root := path.Join(embeddedSnapshotsRoot, name)
+	descData, err := fs.ReadFile(smelt.EmbeddedFiles, path.Join(root, snapshot.DescriptorFile))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			available, _ := ListEmbeddedSnapshots()
+			return nil, fmt.Errorf("embedded snapshot %q not found (available: %v)", name, available)
+		}
+		return nil, fmt.Errorf("embedded snapshot %q: %w", name, err)
+	}
+	var desc snapshot.Descriptor
+	if err := json.Unmarshal(descData, &desc); err != nil {
+		return nil, fmt.Errorf("embedded snapshot %q: parse descriptor: %w", name, err)
+	}
+	manifestData, err := fs.ReadFile(smelt.EmbeddedFiles, path.Join(root, "smelt.yml"))
+	if err != nil {
+		return nil, fmt.Errorf("embedded snapshot %q: %w", name, err)
+	}
+	m, err := manifest.ParseBytes(manifestData)
+	if err != nil {
+		return nil, fmt.Errorf("embedded snapshot %q: parse smelt.yml: %w", name, err)
+	}
+	nodes, err := m.Resolve()
+	if err != nil {
+		return nil, fmt.Errorf("embedded snapshot %q: resolve smelt.yml: %w", name, err)
+	}
+	chunks, err := snapshot.ChunkFilesFS(smelt.EmbeddedFiles, root)
+	if err != nil {
+		return nil, fmt.Errorf("embedded snapshot %q: read chunk indexes: %w", name, err)
 	}
 
-	err := fs.WalkDir(smelt.EmbeddedFiles, srcRoot, func(path string, d fs.DirEntry, err error) error {
+	// The descriptor's digests cover every other file, and chunk names
+	// are their own digests, so hashing those identifies the content.
+	// Snapshots predating digests fall back to hashing every file.
+	h := sha256.New()
+	h.Write(descData)
+	var size int64
+	err = fs.WalkDir(smelt.EmbeddedFiles, root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
 		if err != nil {
 			return err
 		}
-		rel, relErr := filepath.Rel(srcRoot, path)
-		if relErr != nil {
-			return relErr
+		size += info.Size()
+		if len(desc.Digests) > 0 {
+			return nil
 		}
-		dst := filepath.Join(dstRoot, rel)
-		if d.IsDir() {
-			return os.MkdirAll(dst, 0755)
-		}
-		data, err := smelt.EmbeddedFiles.ReadFile(path)
+		f, err := smelt.EmbeddedFiles.Open(p)
 		if err != nil {
 			return err
 		}
-		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		defer f.Close()
+		fmt.Fprintf(h, "%s\x00", p)
+		_, err = io.Copy(h, f)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("embedded snapshot %q: %w", name, err)
+	}
+	for _, c := range chunks {
+		info, err := fs.Stat(smelt.EmbeddedFiles, path.Join(embeddedSnapshotsRoot, snapshot.ChunkStoreDir, c))
+		if err != nil {
+			return nil, fmt.Errorf("embedded snapshot %q: %w", name, err)
+		}
+		size += info.Size()
+		fmt.Fprintf(h, "%s\x00", c)
+	}
+
+	return &EmbeddedSnapshot{
+		Name:      name,
+		CreatedAt: desc.CreatedAt,
+		Nodes:     nodes,
+		Volumes:   desc.Volumes,
+		Images:    desc.Images,
+		Size:      size,
+		Digest:    "sha256:" + hex.EncodeToString(h.Sum(nil)),
+		chunks:    chunks,
+	}, nil
+}
+
+// extractEmbeddedSnapshot returns an on-disk copy of the named embedded
+// snapshot, suitable as the `path` argument to the normal snapshot-load
+// flow — by re-using an on-disk path here we avoid forking the load
+// logic for embedded vs. external snapshots.
+//
+// Copies live in a per-user cache keyed by content digest, so parallel
+// tests (and later runs) share one extraction instead of each writing
+// hundreds of MB into its temp dir. An entry is extracted into a staging
+// dir, verified, then renamed into place, so a half-written copy is never
+// visible; when two processes race, the loser discards its copy and uses
+// the winner's. Cached copies are read-only by convention: the load path
+// only reads them.
+//
+// Volume archives are copied still compressed; snapshot.RestoreVolume
+// decompresses them as it streams into docker. Chunked snapshots get
+// their referenced chunks in the entry's chunk store, beside the
+// snapshot dir, which is where the restore path looks for them.
+func extractEmbeddedSnapshot(name string) (string, error) {
+	snap, err := embeddedSnapshot(name)
+	if err != nil {
+		return "", err
+	}
+	cacheRoot, err := snapshotCacheDir()
+	if err != nil {
+		return "", err
+	}
+	entry := filepath.Join(cacheRoot, strings.TrimPrefix(snap.Digest, "sha256:"))
+	dir := filepath.Join(entry, name)
+	if _, err := os.Stat(filepath.Join(dir, snapshot.DescriptorFile)); err == nil {
+		return dir, nil
+	}
+
+	if err := os.MkdirAll(cacheRoot, 0755); err != nil {
+		return "", fmt.Errorf("create snapshot cache: %w", err)
+	}
+	staging, err := os.MkdirTemp(cacheRoot, ".extract-*")
+	if err != nil {
+		return "", fmt.Errorf("create snapshot cache: %w", err)
+	}
+	defer os.RemoveAll(staging)
+	if err := writeEmbeddedSnapshot(snap, staging); err != nil {
+		return "", fmt.Errorf("extract embedded snapshot %q: %w", name, err)
+	}
+	if _, err := snapshot.VerifyDir(filepath.Join(staging, name)); err != nil {
+		return "", fmt.Errorf("extract embedded snapshot %q: %w", name, err)
+	}
+	if err := os.Rename(staging, entry); err != nil {
+		if _, statErr := os.Stat(filepath.Join(dir, snapshot.DescriptorFile)); statErr == nil {
+			return dir, nil
+		}
+		return "", fmt.Errorf("publish embedded snapshot %q: %w", name, err)
+	}
+	return dir, nil
+}
+
+// writeEmbeddedSnapshot copies snap into parent/<name>, and its chunks
+// into parent's chunk store.
+func writeEmbeddedSnapshot(snap *EmbeddedSnapshot, parent string) error {
+	srcRoot := path.Join(embeddedSnapshotsRoot, snap.Name)
+	dstRoot := filepath.Join(parent, snap.Name)
+	err := fs.WalkDir(smelt.EmbeddedFiles, srcRoot, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
 			return err
 		}
-		return os.WriteFile(dst, data, 0644)
+		rel := strings.TrimPrefix(strings.TrimPrefix(p, srcRoot), "/")
+		dst := filepath.Join(dstRoot, filepath.FromSlash(rel))
+		if d.IsDir() {
+			return os.MkdirAll(dst, 0755)
+		}
+		return copyEmbeddedFile(p, dst)
 	})
 	if err != nil {
-		return "", fmt.Errorf("extract embedded snapshot %q: %w", name, err)
+		return err
+	}
+	storeDst := filepath.Join(parent, snapshot.ChunkStoreDir)
+	for _, c := range snap.chunks {
+		src := path.Join(embeddedSnapshotsRoot, snapshot.ChunkStoreDir, c)
+		if err := copyEmbeddedFile(src, filepath.Join(storeDst, c)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func copyEmbeddedFile(src, dst string) error {
+	data, err := smelt.EmbeddedFiles.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(dst, data, 0644)
+}
+
+// snapshotCacheDir returns the root of the extraction cache: the
+// SnapshotCacheEnv override, else smelt/snapshots under the user cache
+// dir, else under the system temp dir.
+func snapshotCacheDir() (string, error) {
+	if dir := os.Getenv(SnapshotCacheEnv); dir != "" {
+		return filepath.Abs(dir)
+	}
+	base, err := os.UserCacheDir()
+	if err != nil {
+		base = os.TempDir()
 	}
-	return dstRoot, nil
+	return filepath.Join(base, "smelt", "snapshots"), nil
 }
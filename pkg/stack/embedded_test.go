@@ -0,0 +1,95 @@
+package stack
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/storacha/smelt/pkg/snapshot"
+)
+
+func TestEmbeddedSnapshots(t *testing.T) {
+	names, err := ListEmbeddedSnapshots()
+	if err != nil {
+		t.Fatal(err)
+	}
+	snaps, err := EmbeddedSnapshots()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snaps) != len(names) {
+		t.Fatalf("got %d snapshots, want %d", len(snaps), len(names))
+	}
+	for i, s := range snaps {
+		if s.Name != names[i] {
+			t.Errorf("snapshot %d: name %q, want %q", i, s.Name, names[i])
+		}
+		if s.CreatedAt.IsZero() || len(s.Nodes) == 0 || len(s.Volumes) == 0 || s.Size == 0 {
+			t.Errorf("%s: incomplete metadata: %+v", s.Name, s)
+		}
+		if !strings.HasPrefix(s.Digest, "sha256:") {
+			t.Errorf("%s: digest %q", s.Name, s.Digest)
+		}
+	}
+
+	if _, err := embeddedSnapshot("no-such-snapshot"); err == nil {
+		t.Error("want error for unknown snapshot")
+	}
+}
+
+func TestExtractEmbeddedSnapshotCaches(t *testing.T) {
+	names, err := ListEmbeddedSnapshots()
+	if err != nil || len(names) == 0 {
+		t.Skip("no embedded snapshots")
+	}
+	cache := t.TempDir()
+	t.Setenv(SnapshotCacheEnv, cache)
+
+	// Concurrent first extractions all land on the one published copy.
+	const n = 4
+	dirs := make([]string, n)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			dirs[i], errs[i] = extractEmbeddedSnapshot(names[0])
+		}()
+	}
+	wg.Wait()
+	for i := range n {
+		if errs[i] != nil {
+			t.Fatal(errs[i])
+		}
+		if dirs[i] != dirs[0] {
+			t.Fatalf("extractions disagree: %s vs %s", dirs[i], dirs[0])
+		}
+	}
+	if _, err := snapshot.VerifyDir(dirs[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := os.ReadDir(cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("cache holds %d entries, want 1 (staging dirs left behind?)", len(entries))
+	}
+
+	// A cached copy is reused as is.
+	marker := filepath.Join(dirs[0], "marker")
+	if err := os.WriteFile(marker, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	again, err := extractEmbeddedSnapshot(names[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(again, "marker")); err != nil {
+		t.Errorf("second extraction didn't reuse the cache: %v", err)
+	}
+}
@@ -11,6 +11,8 @@ import (
 
 // extractFiles extracts all embedded files to a temp directory,
 // maintaining the exact directory structure required for compose.
+// Embedded snapshots are left out: compose doesn't read them, and
+// extractEmbeddedSnapshot serves them from a shared cache.
 func extractFiles(t *testing.T) (string, error) {
 	tempDir := t.TempDir() // Automatically cleaned up by testing framework
 
@@ -19,6 +21,9 @@ func extractFiles(t *testing.T) (string, error) {
 		if err != nil {
 			return err
 		}
+		if path == embeddedSnapshotsRoot {
+			return fs.SkipDir
+		}
 
 		destPath := filepath.Join(tempDir, path)
 
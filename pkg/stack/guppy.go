@@ -0,0 +1,35 @@
+package stack
+
+import (
+	"context"
+	"testing"
+
+	"github.com/storacha/smelt/pkg/clients/guppy"
+)
+
+// guppy.ContainerClient drives a Stack through this interface.
+var _ guppy.Stack = (*Stack)(nil)
+
+// NewGuppyClient returns a guppy client for the identity called name: its
+// own agent, login and spaces in the stack's guppy container, isolated
+// from every other identity and from clients made with
+// guppy.NewContainerClient. Log it in as guppy.IdentityEmail(name):
+//
+//	alice := s.MustNewGuppyClient(t, "alice")
+//	bob := s.MustNewGuppyClient(t, "bob")
+//	if err := alice.Login(ctx, guppy.IdentityEmail("alice")); err != nil {
+//	    t.Fatal(err)
+//	}
+//	// ... alice creates a space and delegates it to bob ...
+func (s *Stack) NewGuppyClient(ctx context.Context, name string, options ...guppy.Option) (*guppy.ContainerClient, error) {
+	return guppy.NewIdentityClient(ctx, s, name, options...)
+}
+
+// MustNewGuppyClient is NewGuppyClient, calling t.Fatal on error.
+func (s *Stack) MustNewGuppyClient(t *testing.T, name string, options ...guppy.Option) *guppy.ContainerClient {
+	c, err := s.NewGuppyClient(t.Context(), name, options...)
+	if err != nil {
+		t.Fatalf("guppy client %s: %v", name, err)
+	}
+	return c
+}
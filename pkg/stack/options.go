@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/storacha/smelt/pkg/manifest"
+	"github.com/storacha/smelt/pkg/snapshot"
 )
 
 // PiriNodeConfig configures a single piri node in the test stack.
@@ -38,6 +39,12 @@ type config struct {
 	// Exactly one of snapshotPath / embeddedSnapshotName may be set.
 	snapshotPath         string
 	embeddedSnapshotName string
+	// snapshotImagePolicy handles image drift against the snapshot's
+	// recorded images. Empty means snapshot.ImagePolicyWarn.
+	snapshotImagePolicy snapshot.ImagePolicy
+
+	// proxy starts the forward proxy sidecar; see WithProxy.
+	proxy bool
 
 	// Stack configuration
 	timeout       time.Duration
@@ -184,6 +191,14 @@ func WithIPNIImage(image string) Option {
 	}
 }
 
+// WithProxy starts an HTTP forward proxy on the stack's network, so that
+// Stack.HTTPClient can reach services by their in-network names.
+func WithProxy() Option {
+	return func(c *config) {
+		c.proxy = true
+	}
+}
+
 // WithTimeout sets the maximum time to wait for the stack to start.
 func WithTimeout(d time.Duration) Option {
 	return func(c *config) {
@@ -234,9 +249,8 @@ func WithPiriNodes(nodes ...PiriNodeConfig) Option {
 // snapshot save` (manifest.json, smelt.yml, blockchain/, keys/, proofs/,
 // volumes/). Topology comes from the snapshot's embedded smelt.yml —
 // pairing with WithPiriCount or WithPiriNodes returns an error from
-// NewStack. Image references in your .env must match what the snapshot
-// was saved against (the Go SDK does not emit a drift warning; that's
-// the test author's responsibility).
+// NewStack. Images that differ from the ones the snapshot was saved
+// against are logged; see WithSnapshotImagePolicy to fail or pin instead.
 //
 // CI should exercise the cold-boot path. Skip in CI via an env check:
 //
@@ -260,7 +274,9 @@ func WithSnapshot(path string) Option {
 //	    stack.WithEmbeddedSnapshot("3-piri-filesystem-sqlite"),
 //	)
 //
-// Discover available names at runtime via stack.ListEmbeddedSnapshots().
+// Discover available names at runtime via stack.ListEmbeddedSnapshots(),
+// or their topology and images via stack.EmbeddedSnapshots(). The
+// snapshot is extracted once into a shared cache (see SnapshotCacheEnv).
 // Incompatible with WithSnapshot, WithPiriCount, WithPiriNodes. The
 // SMELT_TEST_NO_SNAPSHOT env-var skip pattern applies the same as with
 // WithSnapshot.
@@ -269,3 +285,18 @@ func WithEmbeddedSnapshot(name string) Option {
 		c.embeddedSnapshotName = name
 	}
 }
+
+// WithSnapshotImagePolicy sets what a snapshot boot does when the images
+// the stack would run differ from those recorded in the snapshot:
+//
+//   - snapshot.ImagePolicyWarn (default) logs the drift via t.Logf.
+//   - snapshot.ImagePolicyFail makes NewStack return an error.
+//   - snapshot.ImagePolicyPin runs the snapshot's recorded digests,
+//     overriding any With*Image option for the pinned services.
+//
+// Only meaningful with WithSnapshot or WithEmbeddedSnapshot.
+func WithSnapshotImagePolicy(policy snapshot.ImagePolicy) Option {
+	return func(c *config) {
+		c.snapshotImagePolicy = policy
+	}
+}
@@ -0,0 +1,65 @@
+package stack
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+)
+
+// The forward proxy sidecar WithProxy starts; see systems/common/compose.yml.
+const (
+	proxyProfile = "proxy"
+	proxyService = "proxy"
+	proxyPort    = "3128/tcp"
+)
+
+// ProxyEndpoint returns the host URL of the stack's forward proxy. The
+// stack must have been started WithProxy.
+func (s *Stack) ProxyEndpoint() string {
+	if !s.cfg.proxy {
+		s.t.Fatal("stack has no proxy: start it with stack.WithProxy()")
+	}
+	return s.serviceEndpoint(proxyService, proxyPort)
+}
+
+// HTTPClient returns a client that reaches the stack's services by their
+// in-network names — http://upload, http://piri-0:3000 and so on — through
+// the forward proxy, so host code can follow URLs the services hand out
+// (such as the validation links in login emails) natively. Requests to the
+// Docker host, e.g. the *Endpoint URLs, go direct. The stack must have
+// been started WithProxy.
+func (s *Stack) HTTPClient() *http.Client {
+	proxyURL, err := url.Parse(s.ProxyEndpoint())
+	if err != nil {
+		s.t.Fatalf("parsing proxy endpoint: %v", err)
+	}
+	container, err := s.compose.ServiceContainer(context.Background(), proxyService)
+	if err != nil {
+		s.t.Fatalf("getting %s container: %v", proxyService, err)
+	}
+	dockerHost, err := container.Host(context.Background())
+	if err != nil {
+		s.t.Fatalf("getting %s host: %v", proxyService, err)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = func(req *http.Request) (*url.URL, error) {
+		if isHostLocal(req.URL.Hostname(), dockerHost) {
+			return nil, nil
+		}
+		return proxyURL, nil
+	}
+	return &http.Client{Transport: transport}
+}
+
+// isHostLocal reports whether hostname addresses the machine the test runs
+// on (or the Docker host publishing the stack's ports) rather than a
+// service on the stack's network.
+func isHostLocal(hostname, dockerHost string) bool {
+	if hostname == "localhost" || hostname == dockerHost {
+		return true
+	}
+	ip := net.ParseIP(hostname)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,23 @@
+package stack
+
+import "testing"
+
+func TestIsHostLocal(t *testing.T) {
+	tests := []struct {
+		hostname string
+		want     bool
+	}{
+		{"localhost", true},
+		{"127.0.0.1", true},
+		{"::1", true},
+		{"docker.internal", true},
+		{"upload", false},
+		{"piri-0", false},
+		{"172.18.0.5", false},
+	}
+	for _, tt := range tests {
+		if got := isHostLocal(tt.hostname, "docker.internal"); got != tt.want {
+			t.Errorf("isHostLocal(%q) = %v, want %v", tt.hostname, got, tt.want)
+		}
+	}
+}
@@ -1,10 +1,14 @@
 package stack
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"testing"
+
+	"gopkg.in/yaml.v3"
 
 	"github.com/storacha/smelt/pkg/manifest"
 	"github.com/storacha/smelt/pkg/snapshot"
@@ -59,6 +63,46 @@ func loadSnapshotTopology(snapshotDir string) ([]manifest.ResolvedPiriNode, erro
 	return nodes, nil
 }
 
+// applySnapshotImagePolicy compares the snapshot's recorded images with
+// the ones the compose files resolve to under env, then warns, fails or —
+// for snapshot.ImagePolicyPin — rewrites env in place so the pinned
+// services run the recorded digests.
+func applySnapshotImagePolicy(ctx context.Context, t *testing.T, policy snapshot.ImagePolicy,
+	desc *snapshot.Descriptor, dir string, composeFiles []string, env map[string]string) error {
+	policy, err := snapshot.ParseImagePolicy(string(policy))
+	if err != nil {
+		return err
+	}
+	saved := desc.Images
+	if policy == snapshot.ImagePolicyPin {
+		pins, unpinned := snapshot.PinnedImageEnv(desc.Images)
+		for k, v := range pins {
+			env[k] = v
+		}
+		t.Logf("smeltery: pinned %d image variable(s) to the snapshot's images", len(pins))
+		saved = make(map[string]snapshot.ImageInfo, len(unpinned))
+		for _, svc := range unpinned {
+			saved[svc] = desc.Images[svc]
+		}
+	}
+	current, err := snapshot.ComposeImages(ctx, dir, composeFiles, env)
+	if err != nil {
+		if policy == snapshot.ImagePolicyFail {
+			return fmt.Errorf("resolve images for drift check: %w", err)
+		}
+		t.Logf("smeltery: could not resolve images for drift check: %v", err)
+		return nil
+	}
+	drift, err := snapshot.CheckImages(policy, saved, current)
+	if err != nil {
+		return err
+	}
+	for _, line := range drift {
+		t.Logf("smeltery: WARNING: image differs from snapshot: %s", line)
+	}
+	return nil
+}
+
 // seedBaselineState populates the tempDir's generated/snapshot-scratch/
 // with the embedded post-deploy blockchain baseline so the compose
 // bind-mounts resolve without docker auto-creating the source paths as
@@ -83,3 +127,80 @@ func seedBaselineState(tempDir string) error {
 	}
 	return nil
 }
+
+// SaveSnapshot writes the stack's current state to dir as a snapshot that
+// WithSnapshot (or `smelt snapshot load`) can boot from later — so a test
+// that does expensive setup once (many uploads, many piri registrations)
+// can hand that state to every later run instead of repeating it.
+//
+// The stack keeps running. Like Checkpoint, every service except the
+// blockchain is paused while its volumes are archived and chain state is
+// taken via anvil_dumpState, so the snapshot is one consistent instant.
+// The snapshot's smelt.yml records this stack's piri topology. dir must
+// not already exist.
+func (s *Stack) SaveSnapshot(ctx context.Context, dir string) error {
+	services, err := s.runningServices(ctx)
+	if err != nil {
+		return err
+	}
+	rpcURL, err := s.blockchainRPCURL(ctx)
+	if err != nil {
+		return err
+	}
+	images, err := s.images(ctx)
+	if err != nil {
+		return err
+	}
+	smeltYML, err := yaml.Marshal(manifest.FromResolved(s.piriNodes))
+	if err != nil {
+		return fmt.Errorf("marshal smelt.yml: %w", err)
+	}
+
+	generated := filepath.Join(s.tempDir, "generated")
+	desc, err := snapshot.Capture(ctx, snapshot.CaptureOpts{
+		Dir:                   dir,
+		ProjectName:           s.projectName,
+		Volumes:               mountedVolumes(services),
+		KeysDir:               filepath.Join(generated, "keys"),
+		ProofsDir:             filepath.Join(generated, "proofs"),
+		Manifest:              smeltYML,
+		DeployedAddressesPath: filepath.Join(generated, "snapshot-scratch", "deployed-addresses.json"),
+		RPCURL:                rpcURL,
+		Images:                images,
+		Freeze: func(ctx context.Context) (func(), error) {
+			return s.pause(ctx, services, "snapshot save")
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("save snapshot: %w", err)
+	}
+	s.t.Logf("smeltery: saved snapshot to %s (%d piri node(s), %d volume(s))",
+		dir, len(s.piriNodes), len(desc.Volumes))
+	return nil
+}
+
+// images records the image each service container was created from, for
+// the snapshot descriptor's drift checks.
+func (s *Stack) images(ctx context.Context) (map[string]snapshot.ImageInfo, error) {
+	out := make(map[string]snapshot.ImageInfo)
+	for _, name := range s.compose.Services() {
+		if name == proxyService {
+			// stateless and optional: a stack restored without it
+			// hasn't drifted
+			continue
+		}
+		c, err := s.compose.ServiceContainer(ctx, name)
+		if err != nil {
+			continue
+		}
+		info, err := c.Inspect(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("inspect %s: %w", name, err)
+		}
+		if info.Config == nil || info.Config.Image == "" {
+			continue
+		}
+		out[name] = snapshot.ImageInfoFor(ctx, info.Config.Image)
+	}
+	return out, nil
+}
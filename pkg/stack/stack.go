@@ -16,17 +16,17 @@ package stack
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
-	osexec "os/exec"
-	"os/user"
 	"path/filepath"
 	"testing"
 	"time"
 
-	"github.com/docker/docker/pkg/stdcopy"
 	_ "github.com/lib/pq" // postgres driver for wait.ForSQL
-	"github.com/testcontainers/testcontainers-go/exec"
+	"github.com/moby/moby/api/types/mount"
+	"github.com/storacha/smelt/internal/dockerapi"
 	"github.com/testcontainers/testcontainers-go/modules/compose"
 	"github.com/testcontainers/testcontainers-go/wait"
 
@@ -37,11 +37,16 @@ import (
 
 // Stack represents a running Storacha network.
 type Stack struct {
-	t         *testing.T
-	compose   compose.ComposeStack
-	tempDir   string
-	cfg       *config
-	piriNodes []manifest.ResolvedPiriNode
+	t           *testing.T
+	compose     compose.ComposeStack
+	projectName string
+	tempDir     string
+	cfg         *config
+	piriNodes   []manifest.ResolvedPiriNode
+
+	// In-test checkpoints by name; see Checkpoint / Rollback.
+	checkpoints   map[string]*checkpoint
+	checkpointSeq int
 }
 
 // NewStack creates and starts a complete Storacha network.
@@ -52,6 +57,14 @@ func NewStack(ctx context.Context, t *testing.T, opts ...Option) (*Stack, error)
 		opt(cfg)
 	}
 
+	// Under Podman, point testcontainers at its API socket before anything
+	// creates a client.
+	rt, err := dockerapi.Detect()
+	if err != nil {
+		return nil, err
+	}
+	rt.UseSocket()
+
 	// 1. Extract embedded files to temp directory
 	tempDir, err := extractFiles(t)
 	if err != nil {
@@ -62,16 +75,19 @@ func NewStack(ctx context.Context, t *testing.T, opts ...Option) (*Stack, error)
 	// so the rest of the flow can treat it like any path-based snapshot.
 	// Prefer this path over WithSnapshot for external consumers — they
 	// don't have smelt's snapshots/ dir in their checkout, but the
-	// embedded FS travels with the Go import.
+	// embedded FS travels with the Go import. The copy comes from a shared
+	// cache and was verified when it was extracted there.
+	snapVerified := false
 	if cfg.embeddedSnapshotName != "" {
 		if cfg.snapshotPath != "" {
 			return nil, fmt.Errorf("WithEmbeddedSnapshot and WithSnapshot are mutually exclusive")
 		}
-		extracted, err := extractEmbeddedSnapshot(cfg.embeddedSnapshotName, tempDir)
+		extracted, err := extractEmbeddedSnapshot(cfg.embeddedSnapshotName)
 		if err != nil {
 			return nil, err
 		}
 		cfg.snapshotPath = extracted
+		snapVerified = true
 	}
 
 	// 2. Determine topology and stage filesystem state (keys/proofs/chain)
@@ -92,6 +108,11 @@ func NewStack(ctx context.Context, t *testing.T, opts ...Option) (*Stack, error)
 		if err != nil {
 			return nil, err
 		}
+		if !snapVerified {
+			if _, err := snapshot.VerifyDir(snapDir); err != nil {
+				return nil, err
+			}
+		}
 		resolvedNodes, err = loadSnapshotTopology(snapDir)
 		if err != nil {
 			return nil, err
@@ -172,6 +193,14 @@ func NewStack(ctx context.Context, t *testing.T, opts ...Option) (*Stack, error)
 		t.Logf("smeltery: mounting local piri binary from %s", cfg.piriBinaryPath)
 	}
 
+	// 6. Check the snapshot's recorded images against what this stack
+	// would run, and under the pin policy override env to match them.
+	if snapDesc != nil && len(snapDesc.Images) > 0 {
+		if err := applySnapshotImagePolicy(ctx, t, cfg.snapshotImagePolicy, snapDesc, tempDir, composeFiles, env); err != nil {
+			return nil, err
+		}
+	}
+
 	// 7. Create compose stack with optional profiles. The project name is
 	// deterministic per-test so we know volume names in advance — required
 	// for snapshot-based restore to populate volumes BEFORE compose.Up.
@@ -180,6 +209,9 @@ func NewStack(ctx context.Context, t *testing.T, opts ...Option) (*Stack, error)
 		compose.StackIdentifier(projectName),
 		compose.WithStackFiles(composeFiles...),
 	}
+	if cfg.proxy {
+		composeOpts = append(composeOpts, compose.WithProfiles(proxyProfile))
+	}
 
 	composeStack, err := compose.NewDockerComposeWith(composeOpts...)
 	if err != nil {
@@ -187,11 +219,12 @@ func NewStack(ctx context.Context, t *testing.T, opts ...Option) (*Stack, error)
 	}
 
 	stack := &Stack{
-		t:         t,
-		compose:   composeStack,
-		tempDir:   tempDir,
-		cfg:       cfg,
-		piriNodes: resolvedNodes,
+		t:           t,
+		compose:     composeStack,
+		projectName: projectName,
+		tempDir:     tempDir,
+		cfg:         cfg,
+		piriNodes:   resolvedNodes,
 	}
 
 	// Register cleanup BEFORE compose.Up. If Up fails (e.g., a container
@@ -253,6 +286,11 @@ func NewStack(ctx context.Context, t *testing.T, opts ...Option) (*Stack, error)
 			wait.ForHTTP("/readyz").WithPort("3000/tcp").WithStartupTimeout(3*time.Minute))
 	}
 
+	if cfg.proxy {
+		waitStack = waitStack.WaitForService(proxyService,
+			wait.ForListeningPort(proxyPort).WithStartupTimeout(time.Minute))
+	}
+
 	// Up failures propagate up; the t.Cleanup registered above handles
 	// teardown so no matter where Up fails (container healthcheck, wait
 	// timeout, docker daemon hiccup), the half-started stack gets cleaned
@@ -305,30 +343,38 @@ func (s *Stack) Logs(ctx context.Context, service string) (string, error) {
 
 // Exec executes a command inside a service container and returns stdout and stderr separately.
 func (s *Stack) Exec(ctx context.Context, service string, args ...string) (stdout, stderr string, err error) {
-	container, err := s.compose.ServiceContainer(ctx, service)
-	if err != nil {
-		return "", "", fmt.Errorf("get container for %s: %w", service, err)
-	}
-
-	exitCode, reader, err := container.Exec(ctx, args, exec.WithUser("root"))
-	if err != nil {
-		return "", "", fmt.Errorf("exec command: %w", err)
-	}
-
-	// Demultiplex stdout and stderr from Docker's multiplexed stream
 	var stdoutBuf, stderrBuf bytes.Buffer
-	if _, err := stdcopy.StdCopy(&stdoutBuf, &stderrBuf, reader); err != nil {
-		return "", "", fmt.Errorf("read output: %w", err)
-	}
-
+	err = s.ExecStream(ctx, service, nil, &stdoutBuf, &stderrBuf, args...)
 	stdout = stdoutBuf.String()
 	stderr = stderrBuf.String()
 
-	if exitCode != 0 {
-		return stdout, stderr, fmt.Errorf("command failed with exit code %d: stdout=%s stderr=%s", exitCode, stdout, stderr)
+	var exitErr *dockerapi.ExitError
+	if errors.As(err, &exitErr) {
+		return stdout, stderr, fmt.Errorf("command failed with exit code %d: stdout=%s stderr=%s", exitErr.Code, stdout, stderr)
 	}
+	return stdout, stderr, err
+}
 
-	return stdout, stderr, nil
+// ExecStream executes a command inside a service container, streaming
+// stdin to it (if non-nil) and its output to stdout and stderr as it's
+// produced. Use it over Exec to pipe data into a command or for output too
+// large to buffer. stdin must reach EOF or be closed by the caller: a Read
+// blocked on it when the command exits keeps a goroutine alive until it
+// returns.
+func (s *Stack) ExecStream(ctx context.Context, service string, stdin io.Reader, stdout, stderr io.Writer, args ...string) error {
+	id, err := s.containerID(ctx, service)
+	if err != nil {
+		return err
+	}
+	if err := dockerapi.ExecIn(ctx, id, dockerapi.Exec{
+		Cmd:    args,
+		Stdin:  stdin,
+		Stdout: stdout,
+		Stderr: stderr,
+	}); err != nil {
+		return fmt.Errorf("exec command in %s: %w", service, err)
+	}
+	return nil
 }
 
 // Close shuts down the stack and cleans up resources.
@@ -351,40 +397,28 @@ func (s *Stack) Close(ctx context.Context) error {
 
 // chownScratchToHostUser runs a busybox container as root to chown the
 // scratch dir contents back to the host user, so `t.TempDir()`'s
-// post-test cleanup can unlink them. Docker bind mounts preserve host
-// UID/GID, so chown inside the container changes the host file's owner.
+// post-test cleanup can unlink them. Bind mounts preserve host UID/GID,
+// so chown inside the container changes the host file's owner. Under a
+// rootless engine (e.g. rootless Podman) the host user is container
+// root, which dockerapi.HostOwner accounts for.
 func (s *Stack) chownScratchToHostUser(ctx context.Context) {
 	scratchDir := filepath.Join(s.tempDir, "generated", "snapshot-scratch")
 	if _, err := os.Stat(scratchDir); err != nil {
 		return
 	}
-	u, err := user.Current()
+	owner, err := dockerapi.HostOwner(ctx)
 	if err != nil {
 		return
 	}
-	cmd := osexec.CommandContext(ctx, "docker", "run", "--rm", "-u", "0:0",
-		"-v", fmt.Sprintf("%s:/s", scratchDir),
-		"busybox", "chown", "-R", u.Uid+":"+u.Gid, "/s",
-	)
-	_ = cmd.Run()
+	_ = dockerapi.RunHelper(ctx, dockerapi.Helper{
+		Cmd:    []string{"chown", "-R", owner, "/s"},
+		Mounts: []mount.Mount{{Type: mount.TypeBind, Source: scratchDir, Target: "/s"}},
+	})
 }
 
 // PiriEndpointN returns the HTTP endpoint for the Nth piri node.
 func (s *Stack) PiriEndpointN(index int) string {
-	name := fmt.Sprintf("piri-%d", index)
-	container, err := s.compose.ServiceContainer(context.Background(), name)
-	if err != nil {
-		s.t.Fatalf("get %s container: %v", name, err)
-	}
-	host, err := container.Host(context.Background())
-	if err != nil {
-		s.t.Fatalf("get %s host: %v", name, err)
-	}
-	port, err := container.MappedPort(context.Background(), "3000/tcp")
-	if err != nil {
-		s.t.Fatalf("get %s port: %v", name, err)
-	}
-	return fmt.Sprintf("http://%s:%s", host, port.Port())
+	return s.serviceEndpoint(fmt.Sprintf("piri-%d", index), "3000/tcp")
 }
 
 // PiriCount returns the number of piri nodes in the stack.
@@ -394,19 +428,31 @@ func (s *Stack) PiriCount() int {
 
 // EmailEndpoint returns the HTTP API endpoint for the email service.
 func (s *Stack) EmailEndpoint() string {
-	container, err := s.compose.ServiceContainer(context.Background(), "email")
+	return s.serviceEndpoint("email", "80/tcp")
+}
+
+// MinioEndpoint returns the S3 API endpoint of the stack's MinIO
+// (credentials minioadmin/minioadmin).
+func (s *Stack) MinioEndpoint() string {
+	return s.serviceEndpoint("minio", "9000/tcp")
+}
+
+// serviceEndpoint returns the host URL of a service's published port,
+// failing the test if it can't be resolved.
+func (s *Stack) serviceEndpoint(service, port string) string {
+	container, err := s.compose.ServiceContainer(context.Background(), service)
 	if err != nil {
-		s.t.Fatalf("getting email container: %v", err)
+		s.t.Fatalf("getting %s container: %v", service, err)
 	}
 	host, err := container.Host(context.Background())
 	if err != nil {
-		s.t.Fatalf("getting email host: %v", err)
+		s.t.Fatalf("getting %s host: %v", service, err)
 	}
-	port, err := container.MappedPort(context.Background(), "80/tcp")
+	mapped, err := container.MappedPort(context.Background(), port)
 	if err != nil {
-		s.t.Fatalf("getting email port: %v", err)
+		s.t.Fatalf("getting %s port: %v", service, err)
 	}
-	return fmt.Sprintf("http://%s:%s", host, port.Port())
+	return fmt.Sprintf("http://%s:%s", host, mapped.Port())
 }
 
 // generateBinaryOverride creates a compose override file that mounts local binaries
@@ -55,6 +55,10 @@ func testModeEnv(nodes []manifest.ResolvedPiriNode) map[string]string {
 		"SMELT_PIRI_POSTGRES_PORT":      "5432",
 		"SMELT_PIRI_MINIO_S3_PORT":      "9000",
 		"SMELT_PIRI_MINIO_CONSOLE_PORT": "9001",
+
+		// The proxy's mapping fixes the loopback address and container
+		// port, so its variable is the host port alone; 0 is ephemeral.
+		"SMELT_PROXY_PORT": "0",
 	}
 
 	// Per-node piri ports (SMELT_PIRI_0_PORT, SMELT_PIRI_1_PORT, ...).
@@ -76,10 +76,11 @@ fi
 # Step 4: Create Docker network
 echo ""
 echo "Step 4: Creating Docker network..."
-if docker network inspect storacha-network >/dev/null 2>&1; then
+RUNTIME="${SMELT_CONTAINER_RUNTIME:-docker}"
+if "$RUNTIME" network inspect storacha-network >/dev/null 2>&1; then
     echo "  Network 'storacha-network' already exists"
 else
-    docker network create storacha-network
+    "$RUNTIME" network create storacha-network
     echo "  Created network 'storacha-network'"
 fi
 
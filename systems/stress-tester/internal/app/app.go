@@ -6,9 +6,9 @@ import (
 	"log/slog"
 	"time"
 
+	"github.com/storacha/smelt/pkg/clients/guppy"
 	"github.com/storacha/smelt/systems/stress-tester/internal/config"
 	"github.com/storacha/smelt/systems/stress-tester/internal/generator"
-	"github.com/storacha/smelt/systems/stress-tester/internal/guppy"
 	"github.com/storacha/smelt/systems/stress-tester/internal/runner"
 	"github.com/storacha/smelt/systems/stress-tester/internal/store"
 	"github.com/storacha/smelt/systems/stress-tester/internal/telemetry"
@@ -56,11 +56,10 @@ func RunUploadBurstApp(ctx context.Context, cfg *config.Config, instanceName str
 	}
 
 	// Create guppy client
-	guppyClient := guppy.NewCLIClient(
-		cfg.Guppy.BinaryPath,
-		cfg.Guppy.ConfigPath,
-		cfg.Guppy.Email,
-	)
+	guppyClient, err := newGuppyClient(ctx, cfg)
+	if err != nil {
+		return err
+	}
 
 	// Get or create instance
 	// Use provided seed override, or fall back to config seed, or use timestamp
@@ -166,11 +165,10 @@ func RunRetrieveBurstApp(ctx context.Context, cfg *config.Config, instanceName s
 	}
 
 	// Create guppy client
-	guppyClient := guppy.NewCLIClient(
-		cfg.Guppy.BinaryPath,
-		cfg.Guppy.ConfigPath,
-		cfg.Guppy.Email,
-	)
+	guppyClient, err := newGuppyClient(ctx, cfg)
+	if err != nil {
+		return err
+	}
 
 	// Get instance (must exist for retrieval)
 	instance, err := s.GetInstance(ctx, instanceName)
@@ -241,11 +239,10 @@ func RunUploadContinuousApp(ctx context.Context, cfg *config.Config, instanceNam
 	}
 
 	// Create guppy client
-	guppyClient := guppy.NewCLIClient(
-		cfg.Guppy.BinaryPath,
-		cfg.Guppy.ConfigPath,
-		cfg.Guppy.Email,
-	)
+	guppyClient, err := newGuppyClient(ctx, cfg)
+	if err != nil {
+		return err
+	}
 
 	// Get or create instance
 	seed := seedOverride
@@ -348,11 +345,10 @@ func RunRetrieveContinuousApp(ctx context.Context, cfg *config.Config, instanceN
 	}
 
 	// Create guppy client
-	guppyClient := guppy.NewCLIClient(
-		cfg.Guppy.BinaryPath,
-		cfg.Guppy.ConfigPath,
-		cfg.Guppy.Email,
-	)
+	guppyClient, err := newGuppyClient(ctx, cfg)
+	if err != nil {
+		return err
+	}
 
 	// Get instance (must exist for retrieval)
 	instance, err := s.GetInstance(ctx, instanceName)
@@ -394,3 +390,17 @@ func RunRetrieveContinuousApp(ctx context.Context, cfg *config.Config, instanceN
 	// Run the stress test
 	return retrieveRunner.Run(ctx)
 }
+
+// newGuppyClient creates the guppy client and checks the binary prints the
+// JSON records the client decodes, so a guppy too old for them fails here
+// instead of partway through a run.
+func newGuppyClient(ctx context.Context, cfg *config.Config) (*guppy.CLIClient, error) {
+	c := guppy.NewCLIClient(
+		cfg.Guppy.BinaryPath,
+		guppy.WithConfigPath(cfg.Guppy.ConfigPath),
+	)
+	if err := c.CheckJSONOutput(ctx); err != nil {
+		return nil, fmt.Errorf("check guppy at %s: %w", cfg.Guppy.BinaryPath, err)
+	}
+	return c, nil
+}
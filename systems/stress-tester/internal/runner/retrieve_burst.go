@@ -9,8 +9,8 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/storacha/smelt/pkg/clients/guppy"
 	"github.com/storacha/smelt/systems/stress-tester/internal/config"
-	"github.com/storacha/smelt/systems/stress-tester/internal/guppy"
 	"github.com/storacha/smelt/systems/stress-tester/internal/store"
 	"github.com/storacha/smelt/systems/stress-tester/internal/telemetry"
 )
@@ -161,7 +161,7 @@ func (r *RetrieveBurstRunner) performRetrieval(ctx context.Context, upload *stor
 	destPath := fmt.Sprintf("/tmp/stress-retrieve-%d-%d", r.instanceID, upload.ID)
 
 	startTime := time.Now()
-	err := r.guppy.Retrieve(ctx, upload.SpaceDID, upload.CID, destPath)
+	_, err := r.guppy.Retrieve(ctx, upload.SpaceDID, upload.CID, destPath)
 	duration := time.Since(startTime)
 
 	if err != nil {
@@ -9,8 +9,8 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/storacha/smelt/pkg/clients/guppy"
 	"github.com/storacha/smelt/systems/stress-tester/internal/config"
-	"github.com/storacha/smelt/systems/stress-tester/internal/guppy"
 	"github.com/storacha/smelt/systems/stress-tester/internal/store"
 	"github.com/storacha/smelt/systems/stress-tester/internal/telemetry"
 )
@@ -135,7 +135,7 @@ func (r *RetrieveContinuousRunner) doRetrieve(ctx context.Context) {
 	destPath := fmt.Sprintf("/tmp/stress-retrieve-%d-%d", r.instanceID, upload.ID)
 
 	startTime := time.Now()
-	err := r.guppy.Retrieve(ctx, upload.SpaceDID, upload.CID, destPath)
+	_, err := r.guppy.Retrieve(ctx, upload.SpaceDID, upload.CID, destPath)
 	duration := time.Since(startTime)
 
 	if err != nil {
@@ -8,9 +8,9 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/storacha/smelt/pkg/clients/guppy"
 	"github.com/storacha/smelt/systems/stress-tester/internal/config"
 	"github.com/storacha/smelt/systems/stress-tester/internal/generator"
-	"github.com/storacha/smelt/systems/stress-tester/internal/guppy"
 	"github.com/storacha/smelt/systems/stress-tester/internal/store"
 	"github.com/storacha/smelt/systems/stress-tester/internal/telemetry"
 )
@@ -159,7 +159,7 @@ func (r *UploadBurstRunner) logDatabaseSummary(ctx context.Context) {
 func (r *UploadBurstRunner) processSpace(ctx context.Context, spaceIndex int, errorsMu *sync.Mutex, errors *[]string) {
 	// Generate space
 	provisionTo := guppy.EmailToDIDMailto(r.email)
-	spaceDID, err := r.guppy.GenerateSpace(ctx, provisionTo)
+	generated, err := r.guppy.GenerateSpace(ctx, guppy.WithProvisionTo(provisionTo))
 	if err != nil {
 		slog.Error("failed to generate space", "error", err)
 		errorsMu.Lock()
@@ -167,6 +167,7 @@ func (r *UploadBurstRunner) processSpace(ctx context.Context, spaceIndex int, er
 		errorsMu.Unlock()
 		return
 	}
+	spaceDID := generated.DID
 
 	// Record space in store
 	if space, err := r.store.CreateSpace(ctx, r.instanceID, spaceDID); err != nil {
@@ -232,7 +233,7 @@ func (r *UploadBurstRunner) performUpload(ctx context.Context, spaceDID string,
 	}
 
 	// Perform upload
-	cids, err := r.guppy.Upload(ctx, spaceDID)
+	result, err := r.guppy.Upload(ctx, spaceDID)
 	duration := time.Since(startTime)
 
 	if err != nil {
@@ -260,9 +261,9 @@ func (r *UploadBurstRunner) performUpload(ctx context.Context, spaceDID string,
 		slog.Error("failed to increment space bytes", "error", err)
 	}
 
-	// Record only the root CID (last one returned by guppy)
-	if len(cids) > 0 {
-		rootCID := cids[len(cids)-1]
+	// Guppy uploads every source the space has ever had; record the root
+	// of the one just added.
+	if rootCID, ok := result.Root(data.Path); ok {
 		if upload, err := r.store.RecordUpload(ctx, r.instanceID, spaceDID, rootCID, data.Path, data.Hash, data.SizeBytes); err != nil {
 			slog.Error("failed to record upload in db", "error", err, "cid", rootCID)
 		} else {
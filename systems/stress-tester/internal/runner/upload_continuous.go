@@ -8,9 +8,9 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/storacha/smelt/pkg/clients/guppy"
 	"github.com/storacha/smelt/systems/stress-tester/internal/config"
 	"github.com/storacha/smelt/systems/stress-tester/internal/generator"
-	"github.com/storacha/smelt/systems/stress-tester/internal/guppy"
 	"github.com/storacha/smelt/systems/stress-tester/internal/store"
 	"github.com/storacha/smelt/systems/stress-tester/internal/telemetry"
 )
@@ -169,7 +169,7 @@ func (r *UploadContinuousRunner) doUpload(ctx context.Context) {
 	}
 
 	// Perform upload
-	cids, err := r.guppy.Upload(ctx, space.DID)
+	result, err := r.guppy.Upload(ctx, space.DID)
 	duration := time.Since(startTime)
 
 	if err != nil {
@@ -193,8 +193,7 @@ func (r *UploadContinuousRunner) doUpload(ctx context.Context) {
 		slog.Error("failed to increment space bytes", "error", err)
 	}
 
-	if len(cids) > 0 {
-		rootCID := cids[len(cids)-1]
+	if rootCID, ok := result.Root(data.Path); ok {
 		if _, err := r.store.RecordUpload(ctx, r.instanceID, space.DID, rootCID, data.Path, data.Hash, data.SizeBytes); err != nil {
 			slog.Error("failed to record upload in db", "error", err, "cid", rootCID)
 		}
@@ -0,0 +1,63 @@
+//go:build e2e
+
+package e2e
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/storacha/smelt/pkg/clients/guppy"
+	"github.com/storacha/smelt/pkg/stack"
+)
+
+// TestCheckpointRollback exercises Stack.Checkpoint / Stack.Rollback:
+// one login + space creation up front, then each case rolls back to
+// that state before uploading. Every case must succeed from the same
+// starting point, including after earlier cases mutated the stack.
+func TestCheckpointRollback(t *testing.T) {
+	if runtime.GOOS == "darwin" {
+		t.Skip("skipping on darwin (docker-in-docker flakiness)")
+	}
+
+	ctx := t.Context()
+	s := stack.MustNewStack(t, stack.WithEmbeddedSnapshot("3-piri-filesystem-sqlite"))
+
+	gup, err := guppy.NewContainerClient(s)
+	if err != nil {
+		t.Fatalf("guppy client: %v", err)
+	}
+	if err := gup.Login(ctx, "test@example.com"); err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	space, err := gup.GenerateSpace(ctx)
+	if err != nil {
+		t.Fatalf("generate space: %v", err)
+	}
+
+	if err := s.Checkpoint(ctx, "logged-in"); err != nil {
+		t.Fatalf("checkpoint: %v", err)
+	}
+
+	for _, size := range []string{"1MB", "5MB", "1MB"} {
+		t.Run(size, func(t *testing.T) {
+			if err := s.Rollback(ctx, "logged-in"); err != nil {
+				t.Fatalf("rollback: %v", err)
+			}
+
+			dataPath, err := gup.GenerateTestData(ctx, size)
+			if err != nil {
+				t.Fatalf("generate test data: %v", err)
+			}
+			if err := gup.AddSource(ctx, space.DID, dataPath); err != nil {
+				t.Fatalf("add source: %v", err)
+			}
+			upload, err := gup.Upload(ctx, space.DID)
+			if err != nil {
+				t.Fatalf("upload: %v", err)
+			}
+			if len(upload.Sources) != 1 {
+				t.Fatalf("upload reported %d sources, want 1", len(upload.Sources))
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+//go:build e2e
+
+package e2e
+
+import (
+	"os"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/storacha/smelt/pkg/clients/guppy"
+	"github.com/storacha/smelt/pkg/stack"
+)
+
+// guppyCommands is the guppy CLI surface pkg/clients/guppy drives: each
+// subcommand it runs and the flags it passes. TestGuppyCLISurface checks
+// them against the image the stack runs, so a guppy that drops or renames
+// one fails here rather than deep inside a client call.
+var guppyCommands = []struct {
+	cmd   []string
+	flags []string
+}{
+	{cmd: []string{"login"}},
+	{cmd: []string{"whoami"}, flags: []string{"--json"}},
+	{cmd: []string{"space", "generate"}, flags: []string{"--json", "--provision-to"}},
+	{cmd: []string{"space", "ls"}, flags: []string{"--json"}},
+	{cmd: []string{"space", "info"}, flags: []string{"--json"}},
+	{cmd: []string{"space", "provision"}, flags: []string{"--customer"}},
+	{cmd: []string{"delegation", "create"}, flags: []string{"--json", "--space", "--can"}},
+	{cmd: []string{"delegation", "import"}},
+	{cmd: []string{"usage", "report"}, flags: []string{"--json"}},
+	{cmd: []string{"upload"}, flags: []string{"--json", "--replicas"}},
+	{cmd: []string{"upload", "source", "add"}},
+	{cmd: []string{"upload", "ls"}, flags: []string{"--json"}},
+	{cmd: []string{"upload", "rm"}},
+	{cmd: []string{"blob", "ls"}, flags: []string{"--json"}},
+	{cmd: []string{"retrieve"}, flags: []string{"--json"}},
+	{cmd: []string{"verify"}},
+}
+
+// TestGuppyCLISurface reads each command's --help from the guppy image
+// (GUPPY_IMAGE, else the compose default ghcr.io/storacha/guppy:main-dev)
+// and checks the command exists and accepts the flags the client uses.
+// --help can't show what a command prints, so it then runs commands
+// whose --json output the client decodes, through the client's parsers.
+func TestGuppyCLISurface(t *testing.T) {
+	if runtime.GOOS == "darwin" {
+		t.Skip("skipping on darwin (docker-in-docker flakiness)")
+	}
+	ctx := t.Context()
+
+	opts := []stack.Option{stack.WithEmbeddedSnapshot("3-piri-filesystem-sqlite")}
+	if img := os.Getenv("GUPPY_IMAGE"); img != "" {
+		opts = append(opts, stack.WithGuppyImage(img))
+	}
+	s := stack.MustNewStack(t, opts...)
+
+	for _, c := range guppyCommands {
+		name := strings.Join(c.cmd, " ")
+		t.Run(name, func(t *testing.T) {
+			args := append(append([]string{"guppy"}, c.cmd...), "--help")
+			stdout, stderr, err := s.Exec(ctx, "guppy", args...)
+			if err != nil {
+				t.Fatalf("guppy %s --help: %v\nstdout: %s\nstderr: %s", name, err, stdout, stderr)
+			}
+			help := stdout + stderr
+			// cobra falls back to the parent's help for an unknown
+			// subcommand, so check the usage line names this one.
+			if !strings.Contains(help, "guppy "+name) {
+				t.Fatalf("guppy has no %q command:\n%s", name, help)
+			}
+			for _, flag := range c.flags {
+				if !strings.Contains(help, flag) {
+					t.Errorf("guppy %s doesn't accept %s:\n%s", name, flag, help)
+				}
+			}
+		})
+	}
+	gup := guppy.MustNewContainerClient(t, s)
+	if err := gup.Login(ctx, "test@example.com"); err != nil {
+		t.Fatalf("login: %v", err)
+	}
+
+	// CheckJSONOutput decodes `whoami --json` strictly, with no text
+	// fallback; Whoami then has to parse out the agent's did:key.
+	t.Run("whoami output", func(t *testing.T) {
+		if err := gup.CheckJSONOutput(ctx); err != nil {
+			t.Fatal(err)
+		}
+		agent, err := gup.Whoami(ctx)
+		if err != nil {
+			t.Fatalf("whoami: %v", err)
+		}
+		if !strings.HasPrefix(agent, "did:key:") {
+			t.Errorf("whoami: agent %q isn't a did:key", agent)
+		}
+	})
+
+	// A listing has no text fallback, so a guppy that ignores --json
+	// fails here; the space makes sure there's a record to decode.
+	t.Run("space ls output", func(t *testing.T) {
+		space, err := gup.GenerateSpace(ctx)
+		if err != nil {
+			t.Fatalf("space generate: %v", err)
+		}
+		spaces, err := gup.ListSpaces(ctx)
+		if err != nil {
+			t.Fatalf("space ls: %v", err)
+		}
+		if !slices.ContainsFunc(spaces, func(s guppy.Space) bool { return s.DID == space.DID }) {
+			t.Fatalf("space %s not in space ls output %+v", space.DID, spaces)
+		}
+	})
+}
@@ -0,0 +1,205 @@
+//go:build e2e
+
+package e2e
+
+import (
+	"net/http"
+	"runtime"
+	"slices"
+	"testing"
+
+	"github.com/storacha/smelt/pkg/clients/guppy"
+	"github.com/storacha/smelt/pkg/stack"
+)
+
+// TestSpaceLifecycle walks a space through the guppy commands beyond
+// upload and retrieve: listing, info, usage, upload listing and removal.
+func TestSpaceLifecycle(t *testing.T) {
+	if runtime.GOOS == "darwin" {
+		t.Skip("skipping on darwin (docker-in-docker flakiness)")
+	}
+
+	ctx := t.Context()
+	s := stack.MustNewStack(t, stack.WithEmbeddedSnapshot("3-piri-filesystem-sqlite"))
+	gup := guppy.MustNewContainerClient(t, s)
+
+	const email = "test@example.com"
+	if err := gup.Login(ctx, email); err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	space, err := gup.GenerateSpace(ctx)
+	if err != nil {
+		t.Fatalf("generate space: %v", err)
+	}
+
+	spaces, err := gup.ListSpaces(ctx)
+	if err != nil {
+		t.Fatalf("list spaces: %v", err)
+	}
+	if !slices.ContainsFunc(spaces, func(s guppy.Space) bool { return s.DID == space.DID }) {
+		t.Fatalf("space %s not listed in %+v", space.DID, spaces)
+	}
+
+	info, err := gup.SpaceInfo(ctx, space.DID)
+	if err != nil {
+		t.Fatalf("space info: %v", err)
+	}
+	if len(info.Providers) == 0 {
+		if err := gup.ProvisionSpace(ctx, space.DID, guppy.EmailToDIDMailto(email)); err != nil {
+			t.Fatalf("provision: %v", err)
+		}
+	}
+
+	dataPath, err := gup.GenerateTestData(ctx, "1MB")
+	if err != nil {
+		t.Fatalf("generate test data: %v", err)
+	}
+	if err := gup.AddSource(ctx, space.DID, dataPath); err != nil {
+		t.Fatalf("add source: %v", err)
+	}
+	upload, err := gup.Upload(ctx, space.DID)
+	if err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+	root, ok := upload.Root(dataPath)
+	if !ok {
+		t.Fatalf("upload has no root for %s: %+v", dataPath, upload)
+	}
+
+	uploads, err := gup.ListUploads(ctx, space.DID)
+	if err != nil {
+		t.Fatalf("list uploads: %v", err)
+	}
+	if !slices.ContainsFunc(uploads, func(u guppy.UploadInfo) bool { return u.Root == root }) {
+		t.Fatalf("upload %s not listed in %+v", root, uploads)
+	}
+	blobs, err := gup.ListBlobs(ctx, space.DID)
+	if err != nil {
+		t.Fatalf("list blobs: %v", err)
+	}
+	if len(blobs) == 0 {
+		t.Error("no blobs listed after upload")
+	}
+	reports, err := gup.UsageReport(ctx, space.DID)
+	if err != nil {
+		t.Fatalf("usage report: %v", err)
+	}
+	var used int64
+	for _, r := range reports {
+		used += r.Bytes
+	}
+	if used < upload.Bytes() {
+		t.Errorf("usage %d bytes, uploaded %d", used, upload.Bytes())
+	}
+
+	if err := gup.RemoveUpload(ctx, space.DID, root); err != nil {
+		t.Fatalf("remove upload: %v", err)
+	}
+	uploads, err = gup.ListUploads(ctx, space.DID)
+	if err != nil {
+		t.Fatalf("list uploads: %v", err)
+	}
+	if slices.ContainsFunc(uploads, func(u guppy.UploadInfo) bool { return u.Root == root }) {
+		t.Errorf("upload %s still listed after removal", root)
+	}
+}
+
+// TestSharedSpace shares a space between two identities in one stack:
+// bob sees alice's upload only after importing her delegation.
+func TestSharedSpace(t *testing.T) {
+	if runtime.GOOS == "darwin" {
+		t.Skip("skipping on darwin (docker-in-docker flakiness)")
+	}
+
+	ctx := t.Context()
+	s := stack.MustNewStack(t, stack.WithEmbeddedSnapshot("3-piri-filesystem-sqlite"))
+	alice := s.MustNewGuppyClient(t, "alice")
+	bob := s.MustNewGuppyClient(t, "bob")
+
+	if err := alice.Login(ctx, guppy.IdentityEmail("alice")); err != nil {
+		t.Fatalf("alice login: %v", err)
+	}
+	if err := bob.Login(ctx, guppy.IdentityEmail("bob")); err != nil {
+		t.Fatalf("bob login: %v", err)
+	}
+
+	space, err := alice.GenerateSpace(ctx)
+	if err != nil {
+		t.Fatalf("generate space: %v", err)
+	}
+	dataPath, err := alice.GenerateTestData(ctx, "1MB")
+	if err != nil {
+		t.Fatalf("generate test data: %v", err)
+	}
+	if err := alice.AddSource(ctx, space.DID, dataPath); err != nil {
+		t.Fatalf("add source: %v", err)
+	}
+	upload, err := alice.Upload(ctx, space.DID)
+	if err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+	root, _ := upload.Root(dataPath)
+
+	bobSpaces, err := bob.ListSpaces(ctx)
+	if err != nil {
+		t.Fatalf("bob list spaces: %v", err)
+	}
+	if slices.ContainsFunc(bobSpaces, func(s guppy.Space) bool { return s.DID == space.DID }) {
+		t.Fatal("bob sees alice's space before any delegation")
+	}
+
+	bobAgent, err := bob.Whoami(ctx)
+	if err != nil {
+		t.Fatalf("bob whoami: %v", err)
+	}
+	delegation, err := alice.CreateDelegation(ctx, space.DID, bobAgent, guppy.WithAbilities("upload/list"))
+	if err != nil {
+		t.Fatalf("create delegation: %v", err)
+	}
+	if err := bob.ImportDelegation(ctx, delegation); err != nil {
+		t.Fatalf("import delegation: %v", err)
+	}
+
+	uploads, err := bob.ListUploads(ctx, space.DID)
+	if err != nil {
+		t.Fatalf("bob list uploads: %v", err)
+	}
+	if !slices.ContainsFunc(uploads, func(u guppy.UploadInfo) bool { return u.Root == root }) {
+		t.Errorf("bob doesn't see upload %s in %+v", root, uploads)
+	}
+}
+
+// TestProxyHTTPClient reaches in-network URLs from the host through the
+// proxy sidecar, and uses it to click the login validation link in place
+// of the curl-based ExecDoer.
+func TestProxyHTTPClient(t *testing.T) {
+	if runtime.GOOS == "darwin" {
+		t.Skip("skipping on darwin (docker-in-docker flakiness)")
+	}
+
+	ctx := t.Context()
+	s := stack.MustNewStack(t, stack.WithEmbeddedSnapshot("3-piri-filesystem-sqlite"), stack.WithProxy())
+	client := s.HTTPClient()
+
+	// In-network names go through the proxy, host endpoints go direct.
+	for _, u := range []string{"http://upload/health", s.EmailEndpoint() + "/api/server"} {
+		res, err := client.Get(u)
+		if err != nil {
+			t.Fatalf("GET %s: %v", u, err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			t.Errorf("GET %s: status %d", u, res.StatusCode)
+		}
+	}
+
+	validator, err := guppy.NewSMTP4DevLoginValidator(s.EmailEndpoint(),
+		guppy.WithSMTP4DevLoginValidatorClicker(client))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gup := guppy.MustNewContainerClient(t, s, guppy.WithLoginValidator(validator))
+	if err := gup.Login(ctx, "proxy@example.com"); err != nil {
+		t.Fatalf("login: %v", err)
+	}
+}
@@ -3,13 +3,19 @@
 package e2e
 
 import (
+	"bytes"
+	"crypto/rand"
 	"fmt"
 	"os"
+	"path/filepath"
 	"runtime"
+	"slices"
 	"testing"
 	"time"
 
 	"github.com/storacha/smelt/pkg/clients/guppy"
+	"github.com/storacha/smelt/pkg/manifest"
+	"github.com/storacha/smelt/pkg/snapshot"
 	"github.com/storacha/smelt/pkg/stack"
 )
 
@@ -34,12 +40,7 @@ func TestUploadAndRetrieve(t *testing.T) {
 			t.Parallel()
 			ctx := t.Context()
 
-			opts := []stack.Option{
-				stack.WithPiriNodes(stack.PiriNodeConfig{
-					S3:       tt.useS3,
-					Postgres: tt.usePostgres,
-				}),
-			}
+			opts := []stack.Option{bootOption(t, tt.useS3, tt.usePostgres)}
 			if img := os.Getenv("PIRI_IMAGE"); img != "" {
 				opts = append(opts, stack.WithPiriImage(img))
 			}
@@ -57,34 +58,150 @@ func TestUploadAndRetrieve(t *testing.T) {
 				t.Fatalf("failed to login: %v", err)
 			}
 
-			spaceDID, err := gup.GenerateSpace(ctx)
+			space, err := gup.GenerateSpace(ctx)
 			if err != nil {
 				t.Fatalf("failed to generate space: %v", err)
 			}
-			t.Logf("created space: %s", spaceDID)
+			t.Logf("created space: %s", space.DID)
 
 			dataPath, err := gup.GenerateTestData(ctx, "10MB")
 			if err != nil {
 				t.Fatalf("failed to generate test data: %v", err)
 			}
 
-			if err := gup.AddSource(ctx, spaceDID, dataPath); err != nil {
+			if err := gup.AddSource(ctx, space.DID, dataPath); err != nil {
 				t.Fatalf("failed to add source: %v", err)
 			}
 
-			cids, err := gup.Upload(ctx, spaceDID, guppy.WithReplicas(1))
+			upload, err := gup.Upload(ctx, space.DID, guppy.WithReplicas(1))
 			if err != nil {
 				t.Fatalf("failed to upload: %v", err)
 			}
-			if len(cids) == 0 {
-				t.Fatal("expected at least one CID from upload")
+			root, ok := upload.Root(dataPath)
+			if !ok {
+				t.Fatalf("upload has no root for %s: %+v", dataPath, upload)
+			}
+			src := upload.Sources[0]
+			if src.Replicas != 1 {
+				t.Errorf("want 1 replica placed, got %d", src.Replicas)
 			}
-			t.Logf("uploaded CIDs: %v", cids)
+			t.Logf("uploaded %s: %d bytes in %d shard(s)", root, src.Bytes, len(src.Shards))
 
 			dstPath := fmt.Sprintf("/tmp/testdata-download-%d", time.Now().UnixNano())
-			if err := gup.Retrieve(ctx, spaceDID, cids[len(cids)-1], dstPath); err != nil {
+			got, err := gup.Retrieve(ctx, space.DID, root, dstPath)
+			if err != nil {
 				t.Fatalf("failed to retrieve: %v", err)
 			}
+			if got.Bytes != src.Bytes {
+				t.Errorf("retrieved %d bytes, uploaded %d", got.Bytes, src.Bytes)
+			}
 		})
 	}
 }
+
+// bootOption boots one piri node on the given backends: warm from the
+// matching embedded snapshot once `smelt snapshot build-matrix` has
+// produced and committed one, cold otherwise. None of the 1-piri
+// snapshots are built yet, so today every entry cold-boots.
+// SMELT_TEST_NO_SNAPSHOT=1 forces a cold boot, which is what CI should
+// exercise.
+func bootOption(t *testing.T, useS3, usePostgres bool) stack.Option {
+	storage := manifest.StorageSpec{DB: manifest.DBSQLite, Blob: manifest.BlobFS}
+	if useS3 {
+		storage.Blob = manifest.BlobS3
+	}
+	if usePostgres {
+		storage.DB = manifest.DBPostgres
+	}
+	if os.Getenv("SMELT_TEST_NO_SNAPSHOT") == "" {
+		name := snapshot.MatrixSnapshotName(1, storage)
+		names, _ := stack.ListEmbeddedSnapshots()
+		if slices.Contains(names, name) {
+			t.Logf("booting from embedded snapshot %s", name)
+			return stack.WithEmbeddedSnapshot(name)
+		}
+	}
+	return stack.WithPiriNodes(stack.PiriNodeConfig{S3: useS3, Postgres: usePostgres})
+}
+
+// TestUploadHostFilesRoundTrip uploads files written on the host and
+// checks what comes back is byte-for-byte what went in.
+func TestUploadHostFilesRoundTrip(t *testing.T) {
+	if runtime.GOOS == "darwin" {
+		t.Skip("skipping on darwin (docker-in-docker flakiness)")
+	}
+	ctx := t.Context()
+
+	fixture := filepath.Join(t.TempDir(), "fixture")
+	for name, size := range map[string]int{"small.txt": 1 << 10, "nested/large.bin": 3 << 20} {
+		data := make([]byte, size)
+		if _, err := rand.Read(data); err != nil {
+			t.Fatal(err)
+		}
+		p := filepath.Join(fixture, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := stack.MustNewStack(t, stack.WithEmbeddedSnapshot("3-piri-filesystem-sqlite"))
+	gup, err := guppy.NewContainerClient(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := gup.Login(ctx, "test@example.com"); err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	space, err := gup.GenerateSpace(ctx)
+	if err != nil {
+		t.Fatalf("generate space: %v", err)
+	}
+
+	dataPath, err := gup.CopyToGuppy(ctx, fixture)
+	if err != nil {
+		t.Fatalf("copy fixture: %v", err)
+	}
+	if err := gup.AddSource(ctx, space.DID, dataPath); err != nil {
+		t.Fatalf("add source: %v", err)
+	}
+	upload, err := gup.Upload(ctx, space.DID)
+	if err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+	root, ok := upload.Root(dataPath)
+	if !ok {
+		t.Fatalf("upload has no root for %s: %+v", dataPath, upload)
+	}
+	if err := gup.RetrieveAndCompare(ctx, space.DID, root, fixture); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestExecStream pipes binary data through a command in a container and
+// checks it comes back unchanged.
+func TestExecStream(t *testing.T) {
+	if runtime.GOOS == "darwin" {
+		t.Skip("skipping on darwin (docker-in-docker flakiness)")
+	}
+	ctx := t.Context()
+	s := stack.MustNewStack(t, stack.WithEmbeddedSnapshot("3-piri-filesystem-sqlite"))
+
+	data := make([]byte, 5<<20)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := s.ExecStream(ctx, "guppy", bytes.NewReader(data), &out, nil, "cat"); err != nil {
+		t.Fatalf("exec: %v", err)
+	}
+	if !bytes.Equal(out.Bytes(), data) {
+		t.Errorf("got %d bytes back, want the %d sent", out.Len(), len(data))
+	}
+
+	if err := s.ExecStream(ctx, "guppy", nil, nil, nil, "false"); err == nil {
+		t.Error("want error for a failing command")
+	}
+}
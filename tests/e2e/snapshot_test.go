@@ -5,11 +5,16 @@ package e2e
 import (
 	"io"
 	"net/http"
+	"path/filepath"
 	"runtime"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
 	"github.com/storacha/smelt/pkg/clients/guppy"
+	"github.com/storacha/smelt/pkg/snapshot"
 	"github.com/storacha/smelt/pkg/stack"
 )
 
@@ -60,7 +65,7 @@ func TestStackFromSnapshot(t *testing.T) {
 		t.Fatalf("login: %v", err)
 	}
 
-	spaceDID, err := gup.GenerateSpace(ctx)
+	space, err := gup.GenerateSpace(ctx)
 	if err != nil {
 		t.Fatalf("generate space: %v", err)
 	}
@@ -70,17 +75,129 @@ func TestStackFromSnapshot(t *testing.T) {
 		t.Fatalf("generate test data: %v", err)
 	}
 
-	if err := gup.AddSource(ctx, spaceDID, dataPath); err != nil {
+	if err := gup.AddSource(ctx, space.DID, dataPath); err != nil {
 		t.Fatalf("add source: %v", err)
 	}
 
-	cids, err := gup.Upload(ctx, spaceDID)
+	upload, err := gup.Upload(ctx, space.DID)
 	if err != nil {
 		t.Fatalf("upload: %v", err)
 	}
-	if len(cids) == 0 {
-		t.Fatal("upload returned no CIDs")
+	root, ok := upload.Root(dataPath)
+	if !ok {
+		t.Fatalf("upload has no root for %s: %+v", dataPath, upload)
 	}
 
-	t.Logf("uploaded %d CID(s) via snapshot-loaded stack", len(cids))
+	t.Logf("uploaded %s (%d bytes) via snapshot-loaded stack", root, upload.Bytes())
+}
+
+// TestSaveSnapshotFromStack closes the loop between SDK and CLI: state
+// produced inside one stack is saved with SaveSnapshot, and a second
+// stack booted from it sees that state.
+func TestSaveSnapshotFromStack(t *testing.T) {
+	if runtime.GOOS == "darwin" {
+		t.Skip("skipping on darwin (docker-in-docker flakiness)")
+	}
+
+	ctx := t.Context()
+	dir := filepath.Join(t.TempDir(), "logged-in")
+
+	t.Run("save", func(t *testing.T) {
+		s := stack.MustNewStack(t, stack.WithEmbeddedSnapshot("3-piri-filesystem-sqlite"))
+		gup, err := guppy.NewContainerClient(s)
+		if err != nil {
+			t.Fatalf("guppy client: %v", err)
+		}
+		if err := gup.Login(ctx, "test@example.com"); err != nil {
+			t.Fatalf("login: %v", err)
+		}
+		if _, err := gup.GenerateSpace(ctx); err != nil {
+			t.Fatalf("generate space: %v", err)
+		}
+		if err := s.SaveSnapshot(ctx, dir); err != nil {
+			t.Fatalf("save snapshot: %v", err)
+		}
+	})
+
+	t.Run("load", func(t *testing.T) {
+		s := stack.MustNewStack(t, stack.WithSnapshot(dir))
+		if s.PiriCount() != 3 {
+			t.Fatalf("expected 3 piri nodes from saved topology, got %d", s.PiriCount())
+		}
+		gup, err := guppy.NewContainerClient(s)
+		if err != nil {
+			t.Fatalf("guppy client: %v", err)
+		}
+		// The space created before the save lives in guppy-data; without
+		// a login the upload path would fail, so reaching a CID proves the
+		// client state travelled.
+		space, err := gup.GenerateSpace(ctx)
+		if err != nil {
+			t.Fatalf("generate space: %v", err)
+		}
+		dataPath, err := gup.GenerateTestData(ctx, "1MB")
+		if err != nil {
+			t.Fatalf("generate test data: %v", err)
+		}
+		if err := gup.AddSource(ctx, space.DID, dataPath); err != nil {
+			t.Fatalf("add source: %v", err)
+		}
+		upload, err := gup.Upload(ctx, space.DID)
+		if err != nil {
+			t.Fatalf("upload: %v", err)
+		}
+		if _, ok := upload.Root(dataPath); !ok {
+			t.Fatalf("upload has no root for %s: %+v", dataPath, upload)
+		}
+	})
+}
+
+// TestSnapshotRemoteMinio pushes the committed snapshot to the stack's
+// own MinIO and pulls it back into an empty project.
+func TestSnapshotRemoteMinio(t *testing.T) {
+	if runtime.GOOS == "darwin" {
+		t.Skip("skipping on darwin (docker-in-docker flakiness)")
+	}
+
+	ctx := t.Context()
+	s := stack.MustNewStack(t, stack.WithEmbeddedSnapshot("3-piri-filesystem-sqlite"))
+
+	endpoint := s.MinioEndpoint()
+	t.Setenv("AWS_ENDPOINT_URL", endpoint)
+	t.Setenv("AWS_ACCESS_KEY_ID", "minioadmin")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "minioadmin")
+	mc, err := minio.New(strings.TrimPrefix(endpoint, "http://"), &minio.Options{
+		Creds: credentials.NewStaticV4("minioadmin", "minioadmin", ""),
+	})
+	if err != nil {
+		t.Fatalf("minio client: %v", err)
+	}
+	if err := mc.MakeBucket(ctx, "snapshots", minio.MakeBucketOptions{}); err != nil {
+		t.Fatalf("make bucket: %v", err)
+	}
+
+	remote, err := snapshot.OpenRemote("s3://snapshots/team")
+	if err != nil {
+		t.Fatalf("open remote: %v", err)
+	}
+	_, file, _, _ := runtime.Caller(0)
+	src := filepath.Join(filepath.Dir(file), "..", "..", "snapshots", "3-piri-filesystem-sqlite")
+	if _, err := snapshot.Push(ctx, snapshot.PushOpts{ProjectDir: t.TempDir(), NameOrPath: src, Remote: remote, As: "baseline"}); err != nil {
+		t.Fatalf("push: %v", err)
+	}
+	stats, err := snapshot.Push(ctx, snapshot.PushOpts{ProjectDir: t.TempDir(), NameOrPath: src, Remote: remote, As: "baseline"})
+	if err != nil {
+		t.Fatalf("re-push: %v", err)
+	}
+	if stats.Transferred != 0 {
+		t.Errorf("re-push uploaded %d objects, want 0", stats.Transferred)
+	}
+
+	project := t.TempDir()
+	if _, err := snapshot.Pull(ctx, snapshot.PullOpts{ProjectDir: project, Name: "baseline", Remote: remote}); err != nil {
+		t.Fatalf("pull: %v", err)
+	}
+	if _, err := snapshot.Verify(project, "baseline"); err != nil {
+		t.Fatalf("verify pulled snapshot: %v", err)
+	}
 }